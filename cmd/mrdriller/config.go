@@ -0,0 +1,311 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadConfig sets the flags of fs that weren't given on the command line
+// from a -config file, and returns the start URLs it names, if any: url,
+// then those in the urls array. The file is TOML, of which only the key =
+// value pairs are understood, keyed by flag name, e.g.
+//
+//	url = "https://example.org/"
+//	urls = ["https://example.org/blog/", "https://docs.example.org/"]
+//	depth = 3
+//	workers = 4
+//	include = [
+//	  'example\.org/docs/',
+//	  '\.pdf$',
+//	]
+//	header = ["Referer: https://example.org/"]
+//
+// Arrays are for the flags that can be repeated. Underscores in keys may
+// stand for dashes, as in user_agent.
+func loadConfig(file string, fs *flag.FlagSet) ([]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	p := &configParser{s: string(b), line: 1}
+
+	var startURL string
+	var startURLs []string
+
+	for {
+		key, values, array, err := p.next()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, p.line, err)
+		}
+
+		if key == "" {
+			if startURL != "" {
+				startURLs = append([]string{startURL}, startURLs...)
+			}
+
+			return startURLs, nil
+		}
+
+		name := strings.ReplaceAll(key, "_", "-")
+
+		switch name {
+		case "url":
+			if array || len(values) != 1 {
+				return nil, fmt.Errorf("%s: url must be a string", file)
+			}
+
+			startURL = values[0]
+			continue
+
+		case "urls":
+			if !array {
+				return nil, fmt.Errorf("%s: urls must be an array", file)
+			}
+
+			startURLs = values
+			continue
+		}
+
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("%s: unknown setting %s", file, key)
+		}
+
+		// the command line wins
+		if given[name] {
+			continue
+		}
+
+		if _, repeatable := f.Value.(*listFlags); array && !repeatable {
+			return nil, fmt.Errorf("%s: %s can't be an array", file, key)
+		}
+
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("%s: invalid %s: %v", file, key, err)
+			}
+		}
+	}
+}
+
+// envPrefix starts the names of the environment variables flags can be set
+// with, e.g. MRDRILLER_USER_AGENT for -user-agent.
+const envPrefix = "MRDRILLER_"
+
+// loadEnv sets the flags of fs that weren't given on the command line from
+// their environment variables, and returns MRDRILLER_URL, the start URL.
+// The values of repeatable flags are split into lines, one per flag. Other
+// variables that happen to start with MRDRILLER_ are ignored, with a
+// warning to warn.
+func loadEnv(fs *flag.FlagSet, warn io.Writer) (string, error) {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	startURL := ""
+
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+
+		name := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(key, envPrefix), "_", "-"))
+
+		if name == "url" {
+			startURL = value
+			continue
+		}
+
+		f := fs.Lookup(name)
+		if f == nil {
+			fmt.Fprintf(warn, "ignoring %s, which isn't named after a flag\n", key)
+			continue
+		}
+
+		if given[name] {
+			continue
+		}
+
+		values := []string{value}
+		if _, repeatable := f.Value.(*listFlags); repeatable {
+			values = strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return "", fmt.Errorf("invalid %s: %v", key, err)
+			}
+		}
+	}
+
+	return startURL, nil
+}
+
+// configParser reads the key = value pairs of a TOML file one at a time.
+type configParser struct {
+	s    string
+	line int
+}
+
+// next returns the next key and its value, or its values if it's an
+// array, and an empty key at the end of the file.
+func (p *configParser) next() (key string, values []string, array bool, err error) {
+	p.skip(true)
+
+	if p.s == "" {
+		return "", nil, false, nil
+	}
+
+	if p.s[0] == '[' {
+		return "", nil, false, fmt.Errorf("tables aren't supported")
+	}
+
+	if p.s[0] == '"' || p.s[0] == '\'' {
+		key, err = p.str()
+	} else {
+		end := strings.IndexFunc(p.s, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+		})
+		if end < 0 {
+			end = len(p.s)
+		}
+
+		key, p.s = p.s[:end], p.s[end:]
+	}
+
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	if key == "" {
+		return "", nil, false, fmt.Errorf("expected a key")
+	}
+
+	p.skip(false)
+
+	if !strings.HasPrefix(p.s, "=") {
+		return "", nil, false, fmt.Errorf("expected = after %s", key)
+	}
+
+	p.s = p.s[1:]
+	p.skip(false)
+
+	if strings.HasPrefix(p.s, "[") {
+		p.s = p.s[1:]
+		array = true
+
+		for {
+			// arrays may span lines and have comments in them
+			p.skip(true)
+
+			if strings.HasPrefix(p.s, "]") {
+				p.s = p.s[1:]
+				break
+			}
+
+			v, err := p.value()
+			if err != nil {
+				return "", nil, false, err
+			}
+
+			values = append(values, v)
+			p.skip(true)
+
+			if strings.HasPrefix(p.s, ",") {
+				p.s = p.s[1:]
+			} else if !strings.HasPrefix(p.s, "]") {
+				return "", nil, false, fmt.Errorf("expected , or ] in the array of %s", key)
+			}
+		}
+	} else {
+		v, err := p.value()
+		if err != nil {
+			return "", nil, false, err
+		}
+
+		values = []string{v}
+	}
+
+	p.skip(false)
+
+	if p.s != "" && p.s[0] != '\n' && p.s[0] != '\r' {
+		return "", nil, false, fmt.Errorf("expected the end of the line after %s", key)
+	}
+
+	return key, values, array, nil
+}
+
+// value reads a string, or a number or boolean as it's written.
+func (p *configParser) value() (string, error) {
+	if strings.HasPrefix(p.s, `"`) || strings.HasPrefix(p.s, "'") {
+		return p.str()
+	}
+
+	end := strings.IndexAny(p.s, " \t\r\n#,]")
+	if end < 0 {
+		end = len(p.s)
+	}
+
+	v := p.s[:end]
+	if v == "" {
+		return "", fmt.Errorf("expected a value")
+	}
+
+	p.s = p.s[end:]
+
+	return strings.ReplaceAll(v, "_", ""), nil
+}
+
+// str reads a basic string, with escapes, or a literal string, without.
+func (p *configParser) str() (string, error) {
+	q := p.s[0]
+
+	for i := 1; i < len(p.s); i++ {
+		switch {
+		case p.s[i] == '\n':
+			return "", fmt.Errorf("unterminated string")
+		case p.s[i] == '\\' && q == '"':
+			i++
+		case p.s[i] == q:
+			raw := p.s[:i+1]
+			p.s = p.s[i+1:]
+
+			if q == '\'' {
+				return raw[1 : len(raw)-1], nil
+			}
+
+			return strconv.Unquote(raw)
+		}
+	}
+
+	return "", fmt.Errorf("unterminated string")
+}
+
+// skip skips spaces and comments, and line breaks too if lines is set.
+func (p *configParser) skip(lines bool) {
+	for p.s != "" {
+		switch c := p.s[0]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.s = p.s[1:]
+		case c == '\n' && lines:
+			p.s = p.s[1:]
+			p.line++
+		case c == '#':
+			if end := strings.IndexByte(p.s, '\n'); end >= 0 {
+				p.s = p.s[end:]
+			} else {
+				p.s = ""
+			}
+		default:
+			return
+		}
+	}
+}
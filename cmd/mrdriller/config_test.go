@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags is a flag set with a few flags of each kind, as they're
+// defined for the crawl command.
+func testFlags(depth *int, agent *string, include *listFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.IntVar(depth, "depth", 1, "")
+	fs.StringVar(agent, "user-agent", "", "")
+	fs.Var(include, "include", "")
+
+	return fs
+}
+
+// writeConfig writes a -config file holding s.
+func writeConfig(t *testing.T, s string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "mrdriller.toml")
+	if err := os.WriteFile(file, []byte(s), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	var depth int
+	var agent string
+	var include listFlags
+
+	fs := testFlags(&depth, &agent, &include)
+	fs.Parse([]string{"-depth", "7"})
+
+	file := writeConfig(t, `# a comment
+url = "https://example.org/"
+urls = [
+  "https://docs.example.org/", # with a comment
+  'https://blog.example.org/',
+]
+depth = 3
+user_agent = "mrdriller (+https://example.org/contact)"
+include = ['example\.org/docs/', "\\.pdf$"]
+`)
+
+	urls, err := loadConfig(file, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "https://example.org/ https://docs.example.org/ https://blog.example.org/"; strings.Join(urls, " ") != want {
+		t.Errorf("got start URLs %v, want %s", urls, want)
+	}
+
+	// the command line wins
+	if depth != 7 {
+		t.Errorf("depth = %d, want the 7 given on the command line", depth)
+	}
+
+	if agent != "mrdriller (+https://example.org/contact)" {
+		t.Errorf("user-agent = %q", agent)
+	}
+
+	if want := `example\.org/docs/ \.pdf$`; strings.Join(include, " ") != want {
+		t.Errorf("include = %v, want %s", include, want)
+	}
+}
+
+func TestLoadConfigURLs(t *testing.T) {
+	for _, c := range []struct {
+		config string
+		want   string
+	}{
+		{"", ""},
+		{`url = "https://a/"`, "https://a/"},
+		{`urls = ["https://a/", "https://b/"]`, "https://a/ https://b/"},
+		{"urls = []", ""},
+	} {
+		var depth int
+		var agent string
+		var include listFlags
+
+		urls, err := loadConfig(writeConfig(t, c.config), testFlags(&depth, &agent, &include))
+		if err != nil {
+			t.Errorf("%q: %v", c.config, err)
+			continue
+		}
+
+		if strings.Join(urls, " ") != c.want {
+			t.Errorf("%q gave start URLs %v, want %s", c.config, urls, c.want)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, c := range []struct{ config, err string }{
+		{`url = ["https://a/"]`, "url must be a string"},
+		{`urls = "https://a/"`, "urls must be an array"},
+		{"depth = [1, 2]", "can't be an array"},
+		{"depth = deep", "invalid depth"},
+		{"colour = 1", "unknown setting colour"},
+		{"[crawl]", "tables aren't supported"},
+		{"depth 3", "expected ="},
+		{`user-agent = "unterminated`, "unterminated string"},
+		{"include = ['a' 'b']", "expected , or ]"},
+		{"depth = 1 2", "expected the end of the line"},
+	} {
+		var depth int
+		var agent string
+		var include listFlags
+
+		_, err := loadConfig(writeConfig(t, c.config), testFlags(&depth, &agent, &include))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got %v, want an error saying %s", c.config, err, c.err)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	var depth int
+	var agent string
+	var include listFlags
+
+	fs := testFlags(&depth, &agent, &include)
+	fs.Parse([]string{"-user-agent", "given"})
+
+	t.Setenv("MRDRILLER_URL", "https://example.org/")
+	t.Setenv("MRDRILLER_DEPTH", "3")
+	t.Setenv("MRDRILLER_USER_AGENT", "from the environment")
+	t.Setenv("MRDRILLER_INCLUDE", "a\nb\r\n")
+	t.Setenv("MRDRILLER_HOME", "/opt/mrdriller")
+
+	var warn strings.Builder
+
+	url, err := loadEnv(fs, &warn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url != "https://example.org/" || depth != 3 || agent != "given" || strings.Join(include, " ") != "a b" {
+		t.Errorf("got %s, depth %d, user-agent %q, include %v", url, depth, agent, include)
+	}
+
+	// not a flag, but not fatal either
+	if !strings.Contains(warn.String(), "ignoring MRDRILLER_HOME") {
+		t.Errorf("warned %q, want MRDRILLER_HOME ignored", warn.String())
+	}
+
+	t.Setenv("MRDRILLER_DEPTH", "deep")
+
+	if _, err = loadEnv(testFlags(&depth, &agent, &include), io.Discard); err == nil || !strings.Contains(err.Error(), "MRDRILLER_DEPTH") {
+		t.Errorf("got %v, want an invalid MRDRILLER_DEPTH", err)
+	}
+}
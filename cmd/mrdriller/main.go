@@ -0,0 +1,504 @@
+// Command mrdriller mirrors websites, serves, rewrites and verifies the
+// mirrors and reports on crawls.
+// The crawling is done by the crawler package, which other Go programs can
+// use the same way.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"mrdriller.tld/mrdriller/crawler"
+)
+
+// listFlags is an implementation of the flag.Value interface
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return fmt.Sprintf("%v", *l)
+}
+
+func (l *listFlags) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runCrawl implements the crawl command, mirroring a site into the current
+// directory. It is also what a bare `mrdriller URL` runs.
+func runCrawl(args []string) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+
+	o := crawler.DefaultOptions()
+
+	var mirror bool
+	var configFile string
+	var urlList string
+	var logFormat string
+	var quiet, verbose, veryVerbose bool
+	var noProgress bool
+
+	fs.BoolVar(&mirror, "mirror", false, "keep a local copy of a site in sync, like wget -m: shorthand for -depth with no limit, -timestamping, -resume and -page-requisites, unless given otherwise")
+	fs.BoolVar(&o.Resume, "resume", o.Resume, "resume previously downloaded files")
+	fs.UintVar(&o.Depth, "depth", o.Depth, "depth for recursion")
+	fs.IntVar(&o.Workers, "workers", o.Workers, "how many files to download at once")
+	fs.Var((*listFlags)(&o.Include), "include", `regex(es) of URLs limiting what to include when downloading, e.g. -include 'blog.cr.yp.to/(.*html|.*jpg)$' [default: ".*"]`)
+	fs.Var((*listFlags)(&o.Exclude), "exclude", "regex(es) of URLs of what not to include when downloading, e.g. -exclude 'blog.cr.yp.to/.*js$'")
+	fs.Var((*listFlags)(&o.Refresh), "refresh", "regex(es) of URLs of what should always be redownloaded, e.g. -refresh '\\.md5$'")
+	fs.Var((*listFlags)(&o.Seed), "seed", "regex(es) of URLs of seed pages; when given, only files within -seed-hops links of a seed page are saved, everything else is only crawled through")
+	fs.UintVar(&o.SeedHops, "seed-hops", o.SeedHops, "how many links away from a -seed page files are still saved")
+	fs.UintVar(&o.MaxQueryVariants, "max-query-variants", o.MaxQueryVariants, "crawl at most this many distinct query strings of the same path, e.g. of faceted search pages (0 is unlimited)")
+	fs.UintVar(&o.MaxPathDepth, "max-path-depth", o.MaxPathDepth, "treat URLs with more path segments than this as crawler traps and skip them (0 is unlimited)")
+	fs.BoolVar(&o.Sitemap, "sitemap", o.Sitemap, "also crawl the pages listed in the start URL's /sitemap.xml, following sitemap indexes, so pages no link leads to are mirrored too")
+	fs.BoolVar(&o.UseSitemapHints, "use-sitemap-hints", o.UseSitemapHints, "also crawl the pages listed in the sitemaps declared by Sitemap: lines in the start URL's robots.txt")
+	fs.UintVar(&o.TemplateSample, "template-sample", o.TemplateSample, "crawl at most this many URLs that only differ in numbers, UUIDs or hashes in their path segments and query values, e.g. /product/1 and /product/2, sampling large templated URL spaces (0 is unlimited)")
+	fs.BoolVar(&o.PlanFirst, "plan-first", o.PlanFirst, "crawl everything in scope with HEAD requests first, fetching only HTML pages to find their links, and report the number and size of files to download by type before downloading them; -header-filter applies to the plan too")
+	fs.BoolVar(&o.PlanOnly, "plan-only", o.PlanOnly, "like -plan-first, but stop after reporting the plan without downloading anything")
+	fs.BoolVar(&o.Spider, "spider", o.Spider, "like -plan-only, but print the status code and URL of everything the crawl would fetch to stdout instead of the plan, e.g. to tune -include and -exclude before a real crawl")
+	fs.StringVar(&o.Verify, "verify", o.Verify, "check downloads against the sha256 or md5 digest given by their Digest, Content-Digest or Content-MD5 headers or -verify-sums file, deleting them on a mismatch so -retries downloads them again")
+	fs.StringVar(&o.VerifySums, "verify-sums", o.VerifySums, "with -verify, where to find the checksum file of each download relative to it, with {} standing for its file name, e.g. '{}.sha256' or 'SHA256SUMS'")
+	fs.BoolVar(&o.NewerOnly, "newer-only", o.NewerOnly, "make the downloads of -refresh URLs conditional with If-Modified-Since the local copy's modification time, so only what changed on the server is downloaded again")
+	fs.BoolVar(&o.Timestamping, "timestamping", o.Timestamping, "download files again when the server's Last-Modified is newer than the local copy's modification time, which is always set from it, as well as when their size changed")
+	fs.BoolVar(&o.StoreValidators, "store-validators", o.StoreValidators, "remember the ETag and Last-Modified of downloads (under .mrdriller/ in the mirror) and check freshness with a conditional HEAD instead of only comparing sizes")
+	fs.BoolVar(&o.IPFSAware, "ipfs-aware", o.IPFSAware, "never recheck already downloaded /ipfs/<cid>/ gateway URLs, as their content is immutable")
+	fs.StringVar(&o.HeaderFilter, "header-filter", o.HeaderFilter, "skip downloads whose response headers match this expression, e.g. -header-filter 'content-length > 10485760 || content-type ~ ^image/'; supports ||, &&, !, parentheses and the operators == != ~ !~ < <= > >=, values run to the next space or can be double quoted with Go escapes, and a header name on its own tests for its presence")
+	fs.StringVar(&o.FrontierOut, "frontier-out", o.FrontierOut, "export the crawl frontier, the queued URLs with their depth and the page linking to them, as JSON lines to this file on SIGUSR1 (not on Windows), when interrupted and when the crawl ends")
+	fs.StringVar(&o.FrontierIn, "frontier-in", o.FrontierIn, "start from the queued URLs of a frontier exported with -frontier-out instead of the start URL, which still sets the host to crawl")
+	fs.BoolVar(&o.DetectChallenges, "detect-challenges", o.DetectChallenges, "recognise bot challenge pages (e.g. Cloudflare's \"Just a moment...\") by markers in their first 64KiB and report them instead of saving them as content")
+	fs.Var((*listFlags)(&o.ChallengeMarkers), "challenge-marker", "regex(es) matched against the start of responses by -detect-challenges, replacing the built in markers of common bot protection services; implies -detect-challenges")
+	fs.DurationVar(&o.ChallengeWait, "challenge-wait", o.ChallengeWait, "with -detect-challenges, wait this long and try again, up to 3 times, when a challenge is recognised (0 gives up straight away)")
+	fs.Var((*listFlags)(&o.StripParams), "strip-params", "query parameter(s) to remove from URLs before deciding whether they were already crawled and where they're saved, in addition to the built in list of tracking parameters like utm_* and fbclid; a trailing * matches any suffix, e.g. -strip-params 'ref_*'")
+	fs.BoolVar(&o.KeepTrackingParams, "keep-tracking-params", o.KeepTrackingParams, "don't remove the built in list of tracking parameters from URLs, only those given with -strip-params")
+	fs.IntVar(&o.Retries, "retries", o.Retries, "try downloads failing with a server error, a timeout or a dropped connection again up to this many times, waiting exponentially longer in between")
+	fs.Var((*listFlags)(&o.OnStatus), "on-status", "status=action mapping(s) for non-200 responses, where action is skip (ignore quietly), retry (try again like a server error, up to -retries times or 3 if that's unset) or record (save the body anyway), e.g. -on-status 404=record")
+	fs.BoolVar(&o.IncludeSubdomains, "include-subdomains", o.IncludeSubdomains, "also crawl the subdomains of the start URL's host, e.g. www.example.org and docs.example.org when starting from example.org, saving them under their own host directories")
+	fs.BoolVar(&o.SpanHosts, "span-hosts", o.SpanHosts, "also crawl links to the hosts allowed by -domain, saving them under their own host directories")
+	fs.Var((*listFlags)(&o.Domains), "domain", "with -span-hosts, a domain whose hosts, its subdomains included, may be crawled, e.g. -domain cdn.example.org (repeatable)")
+	fs.BoolVar(&o.PageRequisites, "page-requisites", o.PageRequisites, "always download the images, stylesheets, scripts, fonts and media pages need to render, like wget -p: from any host, and however deep, as they count as being as deep as their page; implies -page-requisites-span-hosts")
+	fs.BoolVar(&o.PageRequisitesSpanHosts, "page-requisites-span-hosts", o.PageRequisitesSpanHosts, "also download images, stylesheets and scripts hosted elsewhere (e.g. on a CDN), without crawling any further from them")
+	fs.StringVar(&o.CrossScheme, "cross-scheme", o.CrossScheme, "what to do with absolute links to the start URL's host using another scheme, e.g. http:// links on an https:// site: follow them as they are (mirroring them separately under http:host), upgrade http:// links to https://, or skip them")
+	fs.StringVar(&o.Canonical, "canonical", o.Canonical, "what to do with pages whose <link rel=\"canonical\"> names another URL on a crawled host: keep them as they are, or collapse them onto the canonical URL, downloading that instead")
+	fs.BoolVar(&o.CollapseWWW, "collapse-www", o.CollapseWWW, "treat www.host and host as the same host, using whichever form the start URL has")
+	fs.StringVar(&o.WARCFile, "warc-file", o.WARCFile, "also write every request and response to `prefix`.warc.gz, a WARC 1.1 file, with a CDX index in prefix.cdx for replay tools like pywb")
+	fs.StringVar(&o.Index, "index", o.Index, "write the URL, status, content type, size, SHA-256, local path and fetch time of every URL fetched to this CSV file, e.g. to load into SQLite with .import --csv")
+	fs.StringVar(&o.Manifest, "manifest", o.Manifest, "write a JSON line with the URL, local path, status, size, SHA-256, content type, download time in milliseconds and linking page of every URL fetched to this file, e.g. manifest.jsonl")
+	fs.StringVar(&o.SummaryFile, "summary-file", o.SummaryFile, "also write the summary logged at the end of the crawl, of what was downloaded, failed and skipped, as JSON to this file")
+	fs.StringVar(&o.MetricsAddr, "metrics-addr", o.MetricsAddr, "serve Prometheus metrics of the requests by status, bytes downloaded, queue length and fetch latency on this address at /metrics while crawling, e.g. :9090")
+	fs.StringVar(&urlList, "i", "", "also start from the URLs listed in this file, one per line, or on stdin with -i -, crawling them together with those given as arguments, with a shared queue and each from depth 0; their hosts are crawled like the first start URL's")
+	fs.StringVar(&configFile, "config", "", "read settings from this TOML file of flag = value lines, with arrays for repeatable flags, url for the start URL and urls for more, e.g. -config mrdriller.toml; flags given on the command line win")
+	fs.StringVar(&o.NotifyURL, "notify-url", o.NotifyURL, "POST the summary of the crawl and the URLs that failed as JSON to this webhook when the crawl finishes, or is aborted by a signal or -strict")
+	fs.StringVar(&o.PageMetadata, "page-metadata", o.PageMetadata, "write the title and description of every HTML page as JSON lines to this file")
+	fs.StringVar(&o.RedirectMap, "redirect-map", o.RedirectMap, "write every redirected download as a JSON line with its original URL, final URL and the chain of redirects in between to this file")
+	fs.StringVar(&o.EventSocket, "event-socket", o.EventSocket, "also stream progress as JSON lines to this named pipe, or to readers of a Unix socket created at this path; events are dropped while nobody is reading")
+	fs.StringVar(&logFormat, "log-format", "text", "log what the crawl does to stderr as text, or as json with an object per line for log shippers such as Loki or Logstash")
+	fs.BoolVar(&quiet, "q", false, "only log warnings and errors, e.g. for cron jobs")
+	fs.BoolVar(&verbose, "v", false, "also log the crawl's settings, the links queued from every page and the URLs -include and -exclude leave out")
+	fs.BoolVar(&veryVerbose, "vv", false, "like -v, and also log every request sent and the status and headers of its response")
+	fs.BoolVar(&noProgress, "no-progress", false, "don't show progress bars of the downloads in progress, as is done when stderr is a terminal")
+	fs.BoolVar(&o.VerifyComplete, "verify-complete", o.VerifyComplete, "once the crawl finishes, reread the saved HTML pages of the start URL's host and report links to included files that are missing from the mirror")
+	fs.BoolVar(&o.HostStats, "host-stats", o.HostStats, "once the crawl finishes, print the files, bytes, average response time and errors of every host downloaded from, naming the slowest host and the one with the most errors")
+	fs.StringVar(&o.BaseArchive, "base-archive", o.BaseArchive, "directory of an earlier mirror to build an incremental one against: files still the same as in it, by size, stored validators or content, are left out of the current directory, which only gets new and changed files")
+	fs.StringVar(&o.OutputArchive, "output-archive", o.OutputArchive, "move each file into this tar, tar.gz or zip file as soon as it's downloaded instead of keeping it in the mirror directory")
+	fs.StringVar(&o.Output, "output", o.Output, "move each file to this directory, s3://bucket/prefix or gs://bucket/prefix as soon as it's downloaded instead of keeping it in the mirror directory, which is still where downloads are made and metadata kept; S3 takes credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION, GCS an HMAC key from GS_ACCESS_KEY_ID and GS_SECRET_ACCESS_KEY")
+	fs.StringVar(&o.ArchivePerHost, "archive-per-host", o.ArchivePerHost, "write each host's mirror as a separate tar file named after the host into this directory, as soon as nothing more of the host is queued, or at the end for hosts only visited for page requisites")
+	fs.Float64Var(&o.MaxRedirectRatio, "max-redirect-ratio", o.MaxRedirectRatio, "warn when the crawl averages more than this many redirects per downloaded file (0 disables)")
+	fs.BoolVar(&o.Strict, "strict", o.Strict, "abort the crawl instead of warning when -max-redirect-ratio is exceeded")
+	fs.StringVar(&o.UserAgent, "user-agent", o.UserAgent, "User-Agent header to send with every request instead of Go's default, e.g. -user-agent 'mrdriller (+https://example.org/contact)'")
+	fs.Var((*listFlags)(&o.Headers), "header", "header(s) to send with every request, e.g. -header 'Authorization: Bearer xyz' -header 'Referer: https://example.org/'")
+	fs.IntVar(&o.MaxRedirects, "max-redirects", o.MaxRedirects, "give up on a URL after following this many redirects in a row")
+	fs.BoolVar(&o.NoFollowRedirects, "no-follow-redirects", o.NoFollowRedirects, "don't follow redirects, skipping the URLs that redirect")
+	fs.BoolVar(&o.SaveFinalURL, "save-final-url", o.SaveFinalURL, "save files that were redirected to under the path of the URL they ended up at instead of the one requested; the freshness check then can't find them, so they're downloaded again on every crawl")
+	fs.StringVar(&o.Proxy, "proxy", o.Proxy, "send every request through this proxy, e.g. -proxy http://proxy.corp:3128 or -proxy socks5://127.0.0.1:9050 for Tor, instead of the one HTTP_PROXY, HTTPS_PROXY and NO_PROXY pick")
+	fs.BoolVar(&o.Insecure, "insecure", o.Insecure, "don't verify the certificates of HTTPS servers")
+	fs.StringVar(&o.CACert, "cacert", o.CACert, "PEM file of CA certificate(s) to trust besides the system's, e.g. for internal sites with a private CA")
+	fs.StringVar(&o.Cert, "cert", o.Cert, "PEM client certificate for servers requiring mutual TLS, used with -key")
+	fs.StringVar(&o.Key, "key", o.Key, "PEM private key of the -cert client certificate")
+	fs.Var((*listFlags)(&o.PinSHA256), "pin-sha256", "base64 SHA-256 hash(es) of the public keys (SPKI) servers' certificates must have, as sha256//<hash> or just <hash>; any other certificate aborts the connection, e.g. to detect interception")
+	fs.DurationVar(&o.ConnectTimeout, "connect-timeout", o.ConnectTimeout, "give up connecting to a server, including the TLS handshake, after this long (0 leaves it to the system)")
+	fs.DurationVar(&o.ReadTimeout, "read-timeout", o.ReadTimeout, "give up on a request when the server sends nothing for this long, while waiting for the response or during the body (0 disables)")
+	fs.BoolVar(&o.HTTP3, "http3", o.HTTP3, "fetch https:// URLs over HTTP/3 (QUIC), falling back to HTTP/2 or HTTP/1.1 for the rest of the crawl for hosts a QUIC connection can't be made to within -connect-timeout, or 3s; can't be combined with -proxy")
+	fs.DurationVar(&o.RequestTimeout, "request-timeout", o.RequestTimeout, "give up on any request, body and redirects included, that takes longer than this altogether (0 disables)")
+	fs.DurationVar(&o.StallTimeout, "stall-timeout", o.StallTimeout, "abort and retry a download when no data arrives for this long, e.g. -stall-timeout 30s (0 disables)")
+	fs.Int64Var(&o.PartialBytes, "partial-bytes", o.PartialBytes, "only download the first N bytes of each file, e.g. to inspect file headers; such files are marked partial in the -store-validators metadata and are never resumed (0 downloads everything)")
+	fs.IntVar(&o.NearDupThreshold, "near-dup-threshold", o.NearDupThreshold, "report HTML pages whose text simhash differs from an earlier page's by at most this many bits, e.g. 3 (0 disables)")
+	fs.BoolVar(&o.SkipNearDups, "skip-near-dups", o.SkipNearDups, "with -near-dup-threshold, delete near-duplicate pages and don't follow their links instead of only reporting them")
+	fs.BoolVar(&o.OptimizeImages, "optimize-images", o.OptimizeImages, "re-encode downloaded JPEG and PNG images, replacing them when that makes them smaller; without -keep-original-images or -store-validators they're downloaded again on every run as their size no longer matches")
+	fs.IntVar(&o.JPEGQuality, "jpeg-quality", o.JPEGQuality, "quality from 1 to 100 to re-encode JPEGs at with -optimize-images")
+	fs.BoolVar(&o.KeepOriginalImages, "keep-original-images", o.KeepOriginalImages, "with -optimize-images, keep the downloaded bytes of optimized images next to them with an .orig suffix")
+	fs.Int64Var(&o.StreamParseAbove, "stream-parse-above", o.StreamParseAbove, "scan HTML pages larger than this many bytes for links token by token instead of parsing them whole, bounding memory use")
+	fs.BoolVar(&o.ConvertLinks, "convert-links", o.ConvertLinks, "once the crawl finishes, point links in the HTML pages and stylesheets it downloaded at the local copies of what they link to, and links to anything not mirrored at its absolute URL, so the mirror can be browsed offline; like -root-relative, this makes the pages differ from the server's")
+	fs.BoolVar(&o.RootRelative, "root-relative", o.RootRelative, "rewrite absolute links to the same scheme and host in saved HTML pages to root-relative ones (/path), so a host's directory can be served from a web server's root; the rewritten pages no longer match their Content-Length, so use -store-validators to avoid downloading them again on every run")
+	fs.BoolVar(&o.NoscriptLinks, "noscript-links", o.NoscriptLinks, "also follow links in the <noscript> fallback content of HTML pages")
+	fs.BoolVar(&o.CommentLinks, "comment-links", o.CommentLinks, "also follow URLs and commented out href and src attributes found in HTML comments, which may well be stale")
+	fs.BoolVar(&o.WebFonts, "web-fonts", o.WebFonts, "download the fonts declared in stylesheets' @font-face rules, even from other hosts, and point the stylesheets at the local copies")
+	fs.BoolVar(&o.Raw, "raw", o.Raw, "save exactly the bytes sent by the server, keeping compressed responses compressed on disk; only gzip and zstd are then asked for, not brotli")
+	fs.BoolVar(&o.Raw, "no-decompress", o.Raw, "alias for -raw; both flags set the same option, so either one turns it on or off")
+	fs.UintVar(&o.MaxFiles, "max-files", o.MaxFiles, "stop after starting this many downloads in this crawl, e.g. to sample a large site or cap one whose calendar or pagination links never end (0 is unlimited)")
+	fs.StringVar(&o.Quota, "quota", o.Quota, "stop starting downloads once this many bytes have been downloaded in this crawl, e.g. -quota 5G, letting those in progress finish")
+	fs.StringVar(&o.Budget, "budget", o.Budget, "bytes that may be downloaded per day or week across all crawls sharing -budget-file, e.g. 10GB/day or 50GiB/week; the crawl stops once it's used up, possibly overshooting by the file being downloaded")
+	fs.StringVar(&o.BudgetFile, "budget-file", o.BudgetFile, "file recording the bytes downloaded in the current -budget period, updated after every download")
+	fs.DurationVar(&o.TimeBox, "time-box", o.TimeBox, "stop starting new downloads after crawling for this long, e.g. -time-box 2h, saving where the crawl got to in -state-file (0 is unlimited)")
+	fs.StringVar(&o.ContinueCrawl, "continue-crawl", o.ContinueCrawl, "journal every URL queued and done with to this file as the crawl goes, so that if it's interrupted, running again with the same file carries on where it was instead of starting over; the file is removed once a crawl finishes")
+	fs.StringVar(&o.StateFile, "state-file", o.StateFile, "file to save the queued and seen URLs in when -time-box is up or the crawl is interrupted; a later run with the same file carries on from there, and the file is removed once a crawl finishes")
+	fs.BoolVar(&o.NoRobots, "no-robots", o.NoRobots, "ignore robots.txt, which is otherwise fetched for every host and its Disallow rules and Crawl-delay for the -user-agent's name, mrdriller if unset, (or *) obeyed")
+	fs.DurationVar(&o.Wait, "wait", o.Wait, "wait at least this long between requests to the same host, e.g. -wait 2s")
+	fs.BoolVar(&o.RandomWait, "random-wait", o.RandomWait, "vary -wait between 0.5 and 1.5 times its value for every request")
+	fs.Var((*listFlags)(&o.AcceptTypes), "accept-type", "only save files whose Content-Type matches this, e.g. -accept-type 'image/*' (repeatable); HTML pages are still crawled through for their links")
+	fs.Var((*listFlags)(&o.RejectTypes), "reject-type", "don't save files whose Content-Type matches this, e.g. -reject-type application/octet-stream (repeatable)")
+	fs.StringVar(&o.MaxFilesize, "max-filesize", o.MaxFilesize, "skip files larger than this, e.g. -max-filesize 500M, by their Content-Length or, without one, by stopping the download once it gets larger")
+	fs.StringVar(&o.MinFilesize, "min-filesize", o.MinFilesize, "skip files smaller than this, e.g. -min-filesize 1k to leave out tracking pixels")
+	fs.StringVar(&o.LimitRate, "limit-rate", o.LimitRate, "limit the download speed of all downloads together to this many bytes per second, e.g. -limit-rate 500k")
+	fs.StringVar(&o.Schedule, "schedule", o.Schedule, "time-of-day dependent delay before each request, as comma separated HH:MM-HH:MM=delay rules in local time, e.g. -schedule '09:00-17:00=5s,17:00-09:00=0s'")
+	fs.StringVar(&o.Bearer, "bearer", o.Bearer, "bearer token to authenticate with the start URL's host, sent over its scheme only and to no other host")
+	fs.StringVar(&o.AuthHeaderFile, "auth-header-file", o.AuthHeaderFile, "file of \"Name: value\" header lines, e.g. an API key, to send to the start URL's host over its scheme only, keeping them out of the command line")
+	fs.StringVar(&o.AuthCommand, "auth-command", o.AuthCommand, "shell command printing a bearer token to authenticate with the start URL's host, over its scheme only, run again whenever the token is rejected with a 401")
+	fs.StringVar(&o.LoadCookies, "load-cookies", o.LoadCookies, "load cookies from this Netscape cookies.txt file before crawling")
+	fs.StringVar(&o.SaveCookies, "save-cookies", o.SaveCookies, "save all cookies to this Netscape cookies.txt file once the crawl finishes")
+	fs.BoolVar(&o.NoCookies, "no-cookies", o.NoCookies, "don't send back the cookies sites set during the crawl, which otherwise keeps session-tracked sites working like in a browser; cookies for a public suffix such as co.uk are always refused")
+	fs.StringVar(&o.TypeDir, "type-dir", o.TypeDir, "save files of the given content types under these subdirectories of their host's mirror, as comma separated type=dir pairs, e.g. -type-dir 'image/*=images,text/css=styles'")
+	fs.StringVar(&o.ChecksumManifest, "checksum-manifest", o.ChecksumManifest, "once the crawl finishes, write the SHA-256 of every mirrored file to this file in sha256sum format, e.g. -checksum-manifest SHA256SUMS; files an earlier crawl listed there that this one left alone are kept")
+	fs.BoolVar(&o.NoAtomic, "no-atomic", o.NoAtomic, "write fresh downloads directly to their final path instead of renaming a completed temporary file into place, so a download cut short leaves what was received there")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "./mrdriller [crawl] [-resume] [-depth #] [-include regex1 -include regex2 ...] [-exclude regex1 -exclude regex2 ...] [-refresh regex1 -refresh regex2 ...] [flags] URL [URL ...]")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	// the command line wins over the environment, which wins over -config
+	envURL, err := loadEnv(fs, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read settings from the environment: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 && envURL != "" {
+		args = []string{envURL}
+	}
+
+	if configFile != "" {
+		configURLs, err := loadConfig(configFile, fs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load config: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(args) == 0 {
+			args = configURLs
+		}
+	}
+
+	// the first start URL, if only listed, is the one whose host the crawl
+	// is about, e.g. for sitemaps and -verify-complete
+	var listed []string
+
+	if urlList != "" {
+		listed, err = readURLList(urlList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read -i: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(args) == 0 && len(listed) > 0 {
+			args, listed = listed[:1], listed[1:]
+		}
+	}
+
+	if len(args) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	o.URLs = append(args, listed...)
+
+	level := new(slog.LevelVar)
+
+	switch {
+	case quiet && (verbose || veryVerbose):
+		fmt.Fprintf(os.Stderr, "-q can't be combined with -v or -vv\n")
+		os.Exit(1)
+	case quiet:
+		level.Set(slog.LevelWarn)
+	case veryVerbose:
+		level.Set(crawler.LevelTrace)
+	case verbose:
+		level.Set(slog.LevelDebug)
+	}
+
+	h, err := crawler.NewLogHandler(os.Stderr, logFormat, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -log-format `%s`, %v\n", logFormat, err)
+		os.Exit(1)
+	}
+
+	o.Logger = slog.New(h)
+
+	// bars would get in the way of JSON
+	o.Progress = !noProgress && !quiet && logFormat == "text"
+
+	if mirror {
+		given := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+		if !given["depth"] {
+			o.Depth = math.MaxUint
+		}
+
+		if !given["timestamping"] {
+			o.Timestamping = true
+		}
+
+		if !given["resume"] {
+			o.Resume = true
+		}
+
+		if !given["page-requisites"] {
+			o.PageRequisites = true
+		}
+	}
+
+	c := crawler.New(o)
+
+	// the first SIGINT or SIGTERM ends the crawl cleanly, saving state and
+	// exporting the frontier, a second one kills it
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		cancel(fmt.Errorf("interrupted by %s", sig))
+	}()
+
+	if o.FrontierOut != "" {
+		exportOnSignal(c, o.Logger, o.FrontierOut)
+	}
+
+	if _, err := c.Run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// readURLList reads the start URLs listed in file, or on stdin if it's "-",
+// one per line, skipping blank lines and # comments.
+func readURLList(file string) ([]string, error) {
+	r := io.Reader(os.Stdin)
+
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+		r = f
+	}
+
+	var urls []string
+
+	s := bufio.NewScanner(r)
+
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+
+	return urls, s.Err()
+}
+
+// runServe implements the serve command, making a mirror browsable over HTTP.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	var addr string
+
+	fs.StringVar(&addr, "addr", "localhost:8080", "address to listen on")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "./mrdriller serve [-addr host:port] [DIR]")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s/\n", dir, addr)
+
+	err := http.ListenAndServe(addr, http.FileServer(http.Dir(dir)))
+	fmt.Fprintf(os.Stderr, "could not serve: %v\n", err)
+	os.Exit(1)
+}
+
+// runVerify implements the verify command, checking a mirror against a
+// SHA256SUMS manifest written by -checksum-manifest (or sha256sum).
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+
+	var root string
+
+	fs.StringVar(&root, "dir", ".", "mirror directory the manifest's paths are relative to, or s3://bucket/prefix or gs://bucket/prefix for a crawl's -output")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "./mrdriller verify [-dir DIR|URL] SHA256SUMS")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	stored, err := crawler.OpenStorage(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -dir `%s`: %v\n", root, err)
+		os.Exit(1)
+	}
+
+	failed, err := crawler.Verify(fs.Arg(0), stored, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d file(s) did not match\n", failed)
+		os.Exit(1)
+	}
+}
+
+// runRewrite implements the rewrite command, converting the links in an
+// existing mirror for browsing offline like -convert-links.
+func runRewrite(args []string) {
+	fs := flag.NewFlagSet("rewrite", flag.ExitOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "./mrdriller rewrite [DIR]")
+		fmt.Fprintln(os.Stderr, "point the links in the HTML pages and stylesheets of the mirror in DIR, the current directory by default, at their local copies, as -convert-links does after a crawl")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	converted, err := crawler.ConvertMirror(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not convert links: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Converted links in %d file(s)\n", converted)
+}
+
+// runReport implements the report command, summing up a crawl from its
+// -manifest file.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "./mrdriller report MANIFEST")
+		fmt.Fprintln(os.Stderr, "sum up the crawl a -manifest file records by status, content type and host")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if err := crawler.Report(fs.Arg(0), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// commands maps subcommand names to their implementations, each of which
+// parses its own flags from the remaining arguments.
+var commands = map[string]func(args []string){
+	"crawl":   runCrawl,
+	"serve":   runServe,
+	"rewrite": runRewrite,
+	"verify":  runVerify,
+	"report":  runReport,
+}
+
+// usage lists the commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `usage: ./mrdriller COMMAND [flags] [args]
+
+  crawl    mirror a site, what ./mrdriller [flags] URL [URL ...] does too
+  serve    make a mirror browsable over HTTP
+  rewrite  point the links in a mirror at their local copies
+  verify   check a mirror against a SHA256SUMS manifest
+  report   sum up a crawl from its -manifest file
+
+./mrdriller COMMAND -h lists the flags of a command.`)
+}
+
+// command returns the name of the command args run and the arguments to it:
+// the first argument if it names one, or else crawl if it's a flag or a URL,
+// so that ./mrdriller [flags] URL behaves as it always has. help is returned
+// for -h, and an error for anything else.
+func command(args []string) (string, []string, error) {
+	switch {
+	case len(args) == 0:
+		return "", nil, errors.New("no command given")
+
+	case args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help":
+		return "help", nil, nil
+
+	case commands[args[0]] != nil:
+		return args[0], args[1:], nil
+
+	case strings.HasPrefix(args[0], "-") || strings.Contains(args[0], "://"):
+		return "crawl", args, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown command %s", args[0])
+}
+
+func main() {
+	name, args, err := command(os.Args[1:])
+
+	switch {
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		usage(os.Stderr)
+		os.Exit(2)
+
+	case name == "help":
+		usage(os.Stdout)
+
+	default:
+		commands[name](args)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		name string
+		rest string
+		err  string
+	}{
+		{nil, "", "", "no command given"},
+		{[]string{"frobnicate", "x"}, "", "", "unknown command frobnicate"},
+		{[]string{"example.org"}, "", "", "unknown command example.org"},
+		{[]string{"-h"}, "help", "", ""},
+		{[]string{"--help"}, "help", "", ""},
+		{[]string{"help"}, "help", "", ""},
+
+		// the way it's always been run
+		{[]string{"https://example.org/"}, "crawl", "https://example.org/", ""},
+		{[]string{"-depth", "2", "https://example.org/"}, "crawl", "-depth 2 https://example.org/", ""},
+
+		{[]string{"crawl", "-depth", "2", "https://example.org/"}, "crawl", "-depth 2 https://example.org/", ""},
+		{[]string{"crawl", "-h"}, "crawl", "-h", ""},
+		{[]string{"serve", "-addr", ":8080", "mirror"}, "serve", "-addr :8080 mirror", ""},
+		{[]string{"rewrite", "mirror"}, "rewrite", "mirror", ""},
+		{[]string{"verify", "SHA256SUMS"}, "verify", "SHA256SUMS", ""},
+		{[]string{"report", "manifest.jsonl"}, "report", "manifest.jsonl", ""},
+	} {
+		name, rest, err := command(c.args)
+
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("command(%q) = %s, %v, want error %q", c.args, name, err, c.err)
+			}
+
+			continue
+		}
+
+		if err != nil || name != c.name || strings.Join(rest, " ") != c.rest {
+			t.Errorf("command(%q) = %s %q, %v, want %s %q", c.args, name, rest, err, c.name, c.rest)
+		}
+	}
+
+	// every command listed has an implementation
+	for name := range commands {
+		if !strings.Contains(usageText(), "\n  "+name+" ") {
+			t.Errorf("%s missing from the usage", name)
+		}
+	}
+}
+
+// usageText is what usage writes.
+func usageText() string {
+	var b strings.Builder
+	usage(&b)
+
+	return b.String()
+}
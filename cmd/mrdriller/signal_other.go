@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"log/slog"
+
+	"mrdriller.tld/mrdriller/crawler"
+)
+
+// exportOnSignal does nothing, as there's no SIGUSR1 to export the frontier
+// on; it's still exported when the crawl ends.
+func exportOnSignal(c *crawler.Crawler, logger *slog.Logger, file string) {}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mrdriller.tld/mrdriller/crawler"
+)
+
+// exportOnSignal exports the frontier of c's crawl to file on SIGUSR1.
+func exportOnSignal(c *crawler.Crawler, logger *slog.Logger, file string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for range signals {
+			if err := c.ExportFrontier(); err != nil {
+				logger.Warn("could not export frontier", "err", err)
+			} else {
+				logger.Info("Exported frontier", "file", file)
+			}
+		}
+	}()
+}
@@ -0,0 +1,290 @@
+package crawler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var unsafeArchiveChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// archiveName turns a host directory name such as "https:example.org:8080"
+// into something safe to use as a file name, e.g. "https_example.org_8080".
+func archiveName(hostDir string) string {
+	return unsafeArchiveChars.ReplaceAllString(hostDir, "_")
+}
+
+// writeTar archives everything under dir into a tar file at dest, with
+// member names relative to dir. Temporary files left behind by interrupted
+// atomic downloads are not included.
+func writeTar(dir string, dest string) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if strings.HasPrefix(info.Name(), ".") && strings.HasSuffix(info.Name(), ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer in.Close()
+
+		_, err = io.Copy(tw, in)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// outputArchive is the -output-archive file downloads are moved into as
+// they complete, a tar file, gzipped or not, or a zip file depending on its
+// name, so a mirror never has to exist on disk as lots of small files.
+type outputArchive struct {
+	f  *os.File
+	gz *gzip.Writer
+	tw *tar.Writer
+	zw *zip.Writer
+}
+
+func createOutputArchive(file string) (*outputArchive, error) {
+	name := strings.ToLower(file)
+
+	tarball := strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+	if !tarball && !strings.HasSuffix(name, ".tar") && !strings.HasSuffix(name, ".zip") {
+		return nil, fmt.Errorf("%s isn't named .tar, .tar.gz, .tgz or .zip", file)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &outputArchive{f: f}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		a.zw = zip.NewWriter(f)
+	case tarball:
+		a.gz = gzip.NewWriter(f)
+		a.tw = tar.NewWriter(a.gz)
+	default:
+		a.tw = tar.NewWriter(f)
+	}
+
+	return a, nil
+}
+
+// add moves the file at path into the archive as name, removing the
+// directories it leaves empty up to root, and returns its SHA-256.
+func (a *outputArchive) add(path, name, root string) ([]byte, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	name = filepath.ToSlash(name)
+
+	var w io.Writer
+
+	if a.zw != nil {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return nil, err
+		}
+
+		hdr.Name, hdr.Method = name, zip.Deflate
+
+		if w, err = a.zw.CreateHeader(hdr); err != nil {
+			return nil, err
+		}
+	} else {
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return nil, err
+		}
+
+		hdr.Name = name
+
+		if err = a.tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+
+		w = a.tw
+	}
+
+	h := sha256.New()
+
+	if _, err = io.Copy(io.MultiWriter(w, h), in); err != nil {
+		return nil, err
+	}
+
+	in.Close()
+
+	if err = removeMoved(path, root); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+func (a *outputArchive) close() error {
+	var err error
+
+	if a.zw != nil {
+		err = a.zw.Close()
+	} else {
+		err = a.tw.Close()
+
+		if a.gz != nil && err == nil {
+			err = a.gz.Close()
+		}
+	}
+
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// hostArchives writes each host's mirror as a separate tar file into dir,
+// for ArchivePerHost, as soon as the crawl is done with the host: once no
+// URL of it is queued or being downloaded. A host more of which turns up
+// later is written again once that's done with too.
+type hostArchives struct {
+	dir string
+
+	// queued counts the URLs in the queue by host directory
+	queued map[string]int
+
+	// changed are the host directories saved to since they were written
+	changed map[string]bool
+}
+
+func newHostArchives(dir string) (*hostArchives, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create archive directory %s: %w", dir, err)
+	}
+
+	return &hostArchives{dir: dir, queued: map[string]int{}, changed: map[string]bool{}}, nil
+}
+
+// hostDirOf returns the mirror directory of the host of URL u, laid out as
+// "https:my.web.site:80".
+func hostDirOf(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	return pu.Scheme + ":" + strings.ToLower(pu.Host)
+}
+
+// count starts counting the queue over from queue.
+func (a *hostArchives) count(queue []item) {
+	if a == nil {
+		return
+	}
+
+	clear(a.queued)
+
+	for _, i := range queue {
+		a.queued[hostDirOf(i.url)]++
+	}
+}
+
+// add counts n more of u's host in the queue, or fewer if n is negative.
+func (a *hostArchives) add(u string, n int) {
+	if a != nil {
+		a.queued[hostDirOf(u)] += n
+	}
+}
+
+// saved records that a file was saved under hostDir, so it's archived.
+func (a *hostArchives) saved(hostDir string) {
+	if a != nil {
+		a.changed[hostDir] = true
+	}
+}
+
+// write archives the mirror of every host saved to since it was last
+// written for which done returns true, from under root.
+func (a *hostArchives) write(root string, done func(hostDir string) bool, log *slog.Logger) {
+	if a == nil {
+		return
+	}
+
+	for hostDir := range a.changed {
+		if a.queued[hostDir] > 0 || !done(hostDir) {
+			continue
+		}
+
+		delete(a.changed, hostDir)
+
+		dest := filepath.Join(a.dir, archiveName(hostDir)+".tar")
+
+		if err := writeTar(filepath.Join(root, hostDir), dest); err != nil {
+			log.Warn("could not archive", "dir", hostDir, "err", err)
+			continue
+		}
+
+		log.Info("Archived", "dir", hostDir, "archive", dest)
+	}
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tarMembers lists the names of the files in the tar file at file.
+func tarMembers(t *testing.T, file string) []string {
+	t.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var names []string
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestArchivePerHostAsDrained(t *testing.T) {
+	a := newSite(t, map[string]string{
+		"/":       `<a href="/x.html">x</a>`,
+		"/x.html": "x",
+	})
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	b := chainSite(t, 4, 100*time.Millisecond, hits, &mu)
+
+	o := testOptions(t, a.URL+"/")
+	o.URLs = append(o.URLs, b.URL+"/0.html")
+	o.NoRobots = true
+	o.ArchivePerHost = filepath.Join(t.TempDir(), "archives")
+
+	archiveOf := func(u string) string {
+		return filepath.Join(o.ArchivePerHost, archiveName(hostDirOf(u))+".tar")
+	}
+
+	// by the time b's last page comes, a is long done with
+	var early bool
+
+	o.Decide = func(url string, header http.Header) bool {
+		if url == b.URL+"/3.html" {
+			_, err := os.Stat(archiveOf(a.URL))
+			early = err == nil
+		}
+
+		return true
+	}
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !early {
+		t.Error("the first host's archive wasn't written as soon as it was done with")
+	}
+
+	for _, c := range []struct {
+		url  string
+		want []string
+	}{
+		{a.URL, []string{"index.html", "x.html"}},
+		{b.URL, []string{"0.html", "1.html", "2.html", "3.html"}},
+	} {
+		if got := tarMembers(t, archiveOf(c.url)); strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Errorf("archive of %s has %v, want %v", c.url, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package crawler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// tokenTransport authenticates requests to the origin of scheme and host
+// with a bearer token printed by an external command. The token is cached
+// and the command run again whenever the server rejects it with a 401, after
+// which the request is retried once with the fresh token. Requests to any
+// other origin, such as those redirected elsewhere or to plain http on the
+// same host, never see the token.
+type tokenTransport struct {
+	base    http.RoundTripper
+	command string
+	scheme  string
+	host    string
+
+	mu    sync.Mutex
+	token string
+}
+
+// refresh runs the command for a new token, unless another request already
+// replaced the stale one in the meantime.
+func (t *tokenTransport) refresh(stale string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != stale {
+		return t.token, nil
+	}
+
+	out, err := exec.Command("sh", "-c", t.command).Output()
+	if err != nil {
+		return "", fmt.Errorf("auth command failed: %w", err)
+	}
+
+	t.token = strings.TrimSpace(string(out))
+
+	return t.token, nil
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !sameOrigin(req.URL, t.scheme, t.host) {
+		return t.base.RoundTrip(req)
+	}
+
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+
+	var err error
+
+	if token == "" {
+		if token, err = t.refresh(""); err != nil {
+			return nil, err
+		}
+	}
+
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := t.base.RoundTrip(authed)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil {
+		return resp, err
+	}
+
+	resp.Body.Close()
+
+	if token, err = t.refresh(token); err != nil {
+		return nil, err
+	}
+
+	authed = req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+
+	return t.base.RoundTrip(authed)
+}
+
+// hostHeaderTransport adds credentials given with -bearer or
+// -auth-header-file to requests to the origin of scheme and host only, so
+// they don't leak to other sites a link or redirect leads to, or go out in
+// the clear when a page links to the http version of an https site.
+type hostHeaderTransport struct {
+	base   http.RoundTripper
+	scheme string
+	host   string
+	header http.Header
+}
+
+func (t *hostHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !sameOrigin(req.URL, t.scheme, t.host) {
+		return t.base.RoundTrip(req)
+	}
+
+	authed := req.Clone(req.Context())
+
+	for k, v := range t.header {
+		authed.Header[k] = v
+	}
+
+	return t.base.RoundTrip(authed)
+}
+
+// sameOrigin reports whether u is on the origin of scheme and host, which
+// is only so over the same scheme, with the port left out meaning the
+// scheme's default.
+func sameOrigin(u *url.URL, scheme string, host string) bool {
+	return strings.EqualFold(u.Scheme, scheme) && strings.EqualFold(hostPort(scheme, u.Host), hostPort(scheme, host))
+}
+
+// hostPort returns host with the default port of scheme if it has none.
+func hostPort(scheme string, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	port := "80"
+	if strings.EqualFold(scheme, "https") {
+		port = "443"
+	}
+
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// readHeaderFile reads "Name: value" lines from file, skipping blank lines
+// and # comments.
+func readHeaderFile(file string) (http.Header, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%s:%d: expected Name: value", file, n+1)
+		}
+
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	return header, nil
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+)
+
+// recordTransport answers every request with a 200, recording the
+// Authorization header it was sent with by URL.
+type recordTransport map[string]string
+
+func (rt recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt[req.URL.String()] = req.Header.Get("Authorization")
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestSameOrigin(t *testing.T) {
+	for _, c := range []struct {
+		url          string
+		scheme, host string
+		want         bool
+	}{
+		{"https://example.org/a", "https", "example.org", true},
+		{"https://EXAMPLE.org/a", "https", "example.org", true},
+		{"https://example.org:443/a", "https", "example.org", true},
+		{"https://example.org/a", "https", "example.org:443", true},
+		{"http://example.org:80/a", "http", "example.org", true},
+		{"https://[::1]/a", "https", "[::1]:443", true},
+
+		{"http://example.org/a", "https", "example.org", false},
+		{"https://example.org/a", "http", "example.org", false},
+		{"https://example.org:8443/a", "https", "example.org", false},
+		{"https://www.example.org/a", "https", "example.org", false},
+		{"https://example.org.evil.com/a", "https", "example.org", false},
+	} {
+		u := mustParse(t, c.url)
+
+		if got := sameOrigin(u, c.scheme, c.host); got != c.want {
+			t.Errorf("sameOrigin(%s, %s, %s) = %v, want %v", c.url, c.scheme, c.host, got, c.want)
+		}
+	}
+}
+
+func TestTokenTransportOrigin(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the auth command with")
+	}
+
+	rt := recordTransport{}
+	tt := &tokenTransport{base: rt, command: "echo secret", scheme: "https", host: "example.org"}
+
+	for _, u := range []string{
+		"https://example.org/a",
+		"http://example.org/a",
+		"https://example.org:8443/a",
+		"https://cdn.example.org/a",
+	} {
+		req, _ := http.NewRequest("GET", u, nil)
+
+		resp, err := tt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if req.Header.Get("Authorization") != "" {
+			t.Errorf("%s: request passed in was changed", u)
+		}
+	}
+
+	want := map[string]string{
+		"https://example.org/a":      "Bearer secret",
+		"http://example.org/a":       "",
+		"https://example.org:8443/a": "",
+		"https://cdn.example.org/a":  "",
+	}
+
+	for u, auth := range want {
+		if rt[u] != auth {
+			t.Errorf("%s sent Authorization %q, want %q", u, rt[u], auth)
+		}
+	}
+}
+
+func TestTokenTransportRefresh(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the auth command with")
+	}
+
+	var seen []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer s.Close()
+
+	u := mustParse(t, s.URL)
+	tt := &tokenTransport{base: http.DefaultTransport, command: "echo fresh", scheme: u.Scheme, host: u.Host, token: "stale"}
+
+	req, _ := http.NewRequest("GET", s.URL+"/", nil)
+
+	resp, err := tt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(seen) != 2 || seen[0] != "Bearer stale" {
+		t.Errorf("got %d after sending %v, want a retry with the fresh token", resp.StatusCode, seen)
+	}
+}
+
+func TestHostHeaderTransportOrigin(t *testing.T) {
+	rt := recordTransport{}
+	ht := &hostHeaderTransport{rt, "https", "example.org", http.Header{"Authorization": {"Bearer secret"}}}
+
+	want := map[string]string{
+		"https://example.org/a":      "Bearer secret",
+		"https://example.org:443/b":  "Bearer secret",
+		"http://example.org/a":       "",
+		"https://example.org:8443/a": "",
+		"https://evil.example/a":     "",
+	}
+
+	for u := range want {
+		req, _ := http.NewRequest("GET", u, nil)
+
+		resp, err := ht.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+	}
+
+	for u, auth := range want {
+		if rt[u] != auth {
+			t.Errorf("%s sent Authorization %q, want %q", u, rt[u], auth)
+		}
+	}
+}
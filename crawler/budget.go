@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeUnits are the suffixes parseSize understands, longest first so "KiB"
+// isn't read as "B".
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseSize parses a number of bytes with an optional unit, e.g. "1500",
+// "10GB" (decimal) or "512MiB" (binary). Bare K, M, G and T are binary.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	mult := int64(1)
+
+	for _, u := range sizeUnits {
+		if len(s) > len(u.suffix) && strings.EqualFold(s[len(s)-len(u.suffix):], u.suffix) {
+			s, mult = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size `%s`", s)
+	}
+
+	return int64(n * float64(mult)), nil
+}
+
+// budget is a limit on the bytes downloaded per day or week.
+type budget struct {
+	limit  int64
+	period string
+}
+
+// parseBudget parses a size per period, e.g. "10GB/day" or "50GiB/week".
+func parseBudget(s string) (budget, error) {
+	size, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return budget{}, fmt.Errorf("budget `%s` is not of the form size/day or size/week", s)
+	}
+
+	limit, err := parseSize(size)
+	if err != nil {
+		return budget{}, err
+	}
+
+	period = strings.ToLower(strings.TrimSpace(period))
+	if period != "day" && period != "week" {
+		return budget{}, fmt.Errorf("budget period `%s` must be day or week", period)
+	}
+
+	return budget{limit, period}, nil
+}
+
+// periodStart is the local midnight starting the day, or the Monday
+// starting the week, that t falls in.
+func (b budget) periodStart(t time.Time) time.Time {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	if b.period == "week" {
+		// days since Monday
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	}
+
+	return start
+}
+
+// ledger is the usage recorded in a -budget-file, shared by every crawl
+// using the same file.
+type ledger struct {
+	file   string
+	budget budget
+
+	Start time.Time `json:"period_start"`
+	Bytes int64     `json:"bytes"`
+}
+
+// loadLedger reads the ledger in file, which needn't exist yet.
+func loadLedger(file string, b budget) (*ledger, error) {
+	l := &ledger{file: file, budget: b}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", file, err)
+	}
+
+	return l, nil
+}
+
+// rollover starts a new period if t is past the recorded one.
+func (l *ledger) rollover(t time.Time) {
+	if start := l.budget.periodStart(t); !l.Start.Equal(start) {
+		l.Start = start
+		l.Bytes = 0
+	}
+}
+
+// exhausted reports whether the budget for the period t is in is used up.
+func (l *ledger) exhausted(t time.Time) bool {
+	l.rollover(t)
+	return l.Bytes >= l.budget.limit
+}
+
+// add records n more bytes downloaded at t and saves the ledger.
+func (l *ledger) add(t time.Time, n int64) error {
+	l.rollover(t)
+	l.Bytes += n
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(l.file), "."+filepath.Base(l.file)+".tmp")
+
+	if err = os.WriteFile(tmp, append(data, '\n'), 0666); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.file)
+}
@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBudget(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		limit  int64
+		period string
+		err    bool
+	}{
+		{"10GB/day", 10e9, "day", false},
+		{"50GiB/week", 50 << 30, "week", false},
+		{" 1.5 MB / Day ", 1.5e6, "day", false},
+		{"100", 0, "", true},
+		{"10GB/month", 0, "", true},
+		{"lots/day", 0, "", true},
+	} {
+		b, err := parseBudget(c.in)
+		if (err != nil) != c.err || err == nil && (b.limit != c.limit || b.period != c.period) {
+			t.Errorf("parseBudget(%q) = %+v, %v", c.in, b, err)
+		}
+	}
+}
+
+func TestBudgetPeriodStart(t *testing.T) {
+	// a Thursday afternoon
+	at := time.Date(2024, 5, 16, 15, 30, 0, 0, time.UTC)
+
+	if got, want := (budget{period: "day"}).periodStart(at), time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("day starts %v, want %v", got, want)
+	}
+
+	if got, want := (budget{period: "week"}).periodStart(at), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("week starts %v, want %v", got, want)
+	}
+
+	// Sunday is the end of the week, not the start
+	sunday := time.Date(2024, 5, 19, 23, 0, 0, 0, time.UTC)
+
+	if got, want := (budget{period: "week"}).periodStart(sunday), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("week of a Sunday starts %v, want %v", got, want)
+	}
+}
+
+// writeLedger records spent bytes in file for the period starting at start.
+func writeLedger(t *testing.T, file string, start time.Time, spent int64) {
+	t.Helper()
+
+	data, err := json.Marshal(ledger{Start: start, Bytes: spent})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(file, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBudgetNearlyExhausted(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/b.html">b</a>` + strings.Repeat(" ", 100),
+		"/a.html": strings.Repeat("a", 100),
+		"/b.html": strings.Repeat("b", 100),
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.Budget = "1000B/day"
+	o.BudgetFile = filepath.Join(t.TempDir(), "budget.json")
+
+	today := budget{period: "day"}.periodStart(time.Now())
+
+	// 50 bytes left, so the first page goes over and nothing after it starts
+	writeLedger(t, o.BudgetFile, today, 950)
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != 1 || res.Queued != 2 {
+		t.Errorf("fetched %d with %d left queued, want 1 and 2", res.Fetched, res.Queued)
+	}
+
+	l, err := loadLedger(o.BudgetFile, budget{1000, "day"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := 950 + res.Bytes; l.Bytes != want || !l.Start.Equal(today) {
+		t.Errorf("ledger has %d bytes from %v, want %d from %v", l.Bytes, l.Start, want, today)
+	}
+
+	// and the next run refuses to start
+	if _, err = New(o).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "used up") {
+		t.Errorf("got %v, want the budget used up", err)
+	}
+
+	// until the day is over
+	writeLedger(t, o.BudgetFile, today.AddDate(0, 0, -1), 1000)
+
+	if res, err = New(o).Run(context.Background()); err != nil || res.Queued != 0 {
+		t.Errorf("got %+v, %v, want the crawl finished in a new day", res, err)
+	}
+}
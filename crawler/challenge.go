@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultChallengeMarkers match the interstitial pages of common bot
+// protection services, used by -detect-challenges unless -challenge-marker
+// gives others.
+var defaultChallengeMarkers = []string{
+	`/cdn-cgi/challenge-platform/`,
+	`<title>Just a moment\.\.\.</title>`,
+	`<title>Attention Required! \| Cloudflare</title>`,
+	`_Incapsula_Resource`,
+	`id="px-captcha"`,
+	`<title>DDoS-Guard</title>`,
+	`/_sec/cp_challenge/`,
+}
+
+// challengePeek is how much of a response is looked at for markers; the
+// interstitials are small and put their markers near the top.
+const challengePeek = 64 << 10
+
+// peekedBody is a response body that has had its start buffered.
+type peekedBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// isChallenge reports whether the response with the given header and
+// body start looks like a bot challenge rather than the real content.
+func (r *run) isChallenge(header http.Header, start []byte) bool {
+	if strings.EqualFold(header.Get("Cf-Mitigated"), "challenge") {
+		return true
+	}
+
+	// with -raw the body is still compressed, and only partly here
+	if zr, err := decompress(header.Get("Content-Encoding"), bytes.NewReader(start)); err != nil {
+		return false
+	} else if zr != nil {
+		start, _ = io.ReadAll(io.LimitReader(zr, challengePeek))
+		zr.Close()
+	}
+
+	for _, re := range r.challengeMarkers {
+		if re.Match(start) {
+			return true
+		}
+	}
+
+	return false
+}
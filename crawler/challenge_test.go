@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// challengePage is a trimmed down Cloudflare interstitial.
+const challengePage = `<!DOCTYPE html><html lang="en-US"><head><title>Just a moment...</title>
+<meta http-equiv="refresh" content="390"></head><body><noscript>Enable JavaScript and cookies to continue</noscript>
+<script>(function(){window._cf_chl_opt={cvId: '3'};var a=document.createElement('script');
+a.src='/cdn-cgi/challenge-platform/h/b/orchestrate/chl_page/v1?ray=8a1b2c3d4e5f6789';document.getElementsByTagName('head')[0].appendChild(a);}());</script>
+</body></html>`
+
+func TestChallenges(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/guarded.html">guarded</a> <a href="/header.html">header</a> <a href="/puzzle.html">puzzle</a> <a href="/flaky.html">flaky</a>`)
+		case "/guarded.html":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, challengePage)
+		case "/header.html":
+			w.Header().Set("Cf-Mitigated", "challenge")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<p>blocked</p>")
+		case "/puzzle.html":
+			fmt.Fprint(w, "<p>Please solve our puzzle to prove you're human</p>")
+		case "/flaky.html":
+			// the challenge is only put up the first time
+			if n == 1 {
+				fmt.Fprint(w, challengePage)
+				return
+			}
+
+			fmt.Fprint(w, "<p>the real page</p>")
+		}
+	}))
+	defer s.Close()
+
+	for _, c := range []struct {
+		name    string
+		set     func(*Options)
+		saved   []string
+		skipped int
+	}{
+		{"off", func(o *Options) {}, []string{"/", "/puzzle.html", "/flaky.html"}, 0},
+		{"default markers", func(o *Options) { o.DetectChallenges = true }, []string{"/", "/puzzle.html"}, 3},
+		{"custom markers", func(o *Options) { o.ChallengeMarkers = []string{`solve our puzzle`} }, []string{"/", "/flaky.html"}, 2},
+		{"wait", func(o *Options) { o.DetectChallenges = true; o.ChallengeWait = time.Millisecond }, []string{"/", "/puzzle.html", "/flaky.html"}, 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			mu.Lock()
+			clear(hits)
+			mu.Unlock()
+
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			c.set(&o)
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Skipped["challenge"] != c.skipped {
+				t.Errorf("skipped %v, want %d challenges", res.Skipped, c.skipped)
+			}
+
+			saved := map[string]bool{}
+			for _, p := range c.saved {
+				saved[p] = true
+			}
+
+			for _, p := range []string{"/", "/guarded.html", "/header.html", "/puzzle.html", "/flaky.html"} {
+				_, err := os.Stat(mirrored(t, o, s.URL+p))
+				if got := err == nil; got != saved[p] {
+					t.Errorf("%s saved %v, want %v", p, got, saved[p])
+				}
+			}
+		})
+	}
+}
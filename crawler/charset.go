@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// metaCharset matches the charset of a <meta charset> or of a <meta
+// http-equiv="Content-Type"> whose content has one.
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.-]+)`)
+
+// htmlCharset works out the label of the character encoding of an HTML
+// document the way browsers do, from a byte order mark at the start of head,
+// then the charset of its Content-Type, then a <meta> in head, its first
+// kilobyte. It returns "" if nothing says.
+func htmlCharset(contentType string, head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xef\xbb\xbf")):
+		return "utf-8"
+	case bytes.HasPrefix(head, []byte("\xff\xfe")):
+		return "utf-16le"
+	case bytes.HasPrefix(head, []byte("\xfe\xff")):
+		return "utf-16be"
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return strings.ToLower(strings.TrimSpace(params["charset"]))
+	}
+
+	if m := metaCharset.FindSubmatch(head); m != nil {
+		label := strings.ToLower(string(m[1]))
+
+		// a page readable enough to find its <meta> in isn't UTF-16
+		if _, name := charset.Lookup(label); strings.HasPrefix(name, "utf-16") {
+			return "utf-8"
+		}
+
+		return label
+	}
+
+	return ""
+}
+
+// charsetReader returns r decoded from the encoding label names into UTF-8,
+// and false if label isn't one of the encodings of the WHATWG Encoding
+// Standard browsers know.
+func charsetReader(label string, r io.Reader) (io.Reader, bool) {
+	e, name := charset.Lookup(label)
+	if e == nil {
+		return r, false
+	}
+
+	if name == "utf-8" {
+		return r, true
+	}
+
+	// a byte order mark isn't part of the text
+	return transform.NewReader(r, unicode.BOMOverride(e.NewDecoder())), true
+}
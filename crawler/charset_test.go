@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestCharsetReader(t *testing.T) {
+	for _, c := range []struct {
+		contentType string
+		page        string
+		enc         encoding.Encoding
+	}{
+		{"text/html; charset=Shift_JIS", `<a href="/日本語.html">`, japanese.ShiftJIS},
+		{"text/html", `<meta charset="shift_jis"><a href="/日本語.html">`, japanese.ShiftJIS},
+		{"text/html", `<meta http-equiv="Content-Type" content="text/html; charset=EUC-JP"><a href="/日本語.html">`, japanese.EUCJP},
+		{"text/html; charset=gbk", `<a href="/中文.html">`, simplifiedchinese.GBK},
+		{"text/html; charset=euc-kr", `<a href="/한국어.html">`, korean.EUCKR},
+		{"text/html; charset=iso-8859-1", `<a href="/café€.html">`, charmap.Windows1252},
+		{"text/html", `<a href="/café.html">`, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)},
+		{"text/html", `<a href="/café.html">`, unicode.UTF16(unicode.BigEndian, unicode.UseBOM)},
+	} {
+		encoded, err := c.enc.NewEncoder().String(c.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		label := htmlCharset(c.contentType, []byte(encoded))
+
+		r, ok := charsetReader(label, strings.NewReader(encoded))
+		if !ok {
+			t.Errorf("%s: can't decode %q", c.page, label)
+			continue
+		}
+
+		b, _ := io.ReadAll(r)
+		if string(b) != c.page {
+			t.Errorf("%s as %s decoded to %q, want %q", c.contentType, label, b, c.page)
+		}
+	}
+
+	if _, ok := charsetReader("x-unheard-of", strings.NewReader("")); ok {
+		t.Error("decoded an unknown encoding")
+	}
+}
+
+func TestShiftJISLinks(t *testing.T) {
+	page, err := japanese.ShiftJIS.NewEncoder().String(`<html><body><a href="/日本語.html">日本語</a></body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=Shift_JIS")
+			io.WriteString(w, page)
+		case "/日本語.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, "ok")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != 2 {
+		t.Errorf("fetched %d, want the page and the one its Shift_JIS link leads to", res.Fetched)
+	}
+
+	if _, err := os.Stat(mirrored(t, o, s.URL+"/日本語.html")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,176 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hashFile returns the SHA-256 of the file at path.
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// writeChecksums writes sums, keyed by absolute path, to file in the format
+// of sha256sum(1) with paths relative to root, so the mirror can be checked
+// with `sha256sum -c` from root. Files whose sum is nil, because they were
+// already up to date and so not downloaded, are hashed from where they're
+// stored. The files an earlier crawl listed in file and this one didn't
+// come across are kept, as long as they're still stored.
+func writeChecksums(file string, root string, sums map[string][]byte, stored Storage) error {
+	lines := map[string][]byte{}
+
+	old, err := readChecksums(file)
+	if err != nil {
+		return err
+	}
+
+	for rel, sum := range old {
+		if _, err := stored.Stat(rel); err == nil {
+			lines[rel] = sum
+		}
+	}
+
+	for path, sum := range sums {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if sum == nil {
+			sum, err = hashStored(stored, rel)
+			if err != nil {
+				return err
+			}
+		}
+
+		lines[rel] = sum
+	}
+
+	rels := make([]string, 0, len(lines))
+	for rel := range lines {
+		rels = append(rels, rel)
+	}
+
+	sort.Strings(rels)
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	for _, rel := range rels {
+		fmt.Fprintf(w, "%x  %s\n", lines[rel], rel)
+	}
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// readChecksums reads the sums in a manifest written by writeChecksums, by
+// path, skipping lines it can't make sense of. There are none if the file
+// doesn't exist.
+func readChecksums(file string) (map[string][]byte, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	sums := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		sum, rel, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			continue
+		}
+
+		if b, err := hex.DecodeString(sum); err == nil {
+			sums[rel] = b
+		}
+	}
+
+	return sums, scanner.Err()
+}
+
+// Verify checks the mirror in stored against a SHA256SUMS manifest written
+// by -checksum-manifest (or sha256sum), writing "path: OK" or "path: FAILED"
+// for every file it lists to w, and returns how many didn't match.
+func Verify(manifest string, stored Storage, w io.Writer) (int, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return 0, fmt.Errorf("could not open manifest: %w", err)
+	}
+
+	defer f.Close()
+
+	failed := 0
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		want, rel, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			continue
+		}
+
+		wantSum, err := hex.DecodeString(want)
+		if err != nil {
+			fmt.Fprintf(w, "%s: improperly formatted line\n", rel)
+			continue
+		}
+
+		sum, err := hashStored(stored, rel)
+
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "%s: FAILED open or read\n", rel)
+			failed++
+		case !bytes.Equal(sum, wantSum):
+			fmt.Fprintf(w, "%s: FAILED\n", rel)
+			failed++
+		default:
+			fmt.Fprintf(w, "%s: OK\n", rel)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return failed, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	return failed, nil
+}
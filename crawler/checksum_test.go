@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksumManifestMerged(t *testing.T) {
+	pages := map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/b.html">b</a> <a href="/c.html">c</a>`,
+		"/a.html": "a",
+		"/b.html": "b",
+		"/c.html": "c",
+	}
+
+	s := newSite(t, pages)
+
+	o := testOptions(t, s.URL+"/")
+	o.ChecksumManifest = filepath.Join(t.TempDir(), "SHA256SUMS")
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next crawl leaves b.html out, finds a.html changed, and c.html is
+	// gone from the mirror
+	pages["/a.html"] = "a, changed"
+	o.Exclude = []string{`/b\.html$`, `/c\.html$`}
+
+	if err := os.Remove(mirrored(t, o, s.URL+"/c.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(o.ChecksumManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostDir := "http:" + strings.TrimPrefix(s.URL, "http://")
+
+	want := ""
+	for _, f := range []struct{ path, content string }{
+		{"/a.html", "a, changed"},
+		{"/b.html", "b"},
+		{"/index.html", pages["/"]},
+	} {
+		want += fmt.Sprintf("%x  %s%s\n", sha256.Sum256([]byte(f.content)), hostDir, f.path)
+	}
+
+	if string(b) != want {
+		t.Errorf("got manifest\n%s\nwant\n%s", b, want)
+	}
+
+	failed, err := Verify(o.ChecksumManifest, dirStorage(o.Dir), io.Discard)
+	if err != nil || failed != 0 {
+		t.Errorf("verify failed %d: %v", failed, err)
+	}
+}
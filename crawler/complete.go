@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pageURL works out the URL a file under root was downloaded from, given
+// the "scheme:host" directory it's in, undoing urlToPath.
+func pageURL(root string, hostDir string, path string) (string, error) {
+	rel, err := filepath.Rel(filepath.Join(root, hostDir), path)
+	if err != nil {
+		return "", err
+	}
+
+	scheme, host, _ := strings.Cut(hostDir, ":")
+	p := "/" + filepath.ToSlash(rel)
+
+	if q := strings.Index(p, "?"); q >= 0 {
+		p, rel = p[:q], p[q+1:]
+	} else {
+		rel = ""
+	}
+
+	if d, ok := strings.CutSuffix(p, "/index.html"); ok {
+		p = d + "/"
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: p, RawQuery: rel}
+
+	return u.String(), nil
+}
+
+// isHTMLFile sniffs whether the file at path looks like HTML.
+func isHTMLFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	b := make([]byte, 512)
+	n, _ := f.Read(b)
+
+	return strings.HasPrefix(http.DetectContentType(b[:n]), "text/html")
+}
+
+// missingLinks rereads every HTML page saved under the hostDir directory
+// of root and returns the links in them, as accepted by inScope, whose
+// files aren't in the mirror, each with the page linking to it. Files moved
+// by -type-dir are looked for in each of dirs. Pages that can't be parsed
+// are warned about to logger.
+func missingLinks(root string, hostDir string, dirs typeDirs, inScope func(u *url.URL) bool, logger *slog.Logger) ([]string, error) {
+	var missing []string
+	reported := map[string]bool{}
+
+	exists := func(u *url.URL) bool {
+		p, err := urlToPath(u.String())
+		if err != nil {
+			return false
+		}
+
+		target := filepath.Join(root, u.Scheme+":"+strings.ToLower(u.Host))
+
+		if _, err = os.Stat(filepath.Join(target, p)); err == nil {
+			return true
+		}
+
+		for _, d := range dirs {
+			if _, err = os.Stat(filepath.Join(target, d.dir, p)); err == nil {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	err := filepath.WalkDir(filepath.Join(root, hostDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// temporary files of interrupted downloads and the like
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || !isHTMLFile(path) {
+			return nil
+		}
+
+		page, err := pageURL(root, hostDir, path)
+		if err != nil {
+			return err
+		}
+
+		base, err := url.Parse(page)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		var res result
+		err = streamLinks(bufio.NewReader(f), &res)
+		f.Close()
+
+		if err != nil {
+			logger.Warn("could not parse to verify its links", "path", path, "err", err)
+			return nil
+		}
+
+		for _, l := range res.links {
+			u, err := base.Parse(l.url)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+
+			u.Fragment = ""
+			u.RawFragment = ""
+
+			if !inScope(u) || reported[u.String()] || exists(u) {
+				continue
+			}
+
+			reported[u.String()] = true
+			missing = append(missing, fmt.Sprintf("%s (linked from %s)", u, page))
+		}
+
+		return nil
+	})
+
+	sort.Strings(missing)
+
+	return missing, err
+}
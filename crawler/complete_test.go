@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageURL(t *testing.T) {
+	root := t.TempDir()
+
+	for _, c := range []struct {
+		path string
+		want string
+	}{
+		{"index.html", "https://example.org/"},
+		{"docs/index.html", "https://example.org/docs/"},
+		{"docs/a.html", "https://example.org/docs/a.html"},
+		{"list?page=2", "https://example.org/list?page=2"},
+	} {
+		got, err := pageURL(root, "https:example.org", filepath.Join(root, "https:example.org", filepath.FromSlash(c.path)))
+		if err != nil || got != c.want {
+			t.Errorf("pageURL(%q) = %q, %v, want %q", c.path, got, err, c.want)
+		}
+	}
+}
+
+func TestMissingLinks(t *testing.T) {
+	root := t.TempDir()
+	host := filepath.Join(root, "http:example.org")
+
+	// a mirror with gaps in it
+	for p, body := range map[string]string{
+		"index.html": `<a href="/docs/">docs</a> <a href="/gone.html">gone</a> <a href="https://other.example/x.html">other</a>
+<a href="/private/secret.html">excluded</a> <a href="/docs/#top">docs again</a> <a href="mailto:me@example.org">me</a>`,
+		"docs/index.html":        `<p><img src="logo.png"> <img src="missing.png"> <a href="../gone.html">gone</a>`,
+		"images/docs/logo.png":   "png",
+		"docs/.partial.html.tmp": `<a href="/also-gone.html">not a page of the mirror</a>`,
+	} {
+		path := filepath.Join(host, filepath.FromSlash(p))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dirs, err := parseTypeDirs("image/*=images")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inScope := func(u *url.URL) bool {
+		return u.Host == "example.org" && !strings.HasPrefix(u.Path, "/private/")
+	}
+
+	missing, err := missingLinks(root, "http:example.org", dirs, inScope, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each only once, from the first page walked that links to it
+	want := []string{
+		"http://example.org/docs/missing.png (linked from http://example.org/docs/)",
+		"http://example.org/gone.html (linked from http://example.org/docs/)",
+	}
+
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("got %q, want %q", missing, want)
+	}
+}
+
+func TestVerifyComplete(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/gone.html">gone</a>`,
+		"/a.html": `a`,
+	})
+
+	for _, c := range []struct {
+		name    string
+		exclude []string
+		want    string
+	}{
+		{"incomplete", nil, "mirror is missing linked files"},
+		// what's left out on purpose isn't missing
+		{"excluded", []string{"/gone"}, "Mirror is complete"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var log bytes.Buffer
+
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.Exclude = c.exclude
+			o.VerifyComplete = true
+			o.Logger = slog.New(slog.NewTextHandler(&log, nil))
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(log.String(), c.want) {
+				t.Errorf("%q not logged:\n%s", c.want, log.String())
+			}
+
+			if got := strings.Contains(log.String(), "gone.html (linked from"); got != (c.exclude == nil) {
+				t.Errorf("/gone.html reported missing %v:\n%s", got, log.String())
+			}
+		})
+	}
+}
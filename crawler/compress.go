@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is what downloads are asked to be compressed with, unless
+// they're stored as sent with Raw, when it's rawAcceptEncoding: a brotli
+// stream has no magic number for readLocal to recognize it by on disk.
+const (
+	acceptEncoding    = "gzip, br, zstd"
+	rawAcceptEncoding = "gzip, zstd"
+)
+
+// decompress returns a reader of what r holds compressed with encoding, a
+// Content-Encoding, or nil if it's not one that can be decoded, such as
+// identity.
+func decompress(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	}
+
+	return nil, nil
+}
+
+// sniffEncoding returns the Content-Encoding of a file stored with Raw that
+// starts with head, or "" if it doesn't look compressed.
+func sniffEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	}
+
+	return ""
+}
+
+// decodeTransport does for brotli and zstd what net/http does for gzip
+// only: it asks for downloads to be compressed and decompresses them,
+// leaving the response as if they weren't. Like net/http it doesn't for a
+// HEAD, which would get the compressed length, for a range of the
+// compressed bytes, or for a request that sets Accept-Encoding itself.
+type decodeTransport struct {
+	base http.RoundTripper
+}
+
+func (t *decodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "HEAD" || req.Header.Get("Range") != "" || req.Header.Get("Accept-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := decompress(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if zr == nil {
+		return resp, nil
+	}
+
+	resp.Body = decodedBody{zr, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return resp, nil
+}
+
+// decodedBody reads a response body through its decoder, closing both.
+type decodedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,286 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// jarEntry is a cookie as stored by cookieJar. Domain is always set, without
+// a leading dot, and hostOnly records whether the cookie only applies to
+// exactly that host rather than to its subdomains as well.
+type jarEntry struct {
+	*http.Cookie
+	hostOnly bool
+}
+
+// cookieJar is a simple http.CookieJar that, unlike net/http/cookiejar,
+// remembers every cookie's attributes so the jar can be written back out in
+// Netscape cookies.txt format. Like net/http/cookiejar, it refuses cookies
+// for a public suffix such as co.uk, which every site under it would get.
+type cookieJar struct {
+	mu      sync.Mutex
+	entries []jarEntry
+}
+
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+
+	for _, c := range cookies {
+		c := *c
+		e := jarEntry{Cookie: &c}
+
+		if c.Domain == "" {
+			c.Domain = host
+			e.hostOnly = true
+		} else {
+			c.Domain = strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+			if !domainMatch(host, c.Domain) {
+				continue
+			}
+
+			switch {
+			case net.ParseIP(host) != nil:
+				// an IP address has no subdomains to share cookies with
+				if c.Domain != host {
+					continue
+				}
+
+				e.hostOnly = true
+			case isPublicSuffix(c.Domain):
+				// allowed for a host that is a public suffix itself, as
+				// for github.io, but then only for that host
+				if c.Domain != host {
+					continue
+				}
+
+				e.hostOnly = true
+			}
+		}
+
+		if c.Path == "" || c.Path[0] != '/' {
+			c.Path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge > 0:
+			c.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		case c.MaxAge < 0:
+			c.Expires = time.Unix(1, 0)
+		}
+
+		j.put(e)
+	}
+}
+
+// put replaces any cookie with the same name, domain and path as e, dropping
+// it instead if e has already expired. Must be called with mu held.
+func (j *cookieJar) put(e jarEntry) {
+	for i, old := range j.entries {
+		if old.Name == e.Name && old.Domain == e.Domain && old.Path == e.Path {
+			j.entries = append(j.entries[:i], j.entries[i+1:]...)
+			break
+		}
+	}
+
+	if !e.Expires.IsZero() && e.Expires.Before(time.Now()) {
+		return
+	}
+
+	j.entries = append(j.entries, e)
+}
+
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+
+	now := time.Now()
+	matched := []jarEntry{}
+
+	for _, e := range j.entries {
+		if !e.Expires.IsZero() && e.Expires.Before(now) {
+			continue
+		}
+
+		if e.hostOnly && host != e.Domain || !e.hostOnly && !domainMatch(host, e.Domain) {
+			continue
+		}
+
+		if !pathMatch(p, e.Path) || e.Secure && u.Scheme != "https" {
+			continue
+		}
+
+		matched = append(matched, e)
+	}
+
+	// more specific paths go first, as browsers do
+	sort.SliceStable(matched, func(a, b int) bool {
+		return len(matched[a].Path) > len(matched[b].Path)
+	})
+
+	cookies := make([]*http.Cookie, len(matched))
+	for i, e := range matched {
+		cookies[i] = &http.Cookie{Name: e.Name, Value: e.Value}
+	}
+
+	return cookies
+}
+
+// isPublicSuffix reports whether domain is one under which anyone can
+// register names, such as com or co.uk.
+func isPublicSuffix(domain string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+func domainMatch(host string, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func pathMatch(p string, cookiePath string) bool {
+	if !strings.HasPrefix(p, cookiePath) {
+		return false
+	}
+
+	return len(p) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") || p[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath is the directory of the request path, per RFC 6265.
+func defaultCookiePath(p string) string {
+	if p == "" || p[0] != '/' || strings.Count(p, "/") == 1 {
+		return "/"
+	}
+
+	return path.Dir(p)
+}
+
+// load reads cookies from a Netscape cookies.txt file, as written by curl,
+// wget and browser export extensions. HttpOnly cookies are recognised by
+// curl's "#HttpOnly_" domain prefix.
+func (j *cookieJar) load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("%s:%d: expected 7 tab separated fields, got %d", file, n, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: bad expiry `%s`", file, n, fields[4])
+		}
+
+		c := &http.Cookie{
+			Domain:   strings.TrimPrefix(strings.ToLower(fields[0]), "."),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+
+		if expires != 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+
+		j.put(jarEntry{c, !strings.EqualFold(fields[1], "TRUE")})
+	}
+
+	return scanner.Err()
+}
+
+// save writes every unexpired cookie, session cookies included, to a
+// Netscape cookies.txt file that load (or curl and wget) can read back.
+func (j *cookieJar) save(file string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# Netscape HTTP Cookie File")
+
+	now := time.Now()
+
+	for _, e := range j.entries {
+		if !e.Expires.IsZero() && e.Expires.Before(now) {
+			continue
+		}
+
+		domain := e.Domain
+		subdomains := "FALSE"
+		if !e.hostOnly {
+			domain = "." + domain
+			subdomains = "TRUE"
+		}
+
+		if e.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+
+		secure := "FALSE"
+		if e.Secure {
+			secure = "TRUE"
+		}
+
+		var expires int64
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Unix()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, subdomains, e.Path, secure, expires, e.Name, e.Value)
+	}
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
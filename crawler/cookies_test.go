@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCookieJarDomains(t *testing.T) {
+	for _, c := range []struct {
+		from   string
+		domain string
+		sentTo []string
+		notTo  []string
+	}{
+		{"https://www.example.org/", "", []string{"https://www.example.org/"}, []string{"https://example.org/", "https://a.www.example.org/"}},
+		{"https://www.example.org/", "example.org", []string{"https://example.org/", "https://a.example.org/"}, []string{"https://example.com/"}},
+		{"https://www.example.co.uk/", ".example.co.uk", []string{"https://shop.example.co.uk/"}, nil},
+
+		// public suffixes, which every site under them would get
+		{"https://www.example.co.uk/", "co.uk", nil, []string{"https://www.example.co.uk/", "https://other.co.uk/"}},
+		{"https://example.com/", "com", nil, []string{"https://example.com/", "https://other.com/"}},
+
+		// unless set by the suffix itself, for it alone
+		{"https://github.io/", "github.io", []string{"https://github.io/"}, []string{"https://someone.github.io/"}},
+
+		// IP addresses have no subdomains
+		{"http://127.0.0.1/", "127.0.0.1", []string{"http://127.0.0.1/"}, nil},
+		{"http://127.0.0.1/", "0.0.1", nil, []string{"http://127.0.0.1/"}},
+
+		{"https://www.example.org/", "example.com", nil, []string{"https://www.example.org/", "https://example.com/"}},
+	} {
+		jar := &cookieJar{}
+
+		u, _ := url.Parse(c.from)
+		jar.SetCookies(u, []*http.Cookie{{Name: "n", Value: "v", Domain: c.domain}})
+
+		for _, to := range c.sentTo {
+			tu, _ := url.Parse(to)
+			if len(jar.Cookies(tu)) != 1 {
+				t.Errorf("cookie for %q from %s not sent to %s", c.domain, c.from, to)
+			}
+		}
+
+		for _, to := range c.notTo {
+			tu, _ := url.Parse(to)
+			if len(jar.Cookies(tu)) != 0 {
+				t.Errorf("cookie for %q from %s sent to %s", c.domain, c.from, to)
+			}
+		}
+	}
+}
+
+func TestCookieRoundTrip(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			http.Error(w, "log in first", http.StatusForbidden)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: "visited", Value: r.URL.Path, Path: "/", MaxAge: 3600, HttpOnly: true})
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/members.html">members</a>`))
+		}
+	}))
+	defer s.Close()
+
+	host := strings.TrimPrefix(s.URL, "http://")
+	host = host[:strings.IndexByte(host, ':')]
+
+	o := testOptions(t, s.URL+"/")
+	o.LoadCookies = filepath.Join(t.TempDir(), "in.txt")
+	o.SaveCookies = filepath.Join(t.TempDir(), "out.txt")
+
+	err := os.WriteFile(o.LoadCookies, []byte("# Netscape HTTP Cookie File\n"+
+		host+"\tFALSE\t/\tFALSE\t0\tsession\tabc\n"+
+		"#HttpOnly_.example.org\tTRUE\t/private\tTRUE\t4102444800\ttoken\txyz\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the session cookie loaded was sent with every request
+	if res.Fetched != 2 {
+		t.Errorf("fetched %d files, want 2, failures %v", res.Fetched, res.Failures)
+	}
+
+	b, err := os.ReadFile(o.SaveCookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := string(b)
+
+	for _, want := range []string{
+		host + "\tFALSE\t/\tFALSE\t0\tsession\tabc\n",
+		"#HttpOnly_.example.org\tTRUE\t/private\tTRUE\t4102444800\ttoken\txyz\n",
+		"#HttpOnly_" + host + "\tFALSE\t/\tFALSE\t",
+		"\tvisited\t/members.html\n",
+	} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved cookies lack %q:\n%s", want, saved)
+		}
+	}
+
+	// and what was saved loads back the same
+	jar := &cookieJar{}
+	if err := jar.load(o.SaveCookies); err != nil {
+		t.Fatal(err)
+	}
+
+	again := filepath.Join(t.TempDir(), "again.txt")
+	if err := jar.save(again); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err = os.ReadFile(again); err != nil || string(b) != saved {
+		t.Errorf("saved again as\n%s, want\n%s", b, saved)
+	}
+}
+
+func TestDefaultCookies(t *testing.T) {
+	o := testOptions(t, "https://www.example.co.uk/")
+
+	r, err := newRun(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.client.Jar == nil {
+		t.Fatal("no cookie jar by default")
+	}
+
+	// kept for the crawl, but never for every site under a public suffix
+	from, _ := url.Parse("https://www.example.co.uk/")
+	r.client.Jar.SetCookies(from, []*http.Cookie{
+		{Name: "session", Value: "1"},
+		{Name: "tracker", Value: "2", Domain: "co.uk"},
+	})
+
+	if got := r.client.Jar.Cookies(from); len(got) != 1 || got[0].Name != "session" {
+		t.Errorf("sent %v back, want only the session cookie", got)
+	}
+
+	other, _ := url.Parse("https://other.co.uk/")
+	if got := r.client.Jar.Cookies(other); len(got) != 0 {
+		t.Errorf("sent %v to another site", got)
+	}
+
+	o.NoCookies = true
+
+	if r, err = newRun(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.client.Jar != nil {
+		t.Error("cookie jar with NoCookies")
+	}
+}
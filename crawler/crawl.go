@@ -0,0 +1,1633 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// item is a URL in the queue.
+type item struct {
+	url   string
+	depth uint
+
+	// hops counts links followed since the nearest page matching -seed,
+	// or is -1 if no seed page has been passed through yet. Unlike depth,
+	// which only limits how far the crawl wanders from the start URL, hops
+	// decides which of the crawled files are actually kept.
+	hops   int
+	parent string
+}
+
+// job is a URL handed to a worker to download.
+type job struct {
+	item    item
+	iu      *url.URL
+	path    string
+	hostDir string
+	hops    int
+	save    bool
+	offHost bool
+	resume  bool
+	meta    *fileMeta
+
+	// key is the path the job was claimed under in inflight, before
+	// the worker moved it, e.g. into a -type-dir directory
+	key string
+
+	// set by the worker when it didn't download the URL after all, with
+	// why in skip: probe is the HEAD that found it was only to be
+	// crawled through, with the path it was planned at; freshPath the
+	// copy found up to date, and links what's in it to follow
+	skip      error
+	probe     *http.Response
+	probePath string
+	freshPath string
+	links     *result
+
+	res     *result
+	err     error
+	elapsed time.Duration
+}
+
+// why a worker didn't download a job's URL after all, in job.skip, as well
+// as ErrDeclined
+var (
+	errDisallowed = errors.New("disallowed by robots.txt")
+	errPassed     = errors.New("not a page to crawl through")
+	errUpToDate   = errors.New("up to date")
+	errUnchecked  = errors.New("could not be checked")
+)
+
+// fontRef is a font a stylesheet declares, as written in it and resolved.
+type fontRef struct {
+	raw string
+	url string
+}
+
+// convertPage is a page or stylesheet downloaded, for ConvertLinks, with
+// what the crawl resolved the links in it to.
+type convertPage struct {
+	url      string
+	base     string
+	css      bool
+	resolved map[string]string
+}
+
+// crawl works through the queue with the workers, twice with PlanFirst,
+// and wraps up once it's empty or the crawl is cut short.
+func (r *run) crawl() (*Result, error) {
+	r.navigated = map[string]struct{}{}
+	r.traps = []string{}
+	r.queryVariants = map[string]uint{}
+	r.templates = map[string]uint{}
+	r.urlPaths = map[string]string{}
+	r.fontRefs = map[string][]fontRef{}
+	r.convertPages = map[string]*convertPage{}
+	r.collapsed = map[string]bool{}
+	r.robots = map[string]*robotsEntry{}
+
+	if r.o.HostStats {
+		r.perHost = hostTable{}
+	}
+
+	if r.o.ChecksumManifest != "" {
+		r.checksums = map[string][]byte{}
+	}
+
+	r.summary = &crawlSummary{}
+	r.started = time.Now()
+
+	r.jobs = make(chan *job)
+	r.done = make(chan *job, r.o.Workers)
+
+	for w := 0; w < r.o.Workers; w++ {
+		go r.work()
+	}
+
+	defer close(r.jobs)
+
+	r.planning = r.o.PlanFirst || r.o.PlanOnly
+	start := append([]item(nil), r.queue...)
+
+	r.archives.count(r.queue)
+
+	for {
+		r.dispatch()
+
+		if r.aborted != "" {
+			r.notifyAborted(r.aborted)
+			return nil, errors.New(r.aborted)
+		}
+
+		if !r.planning || r.timedOut || r.ctx.Err() != nil {
+			break
+		}
+
+		if !r.o.Spider {
+			r.plan.report(r.out)
+		}
+
+		if r.o.PlanOnly {
+			r.summary.finish(time.Since(r.started))
+			return r.summary.result(len(r.queue)), nil
+		}
+
+		// start over, now downloading for real
+		r.planning = false
+		r.redirects.Store(0)
+		r.downloads = 0
+		r.summary.reset()
+		r.queue = append(r.queue, start...)
+		r.archives.count(r.queue)
+		r.seen = map[string]struct{}{}
+		r.navigated = map[string]struct{}{}
+		r.queryVariants = map[string]uint{}
+		r.templates = map[string]uint{}
+		r.traps = r.traps[:0]
+		r.challenges = nil
+	}
+
+	return r.wrapUp()
+}
+
+// work downloads the jobs handed to it until there are no more, once check
+// has found they're to be, trying again those that stalled, got a bot
+// challenge or failed in a way worth retrying.
+func (r *run) work() {
+	for j := range r.jobs {
+		started := time.Now()
+
+		if !r.check(j) {
+			j.elapsed = time.Since(started)
+			r.done <- j
+			continue
+		}
+
+		j.res, j.err = r.fetch(j.item.url, j.path, j.resume, j.meta)
+		for attempt := 0; errors.Is(j.err, ErrStalled) && attempt < statusRetries; attempt++ {
+			r.log.Warn("stalled, retrying", "url", j.item.url)
+			j.res, j.err = r.fetch(j.item.url, j.path, j.resume, j.meta)
+		}
+
+		for attempt := 0; errors.Is(j.err, ErrChallenge) && r.o.ChallengeWait > 0 && attempt < statusRetries && r.ctx.Err() == nil; attempt++ {
+			r.log.Warn("got a bot challenge, retrying", "url", j.item.url, "in", r.o.ChallengeWait)
+			r.sleep(r.o.ChallengeWait)
+			j.res, j.err = r.fetch(j.item.url, j.path, j.resume, j.meta)
+		}
+
+		for attempt := 0; attempt < r.retryLimit(j.err) && r.ctx.Err() == nil; attempt++ {
+			d := backoff(attempt)
+			r.log.Warn("failed, retrying", "url", j.item.url, "err", j.err, "in", d.Round(time.Millisecond))
+			r.sleep(d)
+
+			// and still no sooner than -wait allows
+			r.sleep(r.pacer.delay(strings.ToLower(j.iu.Host), now()))
+
+			j.res, j.err = r.fetch(j.item.url, j.path, j.resume, j.meta)
+		}
+
+		if errors.Is(j.err, ErrNotModified) {
+			if info, err := os.Stat(j.path); err == nil {
+				j.links = r.readLocal(j, j.path, nil, info.Size())
+			}
+		}
+
+		j.elapsed = time.Since(started)
+		r.done <- j
+	}
+}
+
+// dispatch hands the queue out to the workers until it's empty or the crawl
+// is cut short, and waits for the downloads in progress to finish.
+func (r *run) dispatch() {
+	// wait is set when the next URL in the queue has to wait for a
+	// download in progress
+	wait := false
+
+	for len(r.queue) > 0 || len(r.inflight) > 0 {
+		r.settle()
+		r.archiveDone()
+
+		if len(r.inflight) > 0 && (len(r.queue) == 0 || len(r.inflight) >= r.o.Workers || wait) {
+			wait = false
+			r.finish()
+			continue
+		}
+
+		wait = false
+
+		if r.aborted != "" || r.ctx.Err() != nil {
+			break
+		}
+
+		// checked between downloads, so one in progress finishes first
+		if r.o.TimeBox > 0 && time.Since(r.started) >= r.o.TimeBox {
+			r.timedOut = true
+			break
+		}
+
+		r.queueMu.Lock()
+		i := r.queue[0]
+		r.queue = r.queue[1:]
+		r.current = &i
+		r.queueMu.Unlock()
+
+		r.archives.add(i.url, -1)
+
+		j := r.prepare(i)
+		if j == nil {
+			continue
+		}
+
+		if !r.withinLimits() {
+			// left for a later crawl to pick up, e.g. with FrontierIn
+			r.requeue(i)
+			break
+		}
+
+		if _, ok := r.inflight[j.path]; ok {
+			// e.g. / and /index.html, or a URL queued twice before its
+			// first download finished, let that one finish first
+			r.requeue(i)
+			wait = true
+			continue
+		}
+
+		j.key = j.path
+
+		r.queueMu.Lock()
+		r.inflight[j.key] = i
+		r.current = nil
+		r.queueMu.Unlock()
+
+		r.fetches++
+		r.jobs <- j
+	}
+
+	r.settle()
+
+	// let the downloads already started when the crawl was cut short
+	// finish, they can't be picked up halfway
+	for len(r.inflight) > 0 {
+		r.finish()
+	}
+}
+
+// archiveDone writes the archives of the hosts the crawl is done with, with
+// ArchivePerHost. Hosts only visited for page requisites may turn up again
+// with any page, so they're left until the end rather than written again
+// and again.
+func (r *run) archiveDone() {
+	if r.archives == nil || r.planning {
+		return
+	}
+
+	r.archives.write(r.dir, func(hostDir string) bool {
+		_, host, _ := strings.Cut(hostDir, ":")
+		if !r.crawlHost(host) {
+			return false
+		}
+
+		for _, i := range r.inflight {
+			if hostDirOf(i.url) == hostDir {
+				return false
+			}
+		}
+
+		return true
+	}, r.log)
+}
+
+// withinLimits reports whether another download may be started, as far as
+// MaxFiles, Quota and Budget go.
+func (r *run) withinLimits() bool {
+	switch {
+	case r.o.MaxFiles > 0 && r.fetches >= r.o.MaxFiles:
+		r.log.Info("stopping, -max-files reached", "max_files", r.o.MaxFiles)
+	case r.quotaBytes > 0 && r.received >= r.quotaBytes:
+		r.log.Info("stopping, the quota is used up", "quota", r.o.Quota)
+	case r.spent != nil && r.spent.exhausted(now()):
+		r.log.Info("stopping, the budget is used up", "budget", r.o.Budget)
+	default:
+		return true
+	}
+
+	return false
+}
+
+// requeue puts i back at the front of the queue.
+func (r *run) requeue(i item) {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	r.queue = append([]item{i}, r.queue...)
+	r.current = nil
+
+	r.archives.add(i.url, 1)
+}
+
+// finish waits for a worker to be done with a download and completes it. A
+// download cut short by the crawl being cancelled is queued again instead.
+func (r *run) finish() {
+	j := <-r.done
+
+	r.queueMu.Lock()
+	delete(r.inflight, j.key)
+	r.queueMu.Unlock()
+
+	// only downloads count towards MaxFiles
+	if j.skip != nil {
+		r.fetches--
+	}
+
+	if j.err != nil && r.ctx.Err() != nil {
+		r.requeue(j.item)
+		return
+	}
+
+	r.complete(j)
+
+	if !r.planning {
+		r.jr.seen(j.item.url)
+	}
+}
+
+// settle journals the URL last popped from the queue, if it was dealt with
+// without being handed to a worker.
+func (r *run) settle() {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	if r.current != nil && !r.planning {
+		r.jr.seen(r.current.url)
+	}
+
+	r.current = nil
+}
+
+// head sends a HEAD request for u.
+func (r *run) head(u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, "HEAD", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// prepare decides what's to be done about a URL taken off the queue: it
+// returns the job of downloading it, or nil if it's skipped. Whatever takes
+// a request or a wait is left to the worker, in check.
+func (r *run) prepare(i item) *job {
+	if i.depth > r.o.Depth {
+		r.summary.skip("depth")
+		r.log.Info("skipping, exceeds depth limit", "url", i.url)
+		return nil
+	}
+
+	hops := i.hops
+	for _, re := range r.seedRE {
+		if re.MatchString(i.url) {
+			hops = 0
+			break
+		}
+	}
+
+	save := r.withinSeed(hops)
+
+	if _, ok := r.seen[i.url]; ok {
+		if _, ok := r.navigated[i.url]; !ok || !save {
+			return nil
+		}
+	}
+
+	// First we check excludes for any match to see if we shouldn't
+	// be downloading this URL, skip if we shouldn't.
+	// Then we check includes to see if any match, and if it does
+	// then we download the file, otherwise skip.
+
+	matched := false
+	for _, re := range r.excludeRE {
+		if re.MatchString(i.url) {
+			matched = true
+			break
+		}
+	}
+
+	if matched {
+		r.seen[i.url] = struct{}{}
+		r.summary.skip("exclude")
+		r.log.Debug("skipping, excluded", "url", i.url)
+		return nil
+	}
+
+	matched = false
+	for _, re := range r.includeRE {
+		if re.MatchString(i.url) {
+			matched = true
+			break
+		}
+	}
+
+	if !matched {
+		r.seen[i.url] = struct{}{}
+		r.summary.skip("include")
+		r.log.Debug("skipping, not included", "url", i.url)
+		return nil
+	}
+
+	iu, err := url.Parse(i.url)
+	if err != nil {
+		r.log.Warn("could not parse URL", "url", i.url, "err", err)
+		return nil
+	}
+
+	if reason := trapReason(iu.Path, r.o.MaxPathDepth); reason != "" {
+		r.traps = append(r.traps, fmt.Sprintf("%s (%s)", i.url, reason))
+		r.seen[i.url] = struct{}{}
+		r.summary.skip("trap")
+		return nil
+	}
+
+	if r.o.MaxQueryVariants > 0 && iu.RawQuery != "" {
+		base := iu.Scheme + "://" + strings.ToLower(iu.Host) + iu.Path
+
+		// every URL only gets this far once, so each one
+		// counted here is a distinct query string
+		r.queryVariants[base]++
+
+		if r.queryVariants[base] > r.o.MaxQueryVariants {
+			if r.queryVariants[base] == r.o.MaxQueryVariants+1 {
+				r.log.Info("skipping further query variants", "url", base, "limit", r.o.MaxQueryVariants)
+			}
+
+			r.seen[i.url] = struct{}{}
+			r.summary.skip("query variants")
+			return nil
+		}
+	}
+
+	if r.o.TemplateSample > 0 && i.depth > 0 {
+		t := urlTemplate(iu)
+
+		r.templates[t]++
+
+		if r.templates[t] > r.o.TemplateSample {
+			if r.templates[t] == r.o.TemplateSample+1 {
+				r.log.Info("skipping further URLs like this", "template", t, "sampled", r.o.TemplateSample)
+			}
+
+			r.seen[i.url] = struct{}{}
+			r.summary.skip("template sample")
+			return nil
+		}
+	}
+
+	path, err := urlToPath(i.url)
+	if err != nil {
+		r.log.Warn("could not convert URL to local path", "url", i.url, "err", err)
+		return nil
+	}
+
+	// directories are laid out as "https:my.web.site:80"
+	// port is omitted if omitted in input URL
+	// (no credentials are stored in the name)
+	hostDir := iu.Scheme + ":" + strings.ToLower(iu.Host)
+
+	return &job{
+		item:    i,
+		iu:      iu,
+		path:    filepath.Join(r.dir, hostDir, path),
+		hostDir: hostDir,
+		hops:    hops,
+		save:    save,
+
+		// cross-origin requisites are saved but never crawled further
+		offHost: !r.crawlHost(iu.Host),
+
+		// a sample isn't something to pick up where we left off
+		resume: r.o.Resume && r.o.PartialBytes == 0,
+	}
+}
+
+// check does what has to happen before j's URL is downloaded that takes a
+// request or a wait, on the worker so the crawl loop isn't held up by it:
+// it checks robots.txt, waits for the schedule and the host's turn, asks
+// for the content type where it decides the path and sees whether the copy
+// in the mirror is up to date. It reports whether to download the URL; if
+// not, j.skip says why, or j.err if the crawl was cancelled meanwhile.
+func (r *run) check(j *job) bool {
+	i, iu := j.item, j.iu
+
+	if !r.o.NoRobots {
+		rules := r.robotsFor(iu)
+
+		if r.ctx.Err() != nil {
+			j.err = context.Cause(r.ctx)
+			return false
+		}
+
+		if !rules.allowed(iu.RequestURI()) {
+			j.skip = errDisallowed
+			return false
+		}
+	}
+
+	r.sleep(r.sched.delay(now()))
+	r.sleep(r.pacer.delay(strings.ToLower(iu.Host), now()))
+
+	if r.ctx.Err() != nil {
+		j.err = context.Cause(r.ctx)
+		return false
+	}
+
+	if len(r.types) > 0 && j.save {
+		// the content type decides the path, which the
+		// freshness check needs, so ask for it up front
+		resp, err := r.head(i.url)
+		if err != nil {
+			r.unchecked(j, err)
+			return false
+		}
+
+		if d := r.types.dirFor(resp.Header.Get("Content-Type")); d != "" {
+			hostDir := filepath.Join(r.dir, j.hostDir)
+			rel, _ := filepath.Rel(hostDir, j.path)
+			j.path = filepath.Join(hostDir, d, rel)
+		}
+	}
+
+	if !j.save || r.planning {
+		// not near enough to a seed to keep, or only planning, but
+		// HTML pages still need fetching so the crawl can pass
+		// through them
+		resp, err := r.head(i.url)
+		if err != nil {
+			r.unchecked(j, err)
+			return false
+		}
+
+		j.probe, j.probePath = resp, j.path
+
+		if r.planning && j.save && r.decide != nil && !r.decide(i.url, resp.Header) {
+			j.skip = ErrDeclined
+			return false
+		}
+
+		if !strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/html") {
+			j.skip = errPassed
+			return false
+		}
+
+		// one each, as workers may be passing through several
+		j.path = fmt.Sprintf("%s-%d", r.navPath, r.navigations.Add(1))
+		j.resume = false
+
+		return true
+	}
+
+	for _, re := range r.refreshRE {
+		if re.MatchString(i.url) {
+			j.resume = false
+
+			// only if it changed since the copy we have was made
+			if st, err := os.Stat(j.path); err == nil && r.o.NewerOnly {
+				j.meta = &fileMeta{LastModified: st.ModTime().UTC().Format(http.TimeFormat)}
+			}
+
+			return true
+		}
+	}
+
+	return !r.fresh(j)
+}
+
+// unchecked gives up on j after a request to check it failed, which is put
+// down to the crawl being cancelled if it was.
+func (r *run) unchecked(j *job, err error) {
+	if r.ctx.Err() != nil {
+		j.err = context.Cause(r.ctx)
+		return
+	}
+
+	r.log.Warn("could not HEAD URL", "url", j.item.url, "err", err)
+	j.skip = errUnchecked
+}
+
+// fresh reports whether the copy of j's URL in the mirror, or in the base
+// archive, is up to date, reading in its links for complete to follow, or
+// else sets j up to be downloaded conditionally or afresh where need be. A
+// URL whose freshness can't be checked is skipped, as if it were fresh.
+func (r *run) fresh(j *job) bool {
+	i, path := j.item, j.path
+
+	// where the freshness check looks for an existing copy
+	freshRoot, freshPath := r.dir, path
+
+	info, err := os.Stat(path)
+
+	// complete downloads are only in the storage, which they're
+	// never resumed from
+	if err != nil && r.store != nil {
+		rel, _ := filepath.Rel(r.dir, path)
+		info, err = r.store.Stat(filepath.ToSlash(rel))
+		j.resume = false
+	}
+
+	// files missing from the output may be up to date in the base
+	// archive, in which case this delta doesn't need them
+	if err != nil && r.o.BaseArchive != "" {
+		rel, _ := filepath.Rel(r.dir, path)
+		freshRoot, freshPath = r.o.BaseArchive, filepath.Join(r.o.BaseArchive, rel)
+		info, err = os.Stat(freshPath)
+		j.resume = false
+	}
+
+	if err != nil {
+		return false
+	}
+
+	// upToDate reads in the links of the copy to follow them like in a
+	// download, with header the response to the HEAD, if any
+	upToDate := func(header http.Header) bool {
+		j.skip, j.freshPath = errUpToDate, freshPath
+		j.links = r.readLocal(j, freshPath, header, info.Size())
+
+		return true
+	}
+
+	if r.o.IPFSAware && isImmutableIPFS(i.url) {
+		// content addressed by its hash cannot have
+		// changed since we fetched it, skip the HEAD
+		return upToDate(nil)
+	}
+
+	localSize := info.Size()
+
+	// an optimized image is compared by the size it was downloaded at
+	if orig, err := os.Stat(freshPath + originalSuffix); err == nil && r.o.OptimizeImages {
+		localSize = orig.Size()
+	}
+
+	// asking for the same encoding as the download makes
+	// Content-Length describe the bytes on disk
+	req, err := r.newRequest(r.ctx, "HEAD", i.url)
+	if err != nil {
+		r.unchecked(j, err)
+		return true
+	}
+
+	var meta *fileMeta
+
+	if r.o.StoreValidators && r.o.PartialBytes == 0 {
+		meta, err = loadMeta(freshRoot, freshPath)
+		if err != nil {
+			r.log.Warn("could not read stored metadata", "url", i.url, "err", err)
+		} else if meta != nil && meta.ETag != "" && freshPath == path {
+			// one conditional GET instead of a HEAD and
+			// then a GET if it changed
+			j.meta = meta
+			j.resume = false
+			return false
+		} else if meta != nil {
+			meta.conditional(req)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.unchecked(j, err)
+		return true
+	}
+
+	resp.Body.Close()
+
+	if meta != nil {
+		if changed, known := meta.changed(resp); known && changed {
+			// a different version, don't append to the old one
+			j.resume = false
+			return false
+		} else if known {
+			return upToDate(resp.Header)
+		}
+	}
+
+	// like wget -N, a newer file on the server is downloaded
+	// again and an older one only if the size is different
+	if r.o.Timestamping {
+		if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && lm.After(info.ModTime()) {
+			j.resume = false
+			return false
+		}
+	}
+
+	lengthStr := resp.Header.Get("Content-Length")
+
+	if lengthStr != "" {
+		l, err := strconv.Atoi(lengthStr)
+		if err == nil && r.o.PartialBytes > 0 && int64(l) > r.o.PartialBytes {
+			// only ever expect to have the sample
+			l = int(r.o.PartialBytes)
+		}
+
+		if err != nil {
+			r.log.Warn("Content-Length is not an integer, downloading anyway", "url", i.url, "content_length", lengthStr)
+			j.resume = false
+		} else if int64(l) == localSize {
+			// file on filesystem same size as remote,
+			// then assume we've already fetched correctly
+			return upToDate(resp.Header)
+		}
+	}
+
+	return false
+}
+
+// readLocal reads in the links in the copy of j's page or stylesheet at
+// path, found up to date, for complete to follow as if it had just been
+// downloaded, so that the files it links to are still checked, and
+// downloaded again if they went missing. header is the response to a HEAD
+// for it, if there was one; otherwise what the file is, and whether it's
+// compressed, is sniffed. It returns nil if there's nothing to follow.
+func (r *run) readLocal(j *job, path string, header http.Header, size int64) *result {
+	var f io.ReadCloser
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && r.store != nil {
+		rel, _ := filepath.Rel(r.dir, path)
+		f, err = r.store.Open(filepath.ToSlash(rel))
+	}
+
+	if err != nil {
+		r.log.Warn("could not read to follow its links", "path", path, "err", err)
+		return nil
+	}
+
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(512)
+
+	// stored compressed with Raw, and only then
+	encoding := sniffEncoding(head)
+
+	h := http.Header{}
+	h.Set("Content-Type", header.Get("Content-Type"))
+
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+	}
+
+	// without the charset sniffing assumes, which the page may say
+	// otherwise
+	if h.Get("Content-Type") == "" {
+		switch ext := strings.ToLower(filepath.Ext(path)); {
+		case ext == ".css":
+			h.Set("Content-Type", "text/css")
+		case ext == ".html" || ext == ".htm":
+			h.Set("Content-Type", "text/html")
+		case encoding == "":
+			h.Set("Content-Type", mediaType(http.DetectContentType(head)))
+		}
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "text/html") && !strings.HasPrefix(contentType, "text/css") {
+		return nil
+	}
+
+	res := &result{}
+
+	if err = r.parse(j.item.url, br, h, size, res); err != nil {
+		r.log.Warn("could not follow links", "path", path, "err", err)
+		return nil
+	}
+
+	return res
+}
+
+// checked takes care of what a worker found out about j before downloading
+// it, and reports whether that's all there is to do.
+func (r *run) checked(j *job) bool {
+	i := j.item
+
+	if p := j.probe; p != nil {
+		if r.o.Spider {
+			fmt.Fprintf(r.out, "%d %s\n", p.StatusCode, i.url)
+		}
+
+		if r.planning && j.save && j.skip != ErrDeclined {
+			if info, err := os.Stat(j.probePath); err == nil && strconv.FormatInt(info.Size(), 10) == p.Header.Get("Content-Length") {
+				r.plan.upToDate++
+			} else {
+				r.plan.add(j.probePath, p.Header)
+			}
+		}
+	}
+
+	switch j.skip {
+	case nil:
+		return false
+
+	case errDisallowed:
+		r.seen[i.url] = struct{}{}
+		r.summary.skip("robots.txt")
+		r.log.Info("skipping, disallowed by robots.txt", "url", i.url)
+
+	case ErrDeclined:
+		r.seen[i.url] = struct{}{}
+		r.log.Info("skipping", "url", i.url, "reason", ErrDeclined)
+
+	case errPassed:
+		r.seen[i.url] = struct{}{}
+
+		if !r.planning {
+			r.navigated[i.url] = struct{}{}
+		}
+
+	case errUpToDate:
+		r.upToDate(j)
+	}
+
+	return true
+}
+
+// upToDate records the copy of j's URL at j.freshPath, found up to date, as
+// where the URL is if it's in the mirror, and follows the links in it.
+func (r *run) upToDate(j *job) {
+	r.seen[j.item.url] = struct{}{}
+
+	if j.freshPath == j.path {
+		r.urlPaths[j.item.url] = j.path
+
+		if r.checksums != nil {
+			r.checksums[j.path] = nil
+		}
+	}
+
+	if j.links != nil {
+		r.follow(j, j.links, baseOf(j.iu, j.links), j.path)
+	}
+}
+
+// complete takes care of everything after a download: it is only ever
+// called from the crawl loop, so none of the state it updates needs
+// locking however many workers there are.
+func (r *run) complete(j *job) {
+	if r.checked(j) {
+		return
+	}
+
+	i, iu, path, res, err := j.item, j.iu, j.path, j.res, j.err
+
+	if errors.Is(err, ErrChallenge) {
+		r.challenges = append(r.challenges, i.url)
+	}
+
+	if r.perHost != nil {
+		s := r.perHost.get(strings.ToLower(iu.Host))
+		s.elapsed += j.elapsed
+
+		switch {
+		case err == nil:
+			s.files++
+			s.bytes += res.received
+		case !errors.Is(err, ErrDeclined) && !errors.Is(err, ErrSkippedStatus) && !errors.Is(err, ErrNotFollowed) && !errors.Is(err, ErrNotModified):
+			s.errors++
+		}
+	}
+
+	switch se := (*statusError)(nil); {
+	case err == nil:
+		r.metrics.observe(res.status, res.received, j.elapsed)
+	case errors.Is(err, ErrNotModified):
+		r.metrics.observe(http.StatusNotModified, 0, j.elapsed)
+	case errors.As(err, &se):
+		r.metrics.observe(se.code, 0, j.elapsed)
+	case !errors.Is(err, ErrDeclined) && !errors.Is(err, ErrSkippedStatus) && !errors.Is(err, ErrChallenge) && !errors.Is(err, ErrNotFollowed):
+		r.metrics.observe(0, 0, j.elapsed)
+	}
+
+	if errors.Is(err, ErrNotModified) {
+		j.freshPath = path
+		r.upToDate(j)
+		return
+	}
+
+	if errors.Is(err, ErrDeclined) || errors.Is(err, ErrSkippedStatus) || errors.Is(err, ErrChallenge) || errors.Is(err, ErrNotFollowed) {
+		r.seen[i.url] = struct{}{}
+		r.summary.skip(skipReason(err))
+		r.log.Info("skipping", "url", i.url, "reason", err)
+		r.events.emit("skipped", i.url, "", err)
+		return
+	}
+
+	if err != nil {
+		r.summary.fail(i.url, err)
+		r.log.Warn("couldn't process URL", "url", i.url, "err", err)
+		r.events.emit("error", i.url, "", err)
+
+		if se := (*statusError)(nil); errors.As(err, &se) && !r.planning {
+			r.index.add(i.url, se.code, "", 0, nil, "", now())
+			r.manifest.add(i.url, se.code, "", 0, nil, "", j.elapsed, i.parent)
+		}
+
+		return
+	}
+
+	// pages of types not wanted are still crawled through
+	if j.save && !r.typeAccepted(res.header.Get("Content-Type")) {
+		j.save = false
+	}
+
+	// pages only crawled through are archived too, before they go
+	if r.warc != nil && !r.planning {
+		if err := r.warc.exchange(res, path); err != nil {
+			r.log.Warn("could not archive", "url", i.url, "err", err)
+		}
+	}
+
+	if !j.save || r.planning {
+		os.Remove(path)
+	}
+
+	// moved to where the URL redirected to, its canonical path
+	if r.o.SaveFinalURL && j.save && !r.planning && res.finalURL != i.url {
+		fu, err := url.Parse(res.finalURL)
+		p, perr := urlToPath(res.finalURL)
+
+		if err = errors.Join(err, perr); err == nil {
+			if d := r.types.dirFor(res.header.Get("Content-Type")); d != "" {
+				p = filepath.Join(d, p)
+			}
+
+			finalDir := fu.Scheme + ":" + strings.ToLower(fu.Host)
+			final := filepath.Join(r.dir, finalDir, p)
+
+			if err = os.MkdirAll(filepath.Dir(final), 0755); err == nil {
+				err = os.Rename(path, final)
+			}
+
+			if err == nil {
+				path, j.hostDir = final, finalDir
+				r.seen[res.finalURL] = struct{}{}
+				r.jr.seen(res.finalURL)
+			}
+		}
+
+		if err != nil {
+			r.log.Warn("could not move to the path of where it redirected", "path", path, "url", res.finalURL, "err", err)
+		}
+	}
+
+	r.received += res.received
+	r.summary.fetched(res.received)
+
+	if r.spent != nil {
+		if err := r.spent.add(now(), res.received); err != nil {
+			r.log.Warn("could not update budget file", "err", err)
+		}
+	}
+
+	r.downloads++
+
+	// don't judge the ratio until there's a reasonable sample
+	if r.o.MaxRedirectRatio > 0 && !r.redirectWarned && r.downloads >= 10 {
+		if ratio := float64(r.redirects.Load()) / float64(r.downloads); ratio > r.o.MaxRedirectRatio {
+			r.log.Warn("averaging many redirects per download", "ratio", fmt.Sprintf("%.1f", ratio), "redirects", r.redirects.Load(), "downloads", r.downloads)
+
+			if r.o.Strict {
+				r.aborted = "averaging too many redirects per download with Strict"
+			}
+
+			r.redirectWarned = true
+		}
+	}
+
+	if r.redirectMap != nil && len(res.redirects) > 0 && !r.planning {
+		err = r.redirectMap.Encode(struct {
+			From   string        `json:"from"`
+			To     string        `json:"to"`
+			Status int           `json:"status"`
+			Chain  []redirectHop `json:"chain"`
+		}{i.url, res.finalURL, res.redirects[0].Status, res.redirects})
+		if err != nil {
+			r.log.Warn("could not record redirects", "url", i.url, "err", err)
+		}
+	}
+
+	if res.html && r.metadata != nil && !r.planning {
+		err = r.metadata.Encode(struct {
+			URL         string `json:"url"`
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			Canonical   string `json:"canonical,omitempty"`
+		}{i.url, res.title, res.description, res.canonical})
+		if err != nil {
+			r.log.Warn("could not record metadata", "url", i.url, "err", err)
+		}
+	}
+
+	if res.html && !res.streamed && j.save && !r.planning && r.o.NearDupThreshold > 0 {
+		if orig := nearDuplicate(r.pages, res.simhash, r.o.NearDupThreshold); orig != "" {
+			r.nearDups = append(r.nearDups, fmt.Sprintf("%s (near duplicate of %s)", i.url, orig))
+
+			if r.o.SkipNearDups {
+				if err = os.Remove(path); err != nil {
+					r.log.Warn("could not remove near duplicate", "path", path, "err", err)
+				}
+
+				r.seen[i.url] = struct{}{}
+				r.summary.skip("near duplicate")
+				r.log.Info("skipping near duplicate", "url", i.url, "of", orig)
+				r.events.emit("skipped", i.url, "", fmt.Errorf("near duplicate of %s", orig))
+				return
+			}
+		} else {
+			r.pages = append(r.pages, fingerprint{i.url, res.simhash})
+		}
+	}
+
+	pageBase := baseOf(iu, res)
+
+	// a page that's a copy of its canonical URL is replaced by it,
+	// unless that's a copy of this page in turn
+	if r.o.Canonical == "collapse" && res.canonical != "" && j.save && !r.planning {
+		if cu, err := pageBase.Parse(strings.TrimSpace(res.canonical)); err == nil {
+			cu.Fragment, cu.RawFragment = "", ""
+			stripParams(cu, r.strip)
+			c := cu.String()
+
+			if (cu.Scheme == "http" || cu.Scheme == "https") && r.crawlHost(cu.Host) && c != i.url && !r.collapsed[c] {
+				if err = os.Remove(path); err != nil {
+					r.log.Warn("could not remove", "path", path, "err", err)
+				}
+
+				r.seen[i.url] = struct{}{}
+				r.collapsed[i.url] = true
+				r.summary.skip("canonical")
+
+				if _, ok := r.seen[c]; !ok {
+					r.queueMu.Lock()
+					r.queue = append(r.queue, item{c, i.depth, j.hops, i.url})
+					r.queueMu.Unlock()
+
+					r.archives.add(c, 1)
+
+					r.jr.queued(frontierEntry{c, i.depth, i.url, j.hops})
+				}
+
+				r.log.Info("skipping copy of canonical", "url", i.url, "canonical", c)
+				r.events.emit("skipped", i.url, "", fmt.Errorf("a copy of canonical %s", c))
+				return
+			}
+		}
+	}
+
+	r.follow(j, res, pageBase, path)
+
+	r.seen[i.url] = struct{}{}
+
+	if r.planning {
+		r.log.Info("Planned through", "url", i.url)
+		return
+	}
+
+	if !j.save {
+		r.navigated[i.url] = struct{}{}
+		r.log.Info("Crawled through", "url", i.url)
+		r.events.emit("crawled", i.url, "", nil)
+		r.index.add(i.url, res.status, res.header.Get("Content-Type"), res.received, res.sha256, "", now())
+		r.manifest.add(i.url, res.status, res.header.Get("Content-Type"), res.received, res.sha256, "", j.elapsed, i.parent)
+		return
+	}
+
+	if res.partial {
+		r.log.Info("Got first bytes", "url", i.url, "path", path, "bytes", r.o.PartialBytes)
+	}
+
+	// the size check can't always tell, but the content can
+	if r.o.BaseArchive != "" {
+		rel, _ := filepath.Rel(r.dir, path)
+
+		if sum, err := hashFile(filepath.Join(r.o.BaseArchive, rel)); err == nil && bytes.Equal(sum, res.sha256) {
+			if err = os.Remove(path); err != nil {
+				r.log.Warn("could not remove", "path", path, "err", err)
+			}
+
+			delete(r.navigated, i.url)
+			r.log.Info("Unchanged, already in the base archive", "url", i.url)
+			return
+		}
+	}
+
+	delete(r.navigated, i.url)
+	r.archives.saved(j.hostDir)
+	r.urlPaths[i.url] = path
+
+	if r.o.StoreValidators {
+		if err := saveMeta(r.dir, path, i.url, res.header, res.partial); err != nil {
+			r.log.Warn("could not store metadata", "url", i.url, "err", err)
+		}
+	}
+
+	if r.checksums != nil {
+		r.checksums[path] = res.sha256
+	}
+
+	if r.o.OptimizeImages && !res.partial && !r.o.Raw {
+		saved, err := optimizeImage(path, res.header.Get("Content-Type"), r.o.JPEGQuality, r.o.KeepOriginalImages)
+		if err != nil {
+			r.log.Warn("could not optimize image", "path", path, "err", err)
+		} else if saved > 0 {
+			r.log.Info("Optimized", "path", path, "saved", saved)
+
+			if r.checksums != nil {
+				r.checksums[path] = nil
+			}
+		}
+	}
+
+	if r.o.RootRelative && res.html && !res.partial && !r.o.Raw {
+		changed, err := rewriteHTMLFile(path, func(link string) string {
+			return rootRelative(iu, link)
+		})
+		if err != nil {
+			r.log.Warn("could not rewrite links", "path", path, "err", err)
+		} else if changed && r.checksums != nil {
+			r.checksums[path] = nil
+		}
+	}
+
+	// last, as optimizing and rewriting the file touch it
+	if lm, err := http.ParseTime(res.header.Get("Last-Modified")); err == nil {
+		if err = os.Chtimes(path, lm, lm); err != nil {
+			r.log.Warn("could not set modification time", "path", path, "err", err)
+		}
+	}
+
+	if r.o.ConvertLinks && !res.partial && !r.o.Raw {
+		if css := mediaType(res.header.Get("Content-Type")) == "text/css"; res.html || css {
+			if r.convertPages[path] == nil {
+				r.convertPages[path] = &convertPage{}
+			}
+
+			r.convertPages[path].url, r.convertPages[path].base, r.convertPages[path].css = pageBase.String(), res.base, css
+		}
+	}
+
+	rel, _ := filepath.Rel(r.dir, path)
+
+	if r.archive != nil {
+		if sum, err := r.archive.add(path, rel, r.dir); err != nil {
+			r.log.Warn("could not move into the output archive", "path", path, "err", err)
+		} else {
+			// the file is gone, so the manifest can't hash it later
+			if r.checksums != nil {
+				r.checksums[path] = sum
+			}
+
+			path = r.o.OutputArchive + ":" + filepath.ToSlash(rel)
+		}
+	}
+
+	if r.store != nil {
+		if sum, err := moveToStorage(r.store, path, rel, r.dir); err != nil {
+			r.log.Warn("could not move into storage", "path", path, "err", err)
+		} else {
+			if r.checksums != nil {
+				r.checksums[path] = sum
+			}
+
+			path = strings.TrimSuffix(r.storeName, "/") + "/" + filepath.ToSlash(rel)
+		}
+	}
+
+	r.index.add(i.url, res.status, res.header.Get("Content-Type"), res.received, res.sha256, rel, now())
+	r.manifest.add(i.url, res.status, res.header.Get("Content-Type"), res.received, res.sha256, rel, j.elapsed, i.parent)
+
+	r.log.Info("Got", "url", i.url, "path", path)
+	r.events.emit("got", i.url, path, nil)
+}
+
+// baseOf returns what relative links in the page at iu are relative to:
+// its <base href> if it has one, itself relative to the page.
+func baseOf(iu *url.URL, res *result) *url.URL {
+	if res.base != "" {
+		if b, err := iu.Parse(strings.TrimSpace(res.base)); err == nil {
+			return b
+		}
+	}
+
+	return iu
+}
+
+// follow queues the links res found in the page at j's URL, saved at path,
+// that are to be crawled.
+func (r *run) follow(j *job, res *result, pageBase *url.URL, path string) {
+	i, iu := j.item, j.iu
+
+	childHops := -1
+	if j.hops >= 0 && r.withinSeed(j.hops+1) {
+		childHops = j.hops + 1
+	}
+
+	for _, l := range res.links {
+		// fonts are only told apart with WebFonts
+		font := l.font && r.o.WebFonts
+
+		// fonts are still wanted from stylesheets on other hosts, and
+		// with PageRequisites, whatever the page or stylesheet needs
+		if j.offHost && !font && !(r.o.PageRequisites && l.requisite) {
+			continue
+		}
+
+		link := l.url
+
+		u, err := url.Parse(link)
+		if err != nil {
+			r.log.Info("skipping, could not parse URL", "url", link)
+			continue
+		}
+
+		// relative and scheme relative links, e.g. bar.html or
+		// //cdn.example.org/style.css, made absolute
+		u = pageBase.ResolveReference(u)
+
+		// data:, javascript:, mailto: and the like aren't anything to fetch
+		if !strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https") {
+			continue
+		}
+
+		if r.o.CollapseWWW && strings.TrimPrefix(strings.ToLower(u.Host), "www.") == strings.TrimPrefix(r.host, "www.") {
+			// the canonical form is always the start URL's, so
+			// links to the other variant are mirrored as if they
+			// pointed at the host we started with
+			u.Host = r.host
+		}
+
+		if !r.crawlHost(u.Host) && !(r.o.PageRequisitesSpanHosts && l.requisite) && !font {
+			continue
+		}
+
+		// absolute links keep their own scheme, so the same host
+		// could otherwise be mirrored twice, as http: and https:
+		if strings.ToLower(u.Host) == r.host && !strings.EqualFold(u.Scheme, r.start.Scheme) {
+			switch {
+			case r.o.CrossScheme == "skip":
+				continue
+			case r.o.CrossScheme == "upgrade" && strings.EqualFold(u.Scheme, "http"):
+				u.Scheme = "https"
+			}
+		}
+
+		// we want to collapse all urls with a '#' in it
+		u.Fragment = ""
+		u.RawFragment = ""
+
+		// as well as those only differing in tracking parameters
+		stripParams(u, r.strip)
+
+		link = u.String()
+
+		if _, ok := r.seen[link]; !ok && growsByRepeating(iu.Path, u.Path) {
+			r.traps = append(r.traps, fmt.Sprintf("%s (linked from %s, repeats its path)", link, i.url))
+			r.seen[link] = struct{}{}
+			r.jr.seen(link)
+			continue
+		}
+
+		if font {
+			r.fontRefs[path] = append(r.fontRefs[path], fontRef{l.url, link})
+		}
+
+		if r.o.ConvertLinks && j.save {
+			if r.convertPages[path] == nil {
+				r.convertPages[path] = &convertPage{resolved: map[string]string{}}
+			}
+
+			r.convertPages[path].resolved[l.url] = link
+		}
+
+		_, ok := r.seen[link]
+		_, nav := r.navigated[link]
+
+		if !ok || (nav && r.withinSeed(childHops)) {
+			d := i.depth + 1
+
+			// so the depth limit never leaves a page without them
+			if r.o.PageRequisites && l.requisite {
+				d = i.depth
+			}
+
+			r.queueMu.Lock()
+			r.queue = append(r.queue, item{link, d, childHops, i.url})
+			r.queueMu.Unlock()
+
+			r.archives.add(link, 1)
+
+			r.log.Debug("Queued", "url", link, "depth", d, "parent", i.url)
+
+			if !r.planning {
+				r.jr.queued(frontierEntry{link, d, i.url, childHops})
+			}
+		}
+	}
+}
+
+// wrapUp does what's left once the queue is done with, or the crawl was cut
+// short: converting links, writing out what was collected along the way and
+// reporting on the crawl.
+func (r *run) wrapUp() (*Result, error) {
+	// before the fonts are pointed at their local copies, as the links
+	// converted are looked up as they were in the download
+	conversions := 0
+
+	for path, page := range r.convertPages {
+		// links were resolved for pages that turned out not to be kept
+		if page.url == "" {
+			continue
+		}
+
+		pu, err := url.Parse(page.url)
+		if err != nil {
+			continue
+		}
+
+		convert := func(link string) string {
+			// the links are now relative to the file itself
+			if page.base != "" && link == page.base {
+				return "./"
+			}
+
+			return convertLink(path, pu, link, page.resolved, r.urlPaths)
+		}
+
+		// converting shouldn't make the file look newer than the server's
+		info, err := os.Stat(path)
+		if err != nil {
+			r.log.Warn("could not convert links", "path", path, "err", err)
+			continue
+		}
+
+		changed := false
+
+		if page.css {
+			var b []byte
+
+			if b, err = os.ReadFile(path); err == nil {
+				if converted := rewriteCSSURLs(string(b), convert); converted != string(b) {
+					changed = true
+					err = os.WriteFile(path, []byte(converted), 0666)
+				}
+			}
+		} else {
+			changed, err = rewriteHTMLFile(path, convert)
+		}
+
+		if err != nil {
+			r.log.Warn("could not convert links", "path", path, "err", err)
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		conversions++
+
+		if r.checksums != nil {
+			r.checksums[path] = nil
+		}
+
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+	}
+
+	if conversions > 0 {
+		r.log.Info("Converted links", "files", conversions)
+	}
+
+	for css, refs := range r.fontRefs {
+		b, err := os.ReadFile(css)
+		if err != nil {
+			r.log.Warn("could not reread to rewrite font URLs", "path", css, "err", err)
+			continue
+		}
+
+		rewritten := rewriteCSSURLs(string(b), func(u string) string {
+			for _, ref := range refs {
+				if ref.raw != u {
+					continue
+				}
+
+				if local, ok := r.urlPaths[ref.url]; ok {
+					if rel, err := localRef(css, local); err == nil {
+						return rel
+					}
+				}
+			}
+
+			return u
+		})
+
+		if rewritten == string(b) {
+			continue
+		}
+
+		if err = os.WriteFile(css, []byte(rewritten), 0666); err != nil {
+			r.log.Warn("could not rewrite font URLs", "path", css, "err", err)
+		}
+	}
+
+	if len(r.traps) > 0 {
+		r.log.Info("Skipped likely crawler traps", "count", len(r.traps))
+
+		for _, t := range r.traps {
+			r.log.Info("likely crawler trap", "url", t)
+		}
+	}
+
+	if r.timedOut {
+		r.log.Info("Time box is up", "time_box", r.o.TimeBox, "downloads", r.downloads, "queued", len(r.queue))
+	}
+
+	// cut short by the time box or by ctx, the crawl is picked up where
+	// it was left with StateFile
+	cut := r.timedOut || r.ctx.Err() != nil
+
+	if r.jr != nil {
+		if err := r.jr.close(); err != nil {
+			r.log.Warn("could not write crawl journal", "err", err)
+		}
+
+		r.jr = nil
+
+		// finished, so the next run starts afresh
+		if len(r.queue) == 0 {
+			if err := os.Remove(r.o.ContinueCrawl); err != nil {
+				r.log.Warn("could not remove crawl journal", "err", err)
+			}
+		}
+	}
+
+	if cut && r.o.StateFile != "" {
+		s := &crawlState{}
+
+		for _, i := range r.queue {
+			s.Frontier = append(s.Frontier, frontierEntry{i.url, i.depth, i.parent, i.hops})
+		}
+
+		for u := range r.seen {
+			s.Seen = append(s.Seen, u)
+		}
+
+		sort.Strings(s.Seen)
+
+		if err := saveState(r.o.StateFile, s); err != nil {
+			r.log.Warn("could not save state", "err", err)
+		} else {
+			r.log.Info("Saved state, run again to carry on", "file", r.o.StateFile)
+		}
+	} else if r.o.StateFile != "" {
+		// finished, so the next run starts afresh
+		if err := os.Remove(r.o.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.log.Warn("could not remove state file", "err", err)
+		}
+	}
+
+	if r.o.FrontierOut != "" {
+		r.queueMu.Lock()
+		r.current = nil
+		r.queueMu.Unlock()
+
+		// empty unless the crawl was cut short by TimeBox, MaxFiles,
+		// Quota, Budget or ctx
+		if err := r.exportFrontier(); err != nil {
+			r.log.Warn("could not export frontier", "err", err)
+		} else if r.ctx.Err() != nil {
+			r.log.Info("Exported frontier", "file", r.o.FrontierOut)
+		}
+	}
+
+	if r.o.VerifyComplete {
+		inScope := func(u *url.URL) bool {
+			if strings.ToLower(u.Host) != r.host {
+				return false
+			}
+
+			for _, re := range r.excludeRE {
+				if re.MatchString(u.String()) {
+					return false
+				}
+			}
+
+			for _, re := range r.includeRE {
+				if re.MatchString(u.String()) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		missing, err := missingLinks(r.dir, r.start.Scheme+":"+r.host, r.types, inScope, r.log)
+		if err != nil {
+			r.log.Warn("could not verify the mirror is complete", "err", err)
+		}
+
+		if len(missing) > 0 {
+			r.log.Warn("mirror is missing linked files", "count", len(missing))
+
+			for _, m := range missing {
+				r.log.Warn("missing", "url", m)
+			}
+		} else if err == nil {
+			r.log.Info("Mirror is complete")
+		}
+	}
+
+	if r.perHost != nil {
+		r.perHost.report(r.out)
+	}
+
+	if len(r.challenges) > 0 {
+		r.log.Warn("got bot challenges instead of pages, which were not saved", "count", len(r.challenges))
+
+		for _, c := range r.challenges {
+			r.log.Warn("bot challenge", "url", c)
+		}
+	}
+
+	if len(r.nearDups) > 0 {
+		r.log.Info("Found near-duplicate pages", "count", len(r.nearDups))
+
+		for _, d := range r.nearDups {
+			r.log.Info("near duplicate", "url", d)
+		}
+	}
+
+	if r.checksums != nil {
+		stored := r.store
+		if stored == nil {
+			stored = dirStorage(r.dir)
+		}
+
+		if err := writeChecksums(r.o.ChecksumManifest, r.dir, r.checksums, stored); err != nil {
+			r.log.Warn("could not write checksum manifest", "err", err)
+		}
+	}
+
+	if r.o.SaveCookies != "" {
+		if err := r.client.Jar.(*cookieJar).save(r.o.SaveCookies); err != nil {
+			r.log.Warn("could not save cookies", "err", err)
+		}
+	}
+
+	// whatever's left, if the crawl was cut short too
+	r.archives.write(r.dir, func(string) bool { return true }, r.log)
+
+	r.summary.finish(time.Since(r.started))
+	r.summary.log(r.log)
+
+	if r.o.SummaryFile != "" {
+		if err := r.summary.write(r.o.SummaryFile); err != nil {
+			r.log.Warn("could not write summary file", "err", err)
+		}
+	}
+
+	if err := context.Cause(r.ctx); err != nil {
+		r.notifyAborted(err.Error())
+		r.events.emit("finished", "", "", err)
+
+		return r.summary.result(len(r.queue)), err
+	}
+
+	if r.o.NotifyURL != "" {
+		if err := notify(r.o.NotifyURL, r.startURL, r.summary, false, ""); err != nil {
+			r.log.Warn("could not notify webhook", "err", err)
+		}
+	}
+
+	r.events.emit("finished", "", "", nil)
+
+	return r.summary.result(len(r.queue)), nil
+}
@@ -0,0 +1,781 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPageRequisites(t *testing.T) {
+	other := newSite(t, map[string]string{
+		"/r.png":  "png",
+		"/p.html": "page",
+	})
+
+	site := newSite(t, map[string]string{
+		"/":         `<img src="` + other.URL + `/r.png"><a href="` + other.URL + `/p.html">p</a><a href="/a.html">a</a>`,
+		"/a.html":   `<img src="/deep.png">`,
+		"/deep.png": "png",
+	})
+
+	for _, c := range []struct {
+		requisites, spanHosts bool
+		remote, deep          bool
+	}{
+		{false, false, false, false},
+		{false, true, true, false},
+		{true, false, true, true},
+		{true, true, true, true},
+	} {
+		t.Run(fmt.Sprintf("requisites=%v,span=%v", c.requisites, c.spanHosts), func(t *testing.T) {
+			o := testOptions(t, site.URL+"/")
+			o.Depth = 1
+			o.PageRequisites = c.requisites
+			o.PageRequisitesSpanHosts = c.spanHosts
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range []struct {
+				url  string
+				want bool
+			}{
+				{site.URL + "/a.html", true},
+				{other.URL + "/r.png", c.remote},
+				{site.URL + "/deep.png", c.deep},
+
+				// only requisites are ever fetched from other hosts
+				{other.URL + "/p.html", false},
+			} {
+				_, err := os.Stat(mirrored(t, o, f.url))
+				if got := err == nil; got != f.want {
+					t.Errorf("%s saved %v, want %v", f.url, got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecrawlRestoresMissing(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":         `<a href="/a.html">a</a> <link rel="stylesheet" href="/s.css">`,
+		"/a.html":   `<a href="/b.html">b</a>`,
+		"/b.html":   `b`,
+		"/s.css":    `body { background: url(bg.png) }`,
+		"/bg.png":   `png`,
+		"/c/d.html": `d`,
+	})
+
+	for _, c := range []struct {
+		name string
+		set  func(*Options)
+	}{
+		{"sizes", func(*Options) {}},
+		{"timestamping", func(o *Options) { o.Timestamping = true }},
+		{"raw", func(o *Options) { o.Raw = true }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			c.set(&o)
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// deleted since, under pages that are up to date
+			for _, p := range []string{"/b.html", "/bg.png"} {
+				if err := os.Remove(mirrored(t, o, s.URL+p)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 2 {
+				t.Errorf("fetched %d files again, want only the 2 missing", res.Fetched)
+			}
+
+			for _, p := range []string{"/b.html", "/bg.png"} {
+				if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+					t.Errorf("not restored: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestNotModifiedFollowed(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	pages := map[string]string{
+		"/":       `<a href="/a.html">a</a>`,
+		"/a.html": `<a href="/b.html">b</a>`,
+		"/b.html": `b`,
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"`+r.URL.Path+`"`)
+		http.ServeContent(w, r, "", modified, strings.NewReader(body))
+	}))
+	defer s.Close()
+
+	for _, c := range []struct {
+		name string
+		set  func(*Options)
+	}{
+		{"newer-only", func(o *Options) { o.Refresh = []string{".*"}; o.NewerOnly = true }},
+		{"store-validators", func(o *Options) { o.StoreValidators = true }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			c.set(&o)
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Remove(mirrored(t, o, s.URL+"/b.html")); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 1 {
+				t.Errorf("fetched %d files again, want only the missing one", res.Fetched)
+			}
+
+			if _, err := os.Stat(mirrored(t, o, s.URL+"/b.html")); err != nil {
+				t.Errorf("not restored: %v", err)
+			}
+		})
+	}
+}
+
+func TestHostsPacedSeparately(t *testing.T) {
+	const wait = 300 * time.Millisecond
+
+	var mu sync.Mutex
+	hits := map[string][]time.Time{}
+
+	newHost := func(name string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name] = append(hits[name], time.Now())
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "text/html")
+
+			if r.URL.Path == "/" {
+				fmt.Fprint(w, `<a href="/1.html">1</a> <a href="/2.html">2</a>`)
+			}
+		}))
+		t.Cleanup(s.Close)
+
+		return s
+	}
+
+	a, b := newHost("a"), newHost("b")
+
+	o := testOptions(t, a.URL+"/")
+	o.URLs = append(o.URLs, b.URL+"/")
+	o.NoRobots = true
+	o.Wait = wait
+	o.Workers = 4
+
+	started := time.Now()
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elapsed := time.Since(started)
+
+	if res.Fetched != 6 {
+		t.Fatalf("fetched %d, want 6", res.Fetched)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for host, at := range hits {
+		for k := 1; k < len(at); k++ {
+			if gap := at[k].Sub(at[k-1]); gap < wait-50*time.Millisecond {
+				t.Errorf("host %s sent requests %v apart, want -wait %v", host, gap, wait)
+			}
+		}
+	}
+
+	// each host waits twice, at the same time as the other rather than
+	// after it
+	if elapsed >= 3*wait {
+		t.Errorf("took %v, want the hosts' waits to overlap", elapsed)
+	}
+}
+
+func TestMaxQueryVariants(t *testing.T) {
+	var mu sync.Mutex
+	variants := map[string]bool{}
+
+	// every listing links to every other combination of its facets
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.URL.Path == "/shop" && r.URL.RawQuery != "" {
+			mu.Lock()
+			variants[r.URL.RawQuery] = true
+			mu.Unlock()
+		}
+
+		for _, color := range []string{"red", "green", "blue"} {
+			for _, size := range []string{"s", "m", "l"} {
+				fmt.Fprintf(w, `<a href="/shop?color=%s&size=%s">%s %s</a> `, color, size, color, size)
+			}
+		}
+
+		fmt.Fprint(w, `<a href="/shop">all</a> <a href="/other?page=1">other</a> <a href="/other?page=2">other</a>`)
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/shop")
+	o.NoRobots = true
+	o.MaxQueryVariants = 4
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(variants) != 4 {
+		t.Errorf("crawled %d query variants of /shop, want 4: %v", len(variants), variants)
+	}
+
+	// /shop itself and the other path's variants are counted apart
+	if res.Fetched != 1+4+2 {
+		t.Errorf("fetched %d, want 7", res.Fetched)
+	}
+}
+
+func TestMaxRedirectRatio(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		redirects bool
+		abort     bool
+	}{
+		{"pages redirect", true, true},
+		// only robots.txt does, which isn't a download
+		{"robots.txt redirects", false, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/robots.txt":
+					http.Redirect(w, r, "/robots/1", http.StatusFound)
+				case r.URL.Path == "/robots/1":
+					http.Redirect(w, r, "/robots/2", http.StatusFound)
+				case r.URL.Path == "/robots/2":
+					w.Header().Set("Content-Type", "text/plain")
+					fmt.Fprint(w, "User-agent: *\nDisallow:\n")
+				case r.URL.Path == "/":
+					w.Header().Set("Content-Type", "text/html")
+					for i := range 12 {
+						fmt.Fprintf(w, `<a href="/p%d">%d</a> `, i, i)
+					}
+				case c.redirects && strings.HasPrefix(r.URL.Path, "/p"):
+					// twice over, by way of /r
+					http.Redirect(w, r, "/r"+r.URL.Path[2:], http.StatusMovedPermanently)
+				case strings.HasPrefix(r.URL.Path, "/r"):
+					http.Redirect(w, r, "/f"+r.URL.Path[2:], http.StatusMovedPermanently)
+				default:
+					w.Header().Set("Content-Type", "text/html")
+					fmt.Fprint(w, "page")
+				}
+			}))
+			defer s.Close()
+
+			o := testOptions(t, s.URL+"/")
+			o.MaxRedirectRatio = 0.1
+			o.Strict = true
+
+			_, err := New(o).Run(context.Background())
+			if c.abort && (err == nil || !strings.Contains(err.Error(), "redirects per download")) {
+				t.Errorf("got %v, want the crawl aborted for its redirects", err)
+			}
+
+			if !c.abort && err != nil {
+				t.Errorf("aborted: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatorsOnHead(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, c := range []struct {
+		name    string
+		touched bool
+		get     bool
+	}{
+		// the size changed but not the date, so only a 304 keeps the copy
+		{"not modified", false, false},
+		{"modified", true, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []string
+			body, lm := "first", modified
+
+			// no ETag, which would make it a conditional GET instead
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.Method+" "+r.Header.Get("If-Modified-Since"))
+				body, lm := body, lm
+				mu.Unlock()
+
+				http.ServeContent(w, r, "data.bin", lm, strings.NewReader(body))
+			}))
+			defer s.Close()
+
+			o := testOptions(t, s.URL+"/data.bin")
+			o.NoRobots = true
+			o.StoreValidators = true
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			requests = nil
+			body = "second, longer"
+			if c.touched {
+				lm = modified.Add(time.Hour)
+			}
+			mu.Unlock()
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(requests) == 0 || requests[0] != "HEAD "+modified.Format(http.TimeFormat) {
+				t.Fatalf("got requests %q, want a HEAD with If-Modified-Since first", requests)
+			}
+
+			if got := len(requests) > 1; got != c.get || (res.Fetched == 1) != c.get {
+				t.Errorf("got requests %q and fetched %d, want a GET %v", requests, res.Fetched, c.get)
+			}
+		})
+	}
+}
+
+func TestRedirectMap(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		case "/c":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/d">d</a>`)
+		case "/d":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "not redirected")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/a")
+	o.NoRobots = true
+	o.RedirectMap = filepath.Join(t.TempDir(), "redirects.jsonl")
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(o.RedirectMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type entry struct {
+		From   string        `json:"from"`
+		To     string        `json:"to"`
+		Status int           `json:"status"`
+		Chain  []redirectHop `json:"chain"`
+	}
+
+	var got []entry
+
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("%q: %v", l, err)
+		}
+
+		got = append(got, e)
+	}
+
+	// only the one chain, /d wasn't redirected
+	want := []entry{{
+		From:   s.URL + "/a",
+		To:     s.URL + "/c",
+		Status: http.StatusMovedPermanently,
+		Chain:  []redirectHop{{s.URL + "/a", http.StatusMovedPermanently}, {s.URL + "/b", http.StatusFound}},
+	}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestBaseArchive(t *testing.T) {
+	var mu sync.Mutex
+	pages := map[string]string{
+		"/":          `<a href="/same.html">same</a> <a href="/grown.html">grown</a> <a href="/edited.html">edited</a>`,
+		"/same.html": "unchanged",
+		// the same size, but not the same bytes
+		"/edited.html": "version 1",
+		"/grown.html":  "short",
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body, ok := pages[r.URL.Path]
+		mu.Unlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}))
+	defer s.Close()
+
+	base := testOptions(t, s.URL+"/")
+	base.NoRobots = true
+
+	if _, err := New(base).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	pages["/"] += ` <a href="/new.html">new</a>`
+	pages["/edited.html"] = "version 2"
+	pages["/grown.html"] = "a good deal longer"
+	pages["/new.html"] = "new"
+	mu.Unlock()
+
+	for _, c := range []struct {
+		name    string
+		refresh []string
+		want    []string
+	}{
+		// an edit that keeps the size is only caught by downloading
+		// it, and comparing it to the copy in the base archive
+		{"size", nil, []string{"/", "/grown.html", "/new.html"}},
+		{"refresh", []string{".*"}, []string{"/", "/edited.html", "/grown.html", "/new.html"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.BaseArchive = base.Dir
+			o.Refresh = c.refresh
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, p := range []string{"/", "/same.html", "/edited.html", "/grown.html", "/new.html"} {
+				_, err := os.Stat(mirrored(t, o, s.URL+p))
+
+				if in := err == nil; in != slices.Contains(c.want, p) {
+					t.Errorf("%s in the delta %v, want %v", p, in, !in)
+				}
+			}
+		})
+	}
+}
+
+func TestIPFSAware(t *testing.T) {
+	const cid = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+
+	var mu sync.Mutex
+	heads := map[string]int{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			mu.Lock()
+			heads[r.URL.Path]++
+			mu.Unlock()
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/ipfs/%s/page.html">immutable</a> <a href="/ipns/example.org/page.html">mutable</a>`, cid)
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.IPFSAware = true
+
+	for range 2 {
+		if _, err := New(o).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the second crawl checks everything but the content addressed file
+	want := map[string]int{"/": 1, "/ipns/example.org/page.html": 1}
+	if !reflect.DeepEqual(heads, want) {
+		t.Errorf("got HEADs %v, want %v", heads, want)
+	}
+}
+
+func TestSeedHops(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":      `<a href="/nav">nav</a>`,
+		"/nav":   `<a href="/d2">straight to d2</a> <a href="/docs/">docs</a>`,
+		"/docs/": `<a href="/d1">d1</a>`,
+		"/d1":    `<a href="/d2">d2</a> <a href="/docs/more">more docs</a>`,
+		"/d2":    `<a href="/d3">d3</a>`,
+		"/d3":    `<a href="/d4">d4</a>`,
+		"/d4":    `the end`,
+		// a seed page of its own, so counting starts over
+		"/docs/more": `<a href="/m1">m1</a>`,
+		"/m1":        `<a href="/m2">m2</a>`,
+		"/m2":        `<a href="/m3">m3</a>`,
+		"/m3":        `too far`,
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.Seed = []string{"/docs/"}
+	o.SeedHops = 2
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rest are only crawled through
+	hops := map[string]int{
+		"/": -1, "/nav": -1,
+		"/docs/": 0, "/d1": 1, "/d2": 2, "/d3": 3, "/d4": 4,
+		"/docs/more": 0, "/m1": 1, "/m2": 2, "/m3": 3,
+	}
+
+	for p, h := range hops {
+		_, err := os.Stat(mirrored(t, o, s.URL+p))
+
+		// /d2 is saved though first found from /nav, before any seed
+		want := h >= 0 && h <= 2
+		if got := err == nil; got != want {
+			t.Errorf("%s, %d hops from a seed, saved %v, want %v", p, h, got, want)
+		}
+	}
+}
+
+func TestCollapseWWW(t *testing.T) {
+	var mu sync.Mutex
+	var hosts map[string]bool
+
+	// a proxy stands in for both hosts, serving the same site on each
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts[r.Host] = true
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="http://example.org/a.html">a</a> <a href="http://www.example.org/b.html">b</a>`)
+		case "/a.html", "/b.html":
+			fmt.Fprint(w, "page")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer proxy.Close()
+
+	for _, c := range []struct {
+		start    string
+		collapse bool
+		host     string
+		want     []string
+	}{
+		{"http://example.org/", true, "example.org", []string{"/", "/a.html", "/b.html"}},
+		{"http://www.example.org/", true, "www.example.org", []string{"/", "/a.html", "/b.html"}},
+		// otherwise the other form is another host
+		{"http://example.org/", false, "example.org", []string{"/", "/a.html"}},
+		{"http://www.example.org/", false, "www.example.org", []string{"/", "/b.html"}},
+	} {
+		t.Run(fmt.Sprintf("%s collapse=%v", c.host, c.collapse), func(t *testing.T) {
+			mu.Lock()
+			hosts = map[string]bool{}
+			mu.Unlock()
+
+			o := testOptions(t, c.start)
+			o.NoRobots = true
+			o.Proxy = proxy.URL
+			o.CollapseWWW = c.collapse
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if want := map[string]bool{c.host: true}; !reflect.DeepEqual(hosts, want) {
+				t.Errorf("requests for %v, want only %s", hosts, c.host)
+			}
+
+			if res.Fetched != len(c.want) {
+				t.Errorf("fetched %d, want %d", res.Fetched, len(c.want))
+			}
+
+			for _, p := range c.want {
+				if _, err := os.Stat(mirrored(t, o, "http://"+c.host+p)); err != nil {
+					t.Errorf("%s not mirrored under %s: %v", p, c.host, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCrossScheme(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+
+	serve := func(scheme string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, scheme+" "+r.URL.Path)
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "text/html")
+
+			if r.URL.Path == "/" {
+				fmt.Fprint(w, `<a href="/a.html">relative</a> <a href="http://example.org/b.html">http</a>`)
+			}
+		}
+	}
+
+	site := httptest.NewTLSServer(serve("https"))
+	defer site.Close()
+
+	// example.org is the site over https, and served by the proxy itself
+	// over http
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			serve("http")(w, r)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", site.Listener.Addr().String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	defer proxy.Close()
+
+	for _, c := range []struct {
+		crossScheme string
+		want        []string
+	}{
+		{"follow", []string{"https /", "https /a.html", "http /b.html"}},
+		{"upgrade", []string{"https /", "https /a.html", "https /b.html"}},
+		{"skip", []string{"https /", "https /a.html"}},
+	} {
+		t.Run(c.crossScheme, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			o := testOptions(t, "https://example.org/")
+			o.NoRobots = true
+			o.Proxy = proxy.URL
+			o.Insecure = true
+			o.CrossScheme = c.crossScheme
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !reflect.DeepEqual(requests, c.want) {
+				t.Errorf("got requests %q, want %q", requests, c.want)
+			}
+
+			// each scheme is mirrored apart
+			for _, r := range c.want {
+				scheme, p, _ := strings.Cut(r, " ")
+
+				if _, err := os.Stat(mirrored(t, o, scheme+"://example.org"+p)); err != nil {
+					t.Errorf("%s not mirrored: %v", r, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,809 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	ErrFailToParseHTML = errors.New("could not parse HTML")
+	ErrDeclined        = errors.New("download declined")
+	ErrSkippedStatus   = errors.New("skipped by OnStatus")
+	ErrChallenge       = errors.New("got a bot challenge page instead of the content")
+	ErrStalled         = errors.New("download stalled")
+	ErrNotFollowed     = errors.New("not following redirect")
+	ErrNotModified     = errors.New("not modified since the last download")
+	ErrChecksum        = errors.New("checksum mismatch")
+)
+
+// stallReader pushes back its timer every time bytes are read through it.
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+
+	return n, err
+}
+
+// newRequest builds a request for url the way every download should be made,
+// and every HEAD checking a download's freshness.
+//
+// With Raw, downloads are kept byte-for-byte as the server sent them.
+// Normally decodeTransport asks for compression behind our back and
+// transparently decompresses it, so what lands on disk isn't what went over
+// the wire; with Raw we ask for it ourselves, which leaves the body
+// untouched, and only decompress the copy read back for link parsing.
+// decodeTransport never asks for compression on a HEAD, so that has to be
+// done here too or the Content-Length of the uncompressed file gets compared
+// to the compressed one on disk.
+func (r *run) newRequest(ctx context.Context, method string, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.o.Raw {
+		req.Header.Set("Accept-Encoding", rawAcceptEncoding)
+	}
+
+	return req, nil
+}
+
+// downloadKey marks the context of the requests fetch sends, as opposed to
+// a HEAD, robots.txt or a sitemap.
+type downloadKey struct{}
+
+// countRedirect is the client's redirect policy; it keeps to MaxRedirects
+// while tallying up the redirects of downloads in redirects, for
+// MaxRedirectRatio, unless NoFollowRedirects makes fetch return
+// ErrNotFollowed for them instead.
+func (r *run) countRedirect(req *http.Request, via []*http.Request) error {
+	if r.o.NoFollowRedirects {
+		return http.ErrUseLastResponse
+	}
+
+	if len(via) >= r.o.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", r.o.MaxRedirects)
+	}
+
+	if req.Context().Value(downloadKey{}) != nil {
+		r.redirects.Add(1)
+	}
+
+	return nil
+}
+
+// statusRetries is how many times a stalled download, one that got a bot
+// challenge with ChallengeWait, or one with a status OnStatus says to retry
+// when Retries is unset, is tried again.
+const statusRetries = 3
+
+// checkFileSize declines a download whose size, as its headers give it, is
+// outside MinFilesize and MaxFilesize.
+func (r *run) checkFileSize(resp *http.Response) error {
+	size := resp.ContentLength
+
+	// resuming or sampling, it's the whole file that counts
+	if resp.StatusCode == http.StatusPartialContent {
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+
+		var err error
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			size = -1
+		}
+	}
+
+	switch {
+	case size < 0:
+		return nil
+	case r.maxFileSize > 0 && size > r.maxFileSize:
+		return fmt.Errorf("%w, %d bytes is over MaxFilesize", ErrDeclined, size)
+	case size < r.minFileSize:
+		return fmt.Errorf("%w, %d bytes is under MinFilesize", ErrDeclined, size)
+	}
+
+	return nil
+}
+
+// link is a reference found in a page. Requisites are the assets needed to
+// render the page (images, stylesheets, scripts) as opposed to other pages.
+type link struct {
+	url       string
+	requisite bool
+	font      bool
+}
+
+// redirectHop is one redirect response on the way to a download.
+type redirectHop struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// redirectChain lists the redirects that led to resp, in the order they
+// were followed, by walking back through each request's Response.
+func redirectChain(resp *http.Response) []redirectHop {
+	hops := []redirectHop{}
+
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		hops = append([]redirectHop{{r.Response.Request.URL.String(), r.Response.StatusCode}}, hops...)
+	}
+
+	return hops
+}
+
+// result is what fetch learnt from a completed download: the SHA-256 of the
+// file as saved and, for HTML documents, what was scraped from them.
+type result struct {
+	status      int
+	proto       string
+	header      http.Header
+	request     *http.Request
+	finalURL    string
+	redirects   []redirectHop
+	sha256      []byte
+	received    int64
+	partial     bool
+	html        bool
+	streamed    bool
+	simhash     uint64
+	links       []link
+	title       string
+	description string
+	base        string
+	canonical   string
+}
+
+// fetch is a hairy multi-pronged function that:
+//
+//   - resumes a GET download from a url to a destination file (using range requests)
+//
+//   - starts a new GET download from a url to a destination file
+//
+//   - if content is html, scrapes for any href/img src links along with the
+//     page title and description and returns them
+//
+//     On failure cases it tries its best to download the file (in particular if trying
+//     to resume), otherwise errors gracefully.
+//
+//     Fresh (non-resumed) downloads are written to a temporary file next to
+//     dest and only renamed over it once the whole body has been copied, so
+//     an interrupted download never leaves a truncated file behind that the
+//     freshness check could mistake for a complete one.
+//
+//     It doesn't retry failed downloads itself, retryable tells the caller
+//     which are worth another go.
+//
+//     With the stored validators of the existing copy in meta, the GET is
+//     made conditional and ErrNotModified returned, leaving dest as it is,
+//     if the server answers 304.
+func (r *run) fetch(url string, dest string, resume bool, meta *fileMeta) (*result, error) {
+	var f *os.File
+	var info os.FileInfo
+	var req *http.Request
+	var resp *http.Response
+	var size int64
+	var destDir string
+	var tmp string
+	var err error
+
+	// hashed as it's written, so the file never needs reading back for it
+	h := sha256.New()
+
+	// -verify md5 needs a digest of its own, sha256 can use h
+	vh := h
+	if r.o.Verify == "md5" {
+		vh = md5.New()
+	}
+
+	hw := io.Writer(h)
+	if vh != h {
+		hw = io.MultiWriter(h, vh)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.WithValue(r.ctx, downloadKey{}, true))
+	defer cancel(nil)
+
+	// the stall timer runs from the moment a request is sent, so a server
+	// that never answers counts as stalled just like one that stops midway
+	stall := time.AfterFunc(math.MaxInt64, func() { cancel(ErrStalled) })
+	defer stall.Stop()
+
+	send := func(req *http.Request) (*http.Response, error) {
+		if r.o.StallTimeout > 0 {
+			stall.Reset(r.o.StallTimeout)
+		}
+
+		r.log.Log(ctx, LevelTrace, "Request", "method", req.Method, "url", req.URL.String(), "headers", req.Header)
+
+		resp, err := r.client.Do(req)
+		if err == nil {
+			r.log.Log(ctx, LevelTrace, "Response", "url", req.URL.String(), "status", resp.Status, "proto", resp.Proto, "headers", resp.Header)
+		}
+
+		return resp, err
+	}
+
+	if !resume {
+		goto dontresume
+	}
+
+	f, err = os.OpenFile(dest, os.O_RDWR, 0666)
+	// if we fail to open the file, try creating anew without resume
+	if err != nil {
+		goto dontresume
+	}
+
+	defer f.Close()
+
+	info, err = f.Stat()
+	if err != nil {
+		f.Close()
+		goto dontresume
+	}
+
+	size = info.Size()
+
+	// hashing what we already have also leaves us at the end of the file,
+	// ready to append the rest
+	_, err = io.Copy(hw, f)
+	if err != nil {
+		f.Close()
+		goto dontresume
+	}
+
+	req, err = r.newRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GET request: %w", err)
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", size))
+
+	resp, err = send(req)
+	if err != nil {
+		if context.Cause(ctx) == ErrStalled {
+			return nil, ErrStalled
+		}
+
+		return nil, fmt.Errorf("failed to do range GET request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		f.Close()
+		goto dontresume
+	}
+
+	if r.decide != nil && !r.decide(url, resp.Header) {
+		return nil, ErrDeclined
+	}
+
+	if err = r.checkFileSize(resp); err != nil {
+		return nil, err
+	}
+
+	if err = r.checkType(resp); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		// If we get a 200 then it's not partial content,
+		// which means the server is not honouring the
+		// range request; reset the file for full download
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to do seek to start of file: %w", err)
+		}
+
+		err = f.Truncate(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to truncate file: %w", err)
+		}
+
+		h.Reset()
+		vh.Reset()
+		size = 0
+	}
+
+	goto copyfile
+
+dontresume:
+
+	req, err = r.newRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GET request: %w", err)
+	}
+
+	if r.o.PartialBytes > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", r.o.PartialBytes-1))
+	}
+
+	if meta != nil {
+		meta.conditional(req)
+	}
+
+	resp, err = send(req)
+	if err != nil {
+		if context.Cause(ctx) == ErrStalled {
+			return nil, ErrStalled
+		}
+
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if meta != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+
+	// challenges often come as a 403 or 503, so look before the status
+	if r.challengeMarkers != nil {
+		br := bufio.NewReaderSize(resp.Body, challengePeek)
+		start, _ := br.Peek(challengePeek)
+
+		if r.isChallenge(resp.Header, start) {
+			return nil, ErrChallenge
+		}
+
+		resp.Body = peekedBody{br, resp.Body}
+	}
+
+	if loc := resp.Header.Get("Location"); r.o.NoFollowRedirects && loc != "" && resp.StatusCode/100 == 3 {
+		return nil, fmt.Errorf("%w to %s", ErrNotFollowed, loc)
+	}
+
+	if resp.StatusCode != http.StatusOK && !(r.o.PartialBytes > 0 && resp.StatusCode == http.StatusPartialContent) {
+		switch r.statusActions[resp.StatusCode] {
+		case "skip":
+			return nil, ErrSkippedStatus
+		case "record":
+		default:
+			return nil, &statusError{resp.StatusCode, resp.Status}
+		}
+	}
+
+	if r.decide != nil && !r.decide(url, resp.Header) {
+		return nil, ErrDeclined
+	}
+
+	if err = r.checkFileSize(resp); err != nil {
+		return nil, err
+	}
+
+	if err = r.checkType(resp); err != nil {
+		return nil, err
+	}
+
+	destDir = filepath.Dir(dest)
+	err = os.MkdirAll(destDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create destination directory %s: %v", destDir, err)
+	}
+
+	if r.o.NoAtomic {
+		f, err = os.Create(dest)
+		if err != nil {
+			return nil, fmt.Errorf("could not create file %s: %v\n", dest, err)
+		}
+	} else {
+		tmp = filepath.Join(destDir, "."+filepath.Base(dest)+".tmp")
+
+		f, err = os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("could not create temporary file %s: %v", tmp, err)
+		}
+	}
+
+	defer f.Close()
+
+copyfile:
+
+	var body io.Reader = resp.Body
+
+	if r.o.StallTimeout > 0 {
+		body = &stallReader{resp.Body, stall, r.o.StallTimeout}
+	}
+
+	if r.limiter != nil {
+		body = throttledReader{body, r.limiter}
+	}
+
+	// a server ignoring the range sends everything, so cut it off ourselves
+	limited := r.o.PartialBytes > 0 && !resume && resp.StatusCode == http.StatusOK
+	if limited {
+		body = io.LimitReader(body, r.o.PartialBytes)
+	}
+
+	// without a Content-Length, a file too large is only found out by
+	// reading one byte more than allowed
+	if r.maxFileSize > 0 {
+		body = io.LimitReader(body, r.maxFileSize-size+1)
+	}
+
+	// shown while it downloads, when stderr is a terminal
+	bar := r.progress.start(url, size, resp.ContentLength)
+	defer r.progress.finish(bar)
+
+	n, err := io.Copy(io.MultiWriter(f, hw), bar.reader(body))
+	if err != nil && context.Cause(ctx) == ErrStalled {
+		err = ErrStalled
+	}
+
+	if err == nil && r.maxFileSize > 0 && size+n > r.maxFileSize {
+		err = fmt.Errorf("%w, more than MaxFilesize of %d bytes", ErrDeclined, r.maxFileSize)
+	}
+
+	if err == nil && size+n < r.minFileSize && !limited {
+		err = fmt.Errorf("%w, %d bytes is under MinFilesize", ErrDeclined, size+n)
+	}
+
+	if err == nil && !limited && resp.ContentLength >= 0 && n != resp.ContentLength {
+		err = fmt.Errorf("short body, got %d of %d bytes: %w", n, resp.ContentLength, io.ErrUnexpectedEOF)
+	}
+
+	if err != nil {
+		if tmp != "" {
+			os.Remove(tmp)
+		}
+
+		if err == ErrStalled {
+			return nil, err
+		}
+
+		if errors.Is(err, ErrDeclined) {
+			if tmp == "" {
+				os.Remove(dest)
+			}
+
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("error doing io copy: %w", err)
+	}
+
+	// samples and error pages kept with -on-status have nothing to match
+	if r.o.Verify != "" && r.o.PartialBytes == 0 && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) {
+		if err = r.verifyDigest(url, resp.Header, !resp.Uncompressed, vh.Sum(nil)); err != nil {
+			if tmp != "" {
+				os.Remove(tmp)
+			} else {
+				os.Remove(dest)
+			}
+
+			return nil, err
+		}
+	}
+
+	if tmp != "" {
+		if err = os.Rename(tmp, dest); err != nil {
+			os.Remove(tmp)
+			return nil, fmt.Errorf("could not move %s into place: %w", dest, err)
+		}
+	}
+
+	res := &result{
+		status:    resp.StatusCode,
+		proto:     resp.Proto,
+		header:    resp.Header,
+		request:   resp.Request,
+		finalURL:  resp.Request.URL.String(),
+		redirects: redirectChain(resp),
+		sha256:    h.Sum(nil),
+		received:  n,
+	}
+
+	if r.o.PartialBytes > 0 && !resume {
+		switch {
+		case limited:
+			res.partial = resp.ContentLength < 0 || resp.ContentLength > n
+		case resp.StatusCode == http.StatusPartialContent:
+			// Content-Range is "bytes 0-999/12345" or "bytes 0-999/*"
+			_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+			size, err := strconv.ParseInt(total, 10, 64)
+			res.partial = err != nil || size > n
+		}
+	}
+
+	// links on error pages recorded with -on-status aren't worth following
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return res, nil
+	}
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+
+	if !strings.HasPrefix(contentType, "text/html") && !strings.HasPrefix(contentType, "text/css") {
+		return res, nil
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("could not reread file for parsing links: %w", err)
+	}
+
+	if err = r.parse(url, f, resp.Header, n, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// parse finds the links in a page or stylesheet of size bytes read from
+// body, as stored, so compressed if header says it was sent that way, and
+// its title and such if it's a page, for res.
+func (r *run) parse(url string, body io.Reader, header http.Header, size int64, res *result) error {
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	isCSS := strings.HasPrefix(contentType, "text/css")
+
+	body = bufio.NewReader(body)
+
+	// with -raw, or from a server compressing without being asked, as
+	// decodeTransport decodes it otherwise
+	zr, err := decompress(header.Get("Content-Encoding"), body)
+	if err != nil {
+		r.log.Warn("kept but could not decompress to find links", "url", url, "err", err)
+		return nil
+	}
+
+	if zr != nil {
+		defer zr.Close()
+
+		body = zr
+	}
+
+	if isCSS {
+		css, err := io.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("could not reread stylesheet: %w", err)
+		}
+
+		res.links = extractCSSLinks(string(css))
+
+		return nil
+	}
+
+	// the parser only reads UTF-8
+	br := bufio.NewReader(body)
+	head, _ := br.Peek(1024)
+	body = br
+
+	if label := htmlCharset(header.Get("Content-Type"), head); label != "" {
+		if decoded, ok := charsetReader(label, br); ok {
+			body = decoded
+		} else {
+			r.log.Warn("can't decode, so links with characters other than ASCII may be wrong", "url", url, "charset", label)
+		}
+	}
+
+	if size > r.o.StreamParseAbove {
+		// too big to comfortably build a document from, near-duplicate
+		// detection has to do without these
+		res.html = true
+		res.streamed = true
+		res.links = []link{}
+
+		// whatever was found before the error is still worth following
+		if err := streamLinks(body, res); err != nil {
+			r.log.Warn("kept but "+ErrFailToParseHTML.Error(), "url", url, "err", err)
+		}
+
+		return nil
+	}
+
+	// the download itself worked, so a page we can't make sense of is
+	// kept, only its links are lost
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		r.log.Warn("kept but "+ErrFailToParseHTML.Error(), "url", url, "err", err)
+		return nil
+	}
+
+	res.html = true
+	res.title = strings.Join(strings.Fields(doc.Find("title").First().Text()), " ")
+	res.description = strings.Join(strings.Fields(doc.Find(`meta[name="description" i]`).First().AttrOr("content", "")), " ")
+	res.base = doc.Find("base[href]").First().AttrOr("href", "")
+	res.canonical = doc.Find(`link[href][rel~="canonical" i]`).First().AttrOr("href", "")
+	res.links = findLinks(doc.Selection)
+
+	if r.o.NoscriptLinks {
+		res.links = append(res.links, noscriptLinks(doc.Selection)...)
+	}
+
+	if r.o.CommentLinks {
+		res.links = append(res.links, commentLinks(doc.Selection)...)
+	}
+
+	if r.o.NearDupThreshold > 0 {
+		doc.Find("script, style, noscript").Remove()
+		res.simhash = simhash(doc.Find("body").Text())
+	}
+
+	return nil
+}
+
+func urlToPath(u string) (string, error) {
+	u2, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+
+	path := u2.Path
+
+	// detect if we're downloading from a root or a directory
+	// and if so, save contents as index.html
+	if len(path) == 0 || path[len(path)-1] == '/' {
+		path = filepath.Join(path, "index.html")
+	}
+
+	// rebase against a faux root directory to remove any relative paths
+	root := url.URL{Path: "/"}
+	canonical, err := root.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	// we will treat query parameters as potential new files
+	// that can be fetched from the filesystem
+	if u2.RawQuery != "" {
+		return canonical.Path + "?" + u2.RawQuery, nil
+	}
+
+	return canonical.Path, nil
+}
+
+// localRef returns a relative URL reference from the mirrored file from to
+// the mirrored file to, for pointing saved documents at local copies.
+func localRef(from string, to string) (string, error) {
+	rel, err := filepath.Rel(filepath.Dir(from), to)
+	if err != nil {
+		return "", err
+	}
+
+	// url.URL escapes a '?' in file names saved from query strings and
+	// guards a leading "https:host" segment with "./" so it isn't
+	// mistaken for a scheme
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String(), nil
+}
+
+// cidPattern matches an IPFS content identifier, either a base58 CIDv0
+// ("Qm...") or a base32 CIDv1 ("bafy...").
+var cidPattern = regexp.MustCompile(`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{50,})$`)
+
+// isImmutableIPFS reports whether u is a gateway URL of the form
+// /ipfs/<cid>/... whose content is addressed by its hash and therefore can
+// never change. /ipns/ paths are recognised but deliberately excluded, as an
+// IPNS name is a mutable pointer that can be republished to new content.
+func isImmutableIPFS(u string) bool {
+	u2, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(u2.Path, "/"), "/")
+
+	for i := 0; i+1 < len(segments); i++ {
+		switch segments[i] {
+		case "ipfs":
+			return cidPattern.MatchString(segments[i+1])
+		case "ipns":
+			return false
+		}
+	}
+
+	return false
+}
+
+// Result is what a crawl did, as summed up by the summary it logs when it
+// ends.
+type Result struct {
+	Fetched    int            // files downloaded
+	Bytes      int64          // bytes downloaded
+	Failures   map[string]int // failed downloads by status code, or "error"
+	Skipped    map[string]int // URLs not downloaded by reason, e.g. "robots.txt"
+	FailedURLs []string       // URLs whose downloads failed, in the order they did
+	Queued     int            // URLs left queued when the crawl was cut short
+	Elapsed    time.Duration
+}
+
+// Crawler mirrors sites as its Options say.
+//
+// Every crawl has state of its own, so any number of Crawlers can run at
+// once, though each one runs a single crawl at a time.
+type Crawler struct {
+	opts Options
+
+	// mu guards running, set while Run is, and active, the crawl in
+	// progress once it's set up
+	mu      sync.Mutex
+	running bool
+	active  *run
+}
+
+// New returns a Crawler crawling as opts say.
+func New(opts Options) *Crawler {
+	return &Crawler{opts: opts}
+}
+
+// Run mirrors the start URLs into the mirror directory, returning once
+// everything in reach is downloaded or the crawl was cut short by TimeBox,
+// MaxFiles, Quota or Budget. It fails on invalid options, files that can't
+// be opened and when Strict aborts the crawl.
+//
+// Cancelling ctx cuts the crawl short too: the downloads in progress are
+// abandoned and queued again, the state saved with StateFile and the
+// frontier exported with FrontierOut. Run then returns the result so far
+// with an error wrapping the cause of the cancellation.
+func (c *Crawler) Run(ctx context.Context) (*Result, error) {
+	r, err := newRun(ctx, c.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	busy := c.running
+	c.running = true
+	c.mu.Unlock()
+
+	if busy {
+		return nil, errors.New("a crawl is already running")
+	}
+
+	defer func() {
+		c.mu.Lock()
+		c.running, c.active = false, nil
+		c.mu.Unlock()
+	}()
+
+	defer r.close()
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.active = r
+	c.mu.Unlock()
+
+	return r.crawl()
+}
+
+// ExportFrontier writes what's left to crawl of the crawl in progress to
+// FrontierOut, like it is when the crawl ends.
+func (c *Crawler) ExportFrontier() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.opts.FrontierOut == "" {
+		return errors.New("FrontierOut is not set")
+	}
+
+	if c.active == nil {
+		return errors.New("no crawl is running")
+	}
+
+	return c.active.exportFrontier()
+}
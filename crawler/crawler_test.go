@@ -0,0 +1,696 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// newSite serves pages, by path, as HTML unless the path has an extension
+// saying otherwise.
+func newSite(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if ext := filepath.Ext(r.URL.Path); ext == "" {
+			w.Header().Set("Content-Type", "text/html")
+		} else if t := mime.TypeByExtension(ext); t != "" {
+			w.Header().Set("Content-Type", t)
+		}
+
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// testOptions are the options of a quiet crawl of start into a temporary
+// directory.
+func testOptions(t *testing.T, start string) Options {
+	t.Helper()
+
+	o := DefaultOptions()
+	o.URLs = []string{start}
+	o.Dir = t.TempDir()
+	o.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	o.Out = io.Discard
+
+	return o
+}
+
+// mirrored returns the path in o.Dir the file at u is saved to.
+func mirrored(t *testing.T, o Options, u string) string {
+	t.Helper()
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := urlToPath(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(o.Dir, pu.Scheme+":"+pu.Host, p)
+}
+
+func TestConcurrentCrawlers(t *testing.T) {
+	sites := []*httptest.Server{
+		newSite(t, map[string]string{
+			"/":       `<a href="/a.html">a</a>`,
+			"/a.html": `<a href="/b.html">b</a>`,
+			"/b.html": `the end`,
+		}),
+		newSite(t, map[string]string{
+			"/":       `<a href="/x.html">x</a> <a href="/y.html">y</a>`,
+			"/x.html": `x`,
+			"/y.html": `y`,
+		}),
+	}
+
+	want := [][]string{{"/", "/a.html", "/b.html"}, {"/", "/x.html", "/y.html"}}
+
+	opts := make([]Options, len(sites))
+	results := make([]*Result, len(sites))
+	errs := make([]error, len(sites))
+
+	var wg sync.WaitGroup
+
+	for n, s := range sites {
+		opts[n] = testOptions(t, s.URL+"/")
+		opts[n].Workers = 2
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[n], errs[n] = New(opts[n]).Run(context.Background())
+		}()
+	}
+
+	wg.Wait()
+
+	for n, s := range sites {
+		if errs[n] != nil {
+			t.Fatalf("crawl of %s: %v", s.URL, errs[n])
+		}
+
+		if results[n].Fetched != len(want[n]) {
+			t.Errorf("crawl of %s fetched %d files, want %d", s.URL, results[n].Fetched, len(want[n]))
+		}
+
+		for _, p := range want[n] {
+			if _, err := os.Stat(mirrored(t, opts[n], s.URL+p)); err != nil {
+				t.Errorf("crawl of %s: %v", s.URL, err)
+			}
+		}
+
+		// neither crawl wandered into the other's mirror
+		entries, err := os.ReadDir(opts[n].Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), strings.TrimPrefix(s.URL, "http://")) {
+			t.Errorf("crawl of %s saved %v", s.URL, entries)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":       `<a href="/a.html">a</a>`,
+		"/a.html": `a`,
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := New(o).Run(ctx); err == nil {
+		t.Fatal("cancelled crawl returned no error")
+	}
+
+	state, err := loadState(o.StateFile)
+	if err != nil || state == nil {
+		t.Fatalf("no state saved: %v", err)
+	}
+
+	if len(state.Frontier) != 1 || state.Frontier[0].URL != s.URL+"/" {
+		t.Errorf("saved frontier %v, want the start URL", state.Frontier)
+	}
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	o := testOptions(t, "http://example.org/")
+	o.Workers = 0
+
+	_, err := New(o).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Workers") {
+		t.Errorf("got %v, want an error naming Workers", err)
+	}
+}
+
+func TestCompressionMatrix(t *testing.T) {
+	// with enough varied text for every encoder to compress it
+	var words []string
+	for i := range 300 {
+		words = append(words, fmt.Sprintf("w%d", i*7919%1000))
+	}
+
+	page := `<html><body><a href="/a.html">a</a>` + strings.Repeat(" padding", 100) + strings.Repeat(strings.Join(words, " "), 3) + `</body></html>`
+
+	compressed := map[string]string{}
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		var b bytes.Buffer
+
+		var zw io.WriteCloser
+		switch encoding {
+		case "gzip":
+			zw = gzip.NewWriter(&b)
+		case "br":
+			zw = brotli.NewWriter(&b)
+		case "zstd":
+			zw, _ = zstd.NewWriter(&b)
+		}
+
+		io.WriteString(zw, page)
+		zw.Close()
+
+		compressed[encoding] = b.String()
+
+		// or the link would be found without decompressing anything
+		if strings.Contains(b.String(), "a.html") {
+			t.Fatalf("the link is in the %s compressed page as it is", encoding)
+		}
+	}
+
+	for _, c := range []struct {
+		encoding string
+		raw      bool
+		stored   bool
+	}{
+		{"", false, false},
+		{"gzip", false, false},
+		{"br", false, false},
+		{"zstd", false, false},
+		{"", true, false},
+		{"gzip", true, true},
+		{"zstd", true, true},
+
+		// never asked for with -raw, as it can't be recognized on disk
+		{"br", true, false},
+	} {
+		t.Run(fmt.Sprintf("encoding=%s,raw=%v", c.encoding, c.raw), func(t *testing.T) {
+			// whether the page was downloaded compressed
+			var sent bool
+
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+
+				body := page
+				if r.URL.Path == "/a.html" {
+					body = "a"
+				}
+
+				if c.encoding != "" && r.URL.Path == "/" && strings.Contains(r.Header.Get("Accept-Encoding"), c.encoding) {
+					w.Header().Set("Content-Encoding", c.encoding)
+					body = compressed[c.encoding]
+					sent = sent || r.Method == "GET"
+				}
+
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+
+				if r.Method != "HEAD" {
+					io.WriteString(w, body)
+				}
+			}))
+			defer s.Close()
+
+			o := testOptions(t, s.URL+"/")
+			o.Raw = c.raw
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := c.encoding != "" && !(c.raw && c.encoding == "br"); sent != want {
+				t.Errorf("page sent compressed %v, want %v", sent, want)
+			}
+
+			// the links are parsed from the decompressed page either way
+			if res.Fetched != 2 {
+				t.Errorf("fetched %d files, want the page and the one it links to", res.Fetched)
+			}
+
+			b, err := os.ReadFile(mirrored(t, o, s.URL+"/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored := string(b) != page; stored != c.stored {
+				t.Errorf("stored compressed %v, want %v", stored, c.stored)
+			}
+
+			// the size on disk agrees with what the freshness HEAD says,
+			// and the links of the page on disk are still followed
+			if err := os.Remove(mirrored(t, o, s.URL+"/a.html")); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err = New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 1 {
+				t.Errorf("fetched %d files again, want only the one deleted", res.Fetched)
+			}
+		})
+	}
+}
+
+func TestDecideVetoes(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<a href="/open.bin">open</a> <a href="/restricted.bin">restricted</a>`)
+		case "/restricted.bin":
+			w.Header().Set("X-Licence", "restricted")
+			io.WriteString(w, "restricted")
+		case "/open.bin":
+			w.Header().Set("X-Licence", "cc-by")
+			io.WriteString(w, "open")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	var asked []string
+
+	o := testOptions(t, s.URL+"/")
+	o.Decide = func(url string, header http.Header) bool {
+		asked = append(asked, url)
+		return header.Get("X-Licence") != "restricted"
+	}
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(asked) != 3 {
+		t.Errorf("Decide was asked about %v, want every download", asked)
+	}
+
+	if _, err := os.Stat(mirrored(t, o, s.URL+"/open.bin")); err != nil {
+		t.Error(err)
+	}
+
+	restricted := mirrored(t, o, s.URL+"/restricted.bin")
+
+	if _, err := os.Stat(restricted); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("vetoed download was saved: %v", err)
+	}
+
+	// nor was anything left of it
+	entries, err := os.ReadDir(filepath.Dir(restricted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "restricted") {
+			t.Errorf("vetoed download left %s", e.Name())
+		}
+	}
+
+	if res.Skipped["declined"] != 1 {
+		t.Errorf("skipped %v, want the vetoed download declined", res.Skipped)
+	}
+}
+
+func TestInterruptedCopy(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/big.bin" {
+			http.NotFound(w, r)
+			return
+		}
+
+		// half the body promised, then the connection drops
+		w.Header().Set("Content-Length", "10000")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, strings.Repeat("x", 5000))
+		w.(http.Flusher).Flush()
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		conn.Close()
+	}))
+	defer s.Close()
+
+	for _, noAtomic := range []bool{false, true} {
+		t.Run(fmt.Sprintf("no-atomic=%v", noAtomic), func(t *testing.T) {
+			o := testOptions(t, s.URL+"/big.bin")
+			o.NoAtomic = noAtomic
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 0 || len(res.FailedURLs) != 1 {
+				t.Errorf("fetched %d and failed %v, want the download failed", res.Fetched, res.FailedURLs)
+			}
+
+			dest := mirrored(t, o, s.URL+"/big.bin")
+
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dest), ".big.bin.tmp")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+
+			info, err := os.Stat(dest)
+
+			if !noAtomic && !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("partial download in place of the file: %v", err)
+			}
+
+			// streamed to the file itself, what was received stays, to
+			// be picked up with Resume
+			if noAtomic && (err != nil || info.Size() != 5000) {
+				t.Errorf("got %v, %v, want the 5000 bytes received", info, err)
+			}
+		})
+	}
+}
+
+func TestPageMetadata(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/": `<html><head><title> Home  page </title>
+<meta name="Description" content="All about us">
+<link rel="canonical" href="/"></head>
+<body><a href="/bare.html">bare</a></body></html>`,
+		"/bare.html": `<p>no head at all</p>`,
+	})
+
+	type page struct {
+		URL         string `json:"url"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Canonical   string `json:"canonical"`
+	}
+
+	want := []page{
+		{s.URL + "/", "Home page", "All about us", "/"},
+		{s.URL + "/bare.html", "", "", ""},
+	}
+
+	// large pages are parsed as they stream in instead
+	for _, streamAbove := range []int64{DefaultOptions().StreamParseAbove, 1} {
+		t.Run(fmt.Sprintf("stream-parse-above=%d", streamAbove), func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			o.PageMetadata = filepath.Join(t.TempDir(), "metadata.jsonl")
+			o.StreamParseAbove = streamAbove
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(o.PageMetadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []page
+
+			for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				var p page
+				if err := json.Unmarshal([]byte(l), &p); err != nil {
+					t.Fatalf("%q: %v", l, err)
+				}
+
+				got = append(got, p)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// mustParse parses the URL s.
+func mustParse(t *testing.T, s string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestStallTimeout(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+
+		w.Header().Set("Content-Length", "10000")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, strings.Repeat("x", 5000))
+		w.(http.Flusher).Flush()
+
+		// the first time, the connection stays open but nothing more comes
+		if first {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+
+			return
+		}
+
+		io.WriteString(w, strings.Repeat("x", 5000))
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/big.bin")
+	o.NoRobots = true
+	o.StallTimeout = 100 * time.Millisecond
+
+	started := time.Now()
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("took %v, want the stalled download given up on", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if requests != 2 || res.Fetched != 1 {
+		t.Errorf("%d requests and fetched %d, want the download retried once", requests, res.Fetched)
+	}
+
+	if info, err := os.Stat(mirrored(t, o, s.URL+"/big.bin")); err != nil || info.Size() != 10000 {
+		t.Errorf("got %v, %v, want the whole 10000 bytes", info, err)
+	}
+}
+
+func TestPartialBytes(t *testing.T) {
+	files := map[string]string{
+		"/big.bin":   strings.Repeat("x", 10000),
+		"/small.bin": "tiny",
+	}
+
+	for _, ranges := range []bool{true, false} {
+		t.Run(fmt.Sprintf("ranges=%v", ranges), func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, ok := files[r.URL.Path]
+				if !ok {
+					w.Header().Set("Content-Type", "text/html")
+					io.WriteString(w, `<a href="/big.bin">big</a> <a href="/small.bin">small</a>`)
+					return
+				}
+
+				// without them, the whole file is sent
+				if !ranges {
+					r.Header.Del("Range")
+				}
+
+				http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(body))
+			}))
+			defer s.Close()
+
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.PartialBytes = 100
+			o.StoreValidators = true
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, c := range []struct {
+				path    string
+				size    int64
+				partial bool
+			}{
+				{"/big.bin", 100, true},
+				{"/small.bin", 4, false},
+			} {
+				dest := mirrored(t, o, s.URL+c.path)
+
+				if info, err := os.Stat(dest); err != nil || info.Size() != c.size {
+					t.Errorf("%s: got %v, %v, want %d bytes", c.path, info, err, c.size)
+				}
+
+				m, err := loadMeta(o.Dir, dest)
+				if err != nil || m == nil || m.Partial != c.partial {
+					t.Errorf("%s: got metadata %+v, %v, want partial %v", c.path, m, err, c.partial)
+				}
+			}
+		})
+	}
+}
+
+func TestIsImmutableIPFS(t *testing.T) {
+	const (
+		v0 = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+		v1 = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	)
+
+	for _, c := range []struct {
+		url  string
+		want bool
+	}{
+		{"https://ipfs.io/ipfs/" + v0 + "/readme.txt", true},
+		{"https://ipfs.io/ipfs/" + v1 + "/", true},
+		{"https://gateway.example.org/sub/ipfs/" + v1 + "/a/b.png?x=1", true},
+		// a name can be pointed at other content
+		{"https://ipfs.io/ipns/docs.ipfs.tech/index.html", false},
+		{"https://ipfs.io/ipns/" + v1 + "/index.html", false},
+		{"https://ipfs.io/ipfs/not-a-cid/readme.txt", false},
+		{"https://ipfs.io/ipfs/" + v0[:20], false},
+		{"https://example.org/ipfs", false},
+		{"https://example.org/docs/" + v0, false},
+	} {
+		if got := isImmutableIPFS(c.url); got != c.want {
+			t.Errorf("isImmutableIPFS(%q) = %v, want %v", c.url, got, c.want)
+		}
+	}
+}
+
+func TestUnparseableHTMLKept(t *testing.T) {
+	// NULs, invalid UTF-8, a tag left open and an attribute running to
+	// the end, with a link among it
+	page := "\x00\x01\x02\xff\xfe<html><body><a href=\"/a.html\">a</a>\x00\x89PNG\r\n\x1a\n<div <p class=\"" + strings.Repeat("\x00\xc3\x28", 1000)
+
+	s := newSite(t, map[string]string{
+		"/":       page,
+		"/a.html": "a",
+	})
+
+	for _, streamAbove := range []int64{DefaultOptions().StreamParseAbove, 1} {
+		t.Run(fmt.Sprintf("stream-parse-above=%d", streamAbove), func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.StreamParseAbove = streamAbove
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 2 || len(res.FailedURLs) != 0 {
+				t.Errorf("fetched %d and failed %v, want the page and its link", res.Fetched, res.FailedURLs)
+			}
+
+			if b, err := os.ReadFile(mirrored(t, o, s.URL+"/")); err != nil || string(b) != page {
+				t.Errorf("page not kept as it was: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, streamAbove := range []int64{DefaultOptions().StreamParseAbove, 1} {
+		t.Run(fmt.Sprintf("stream-parse-above=%d", streamAbove), func(t *testing.T) {
+			var log bytes.Buffer
+
+			o := testOptions(t, "http://example.org/")
+			o.StreamParseAbove = streamAbove
+			o.Logger = slog.New(slog.NewTextHandler(&log, nil))
+
+			r, err := newRun(context.Background(), o)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the copy on disk can't be read back in full
+			body := io.MultiReader(strings.NewReader(`<a href="/a.html">a</a>`), iotest.ErrReader(errors.New("disk gone")))
+
+			var res result
+			if err := r.parse("http://example.org/", body, http.Header{"Content-Type": {"text/html"}}, 100, &res); err != nil {
+				t.Fatalf("got %v, want the page kept", err)
+			}
+
+			if !strings.Contains(log.String(), "kept but "+ErrFailToParseHTML.Error()) {
+				t.Errorf("not warned about:\n%s", log.String())
+			}
+
+			// as it streams in, the links found before the error are kept
+			if streamAbove == 1 && (len(res.links) != 1 || res.links[0].url != "/a.html") {
+				t.Errorf("got links %v, want /a.html", res.links)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	fontFaceRule = regexp.MustCompile(`(?is)@font-face\s*{[^}]*}`)
+	cssURL       = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]*))\s*\)`)
+	cssImport    = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+)
+
+// fontExtensions are the web font formats fetched with -web-fonts.
+var fontExtensions = map[string]bool{
+	".woff":  true,
+	".woff2": true,
+	".ttf":   true,
+	".otf":   true,
+	".eot":   true,
+}
+
+// cssURLValue returns the URL inside a url(...) token matched by cssURL.
+func cssURLValue(m []string) string {
+	return m[1] + m[2] + m[3]
+}
+
+// extractFontURLs returns the font files referenced by the src descriptors
+// of a stylesheet's @font-face rules, as written in the stylesheet.
+func extractFontURLs(css string) []string {
+	urls := []string{}
+
+	for _, rule := range fontFaceRule.FindAllString(css, -1) {
+		for _, m := range cssURL.FindAllStringSubmatch(rule, -1) {
+			u := cssURLValue(m)
+
+			p, _, _ := strings.Cut(u, "?")
+			p, _, _ = strings.Cut(p, "#")
+
+			if fontExtensions[strings.ToLower(path.Ext(p))] {
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	return urls
+}
+
+// extractCSSLinks returns what a stylesheet, or an inline style, refers to as
+// requisites, as written in it: the url(...) values, images and fonts among
+// them, and the stylesheets it @imports. With -web-fonts, the fonts of its
+// @font-face rules are marked as such.
+func extractCSSLinks(css string) []link {
+	fonts := map[string]bool{}
+
+	for _, u := range extractFontURLs(css) {
+		fonts[u] = true
+	}
+
+	links := []link{}
+
+	add := func(u string) {
+		trimmed := strings.TrimSpace(u)
+
+		// data: URLs are inline, and a bare fragment refers to an SVG
+		// element of the document itself
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(strings.ToLower(trimmed), "data:") {
+			return
+		}
+
+		links = append(links, link{u, true, fonts[u]})
+	}
+
+	for _, m := range cssImport.FindAllStringSubmatch(css, -1) {
+		add(m[1] + m[2])
+	}
+
+	for _, m := range cssURL.FindAllStringSubmatch(css, -1) {
+		add(cssURLValue(m))
+	}
+
+	return links
+}
+
+// rewriteCSSURLs passes the URL of every url(...) token in css through fn,
+// replacing the token with one pointing at whatever fn returns.
+func rewriteCSSURLs(css string, fn func(string) string) string {
+	return cssURL.ReplaceAllStringFunc(css, func(token string) string {
+		old := cssURLValue(cssURL.FindStringSubmatch(token))
+
+		if u := fn(old); u != old {
+			return `url("` + u + `")`
+		}
+
+		return token
+	})
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractFontURLs(t *testing.T) {
+	css := `
+@import "other.css";
+body { background: url(/bg.woff.png) }
+.icon { background: url("/sprite.woff") }
+@font-face {
+	font-family: "Body";
+	src: url(/fonts/body.eot?#iefix) format("embedded-opentype"),
+	     url('/fonts/body.woff2?v=2') format("woff2"),
+	     url("https://cdn.example.org/body.TTF") format("truetype"),
+	     url(/fonts/body.svg#body) format("svg");
+}
+@FONT-FACE { font-family: Mono; src: local("Mono"), url( mono.otf ) }
+`
+
+	// not the sprite, which only happens to be named like a font
+	want := []string{"/fonts/body.eot?#iefix", "/fonts/body.woff2?v=2", "https://cdn.example.org/body.TTF", "mono.otf"}
+
+	if got := extractFontURLs(css); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, l := range extractCSSLinks(css) {
+		if l.font != slices.Contains(want, l.url) {
+			t.Errorf("%s marked font %v", l.url, l.font)
+		}
+	}
+}
+
+func TestWebFonts(t *testing.T) {
+	cdn := newSite(t, map[string]string{
+		"/body.woff2": "woff2",
+		"/bg.png":     "png",
+	})
+
+	s := newSite(t, map[string]string{
+		"/":         `<link rel="stylesheet" href="/site.css">`,
+		"/site.css": `@font-face { font-family: Body; src: url(` + cdn.URL + `/body.woff2) format("woff2"), url('/mono.ttf') } body { background: url(` + cdn.URL + `/bg.png) }`,
+		"/mono.ttf": "ttf",
+	})
+
+	for _, webFonts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("web-fonts=%v", webFonts), func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.WebFonts = webFonts
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// the font on the same host is fetched as any requisite is
+			if _, err := os.Stat(mirrored(t, o, s.URL+"/mono.ttf")); err != nil {
+				t.Errorf("/mono.ttf not fetched: %v", err)
+			}
+
+			_, err := os.Stat(mirrored(t, o, cdn.URL+"/body.woff2"))
+			if got := err == nil; got != webFonts {
+				t.Errorf("font from the other host fetched %v, want %v", got, webFonts)
+			}
+
+			// only fonts are fetched from other hosts
+			if _, err := os.Stat(mirrored(t, o, cdn.URL+"/bg.png")); err == nil {
+				t.Error("image from the other host fetched")
+			}
+
+			b, err := os.ReadFile(mirrored(t, o, s.URL+"/site.css"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			local := "../" + filepath.Base(filepath.Dir(mirrored(t, o, cdn.URL+"/"))) + "/body.woff2"
+			if got := strings.Contains(string(b), local); got != webFonts {
+				t.Errorf("stylesheet pointed at %s %v, want %v: %s", local, got, webFonts, b)
+			}
+		})
+	}
+}
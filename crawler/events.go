@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// event is a line of crawl progress written to -event-socket.
+type event struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	URL   string    `json:"url,omitempty"`
+	Path  string    `json:"path,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// eventStream writes events as JSON lines to whoever is reading a named pipe
+// or connected to a Unix socket. Events are dropped rather than holding up
+// the crawl when nobody is reading or the reader falls behind.
+type eventStream struct {
+	log    *slog.Logger
+	path   string
+	fifo   bool
+	events chan []byte
+	done   chan struct{}
+
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// eventWriteTimeout is how long a slow socket reader gets before it's
+// disconnected.
+const eventWriteTimeout = time.Second
+
+// openEventStream writes to path if it's an existing named pipe, and
+// otherwise listens on a Unix socket created at path, logging to logger
+// what goes wrong with it.
+func openEventStream(path string, logger *slog.Logger) (*eventStream, error) {
+	s := &eventStream{
+		log:    logger,
+		path:   path,
+		events: make(chan []byte, 256),
+		done:   make(chan struct{}),
+	}
+
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil && fi.Mode()&os.ModeNamedPipe != 0:
+		s.fifo = true
+	case err == nil && fi.Mode()&os.ModeSocket != 0:
+		// left behind by an earlier crawl
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.fifo {
+		s.ln, err = net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+
+		go s.accept()
+	}
+
+	go s.write()
+
+	return s, nil
+}
+
+func (s *eventStream) accept() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+	}
+}
+
+func (s *eventStream) write() {
+	defer close(s.done)
+
+	var pipe io.WriteCloser
+
+	for line := range s.events {
+		if s.fifo {
+			if pipe == nil {
+				// fails with ENXIO instead of blocking while there's no reader
+				f, err := os.OpenFile(s.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+				if err != nil {
+					continue
+				}
+
+				pipe = f
+			}
+
+			if _, err := pipe.Write(line); err != nil {
+				// the reader went away, look for a new one next time
+				pipe.Close()
+				pipe = nil
+			}
+
+			continue
+		}
+
+		s.mu.Lock()
+		conns := s.conns[:0]
+
+		for _, c := range s.conns {
+			c.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+
+			if _, err := c.Write(line); err != nil {
+				c.Close()
+				continue
+			}
+
+			conns = append(conns, c)
+		}
+
+		s.conns = conns
+		s.mu.Unlock()
+	}
+
+	if pipe != nil {
+		pipe.Close()
+	}
+}
+
+// emit queues an event of type typ, dropping it if the queue is full.
+func (s *eventStream) emit(typ, url, path string, err error) {
+	if s == nil {
+		return
+	}
+
+	e := event{Time: time.Now(), Type: typ, URL: url, Path: path}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	line, merr := json.Marshal(e)
+	if merr != nil {
+		return
+	}
+
+	select {
+	case s.events <- append(line, '\n'):
+	default:
+	}
+}
+
+// close flushes queued events and disconnects any readers.
+func (s *eventStream) close() {
+	if s == nil {
+		return
+	}
+
+	close(s.events)
+	<-s.done
+
+	if s.ln == nil {
+		return
+	}
+
+	s.ln.Close()
+
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.log.Warn("could not remove event socket", "path", s.path, "err", err)
+	}
+}
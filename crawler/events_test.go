@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listening reports whether c's crawl has a reader connected to its event
+// socket.
+func listening(c *Crawler) bool {
+	c.mu.Lock()
+	r := c.active
+	c.mu.Unlock()
+
+	if r == nil || r.events == nil {
+		return false
+	}
+
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	return len(r.events.conns) > 0
+}
+
+func TestEventSocket(t *testing.T) {
+	release := make(chan struct{})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			// nothing happens until the test is reading events
+			<-release
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/a.html">a</a> <a href="/missing.html">missing</a>`))
+		case "/a.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("a"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.EventSocket = filepath.Join(t.TempDir(), "events.sock")
+
+	c := New(o)
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := c.Run(context.Background())
+		done <- err
+	}()
+
+	var conn net.Conn
+	var err error
+
+	for deadline := time.Now().Add(5 * time.Second); conn == nil || !listening(c); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("could not connect to the event socket: %v", err)
+		}
+
+		if conn == nil {
+			conn, err = net.Dial("unix", o.EventSocket)
+		}
+	}
+	defer conn.Close()
+
+	close(release)
+
+	type ev struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	}
+
+	var got []ev
+
+	// the crawl hangs up once it's finished
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		var e event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("%q: %v", sc.Text(), err)
+		}
+
+		if e.Time.IsZero() {
+			t.Errorf("%q has no time", sc.Text())
+		}
+
+		got = append(got, ev{e.Type, e.URL})
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ev{
+		{"got", s.URL + "/"},
+		{"got", s.URL + "/a.html"},
+		{"error", s.URL + "/missing.html"},
+		{"finished", ""},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %+v, want %+v", got, want)
+	}
+}
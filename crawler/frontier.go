@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// frontierEntry is a queued URL in a -frontier-out export, written as one
+// JSON object per line.
+type frontierEntry struct {
+	URL    string `json:"url"`
+	Depth  uint   `json:"depth"`
+	Parent string `json:"parent,omitempty"`
+	Hops   int    `json:"hops"`
+}
+
+// writeFrontier replaces file with entries, going through a temporary file
+// so a reader never sees a partly written frontier.
+func writeFrontier(file string, entries []frontierEntry) error {
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// readFrontier reads a frontier written by writeFrontier.
+func readFrontier(file string) ([]frontierEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var entries []frontierEntry
+
+	dec := json.NewDecoder(f)
+
+	for {
+		var e frontierEntry
+
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+
+		if e.URL == "" {
+			return nil, fmt.Errorf("entry %d has no url", len(entries)+1)
+		}
+
+		entries = append(entries, e)
+	}
+}
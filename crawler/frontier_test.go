@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFrontierFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "frontier.jsonl")
+
+	entries := []frontierEntry{
+		{"https://example.org/", 0, "", -1},
+		{"https://example.org/a?b=c&d=é", 3, "https://example.org/", 2},
+	}
+
+	if err := writeFrontier(file, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readFrontier(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("got %+v, want %+v", got, entries)
+	}
+
+	if err := writeFrontier(file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := readFrontier(file); err != nil || len(got) != 0 {
+		t.Errorf("got %+v, %v, want no entries", got, err)
+	}
+
+	for _, bad := range []string{`{"url": "https://example.org/"} nonsense`, `{"depth": 1}`} {
+		if err := os.WriteFile(file, []byte(bad), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := readFrontier(file); err == nil {
+			t.Errorf("%q read", bad)
+		}
+	}
+}
+
+func TestFrontierRoundTrip(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/b.html">b</a>`,
+		"/a.html": `<a href="/c.html">c</a>`,
+		"/b.html": `b`,
+		"/c.html": `c`,
+	})
+
+	file := filepath.Join(t.TempDir(), "frontier.jsonl")
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.MaxFiles = 1
+	o.FrontierOut = file
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readFrontier(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []frontierEntry{
+		{s.URL + "/a.html", 1, s.URL + "/", -1},
+		{s.URL + "/b.html", 1, s.URL + "/", -1},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("exported %+v, want %+v", got, want)
+	}
+
+	// another crawl starts from there instead of the start URL, in a
+	// mirror of its own, and at the depth the URLs were found at
+	next := testOptions(t, s.URL+"/")
+	next.NoRobots = true
+	next.FrontierIn = file
+	next.Depth = 1
+
+	res, err := New(next).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != 2 {
+		t.Errorf("fetched %d, want the 2 imported", res.Fetched)
+	}
+
+	for p, want := range map[string]bool{"/": false, "/a.html": true, "/b.html": true, "/c.html": false} {
+		_, err := os.Stat(mirrored(t, next, s.URL+p))
+		if got := err == nil; got != want {
+			t.Errorf("%s fetched %v, want %v", p, got, want)
+		}
+	}
+}
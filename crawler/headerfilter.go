@@ -0,0 +1,367 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// headerExpr is a parsed -header-filter expression, evaluated against the
+// headers of a response.
+//
+// The grammar is
+//
+//	expr  = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" expr ")" | name [ op value ]
+//	op    = "==" | "!=" | "~" | "!~" | "<" | "<=" | ">" | ">="
+//
+// where name is a header name, matched case insensitively, and value is a
+// bare word running to the next space, || or && (or a ")" it didn't open),
+// or a double quoted string with Go escapes. A name on its own tests whether the
+// header is present. == and != compare strings case insensitively, ~ and !~
+// match a regular expression and the others compare numbers. Comparisons
+// against a missing header, or against one that isn't a number for the
+// numeric operators, are false.
+type headerExpr interface {
+	eval(h http.Header) bool
+}
+
+type orExpr struct{ l, r headerExpr }
+type andExpr struct{ l, r headerExpr }
+type notExpr struct{ e headerExpr }
+type presentExpr struct{ name string }
+
+type cmpExpr struct {
+	name  string
+	op    string
+	value string
+	num   float64
+	re    *regexp.Regexp
+}
+
+func (e orExpr) eval(h http.Header) bool  { return e.l.eval(h) || e.r.eval(h) }
+func (e andExpr) eval(h http.Header) bool { return e.l.eval(h) && e.r.eval(h) }
+func (e notExpr) eval(h http.Header) bool { return !e.e.eval(h) }
+
+func (e presentExpr) eval(h http.Header) bool {
+	_, ok := h[http.CanonicalHeaderKey(e.name)]
+	return ok
+}
+
+func (e cmpExpr) eval(h http.Header) bool {
+	values, ok := h[http.CanonicalHeaderKey(e.name)]
+	if !ok || len(values) == 0 {
+		return false
+	}
+
+	v := strings.TrimSpace(values[0])
+
+	switch e.op {
+	case "==":
+		return strings.EqualFold(v, e.value)
+	case "!=":
+		return !strings.EqualFold(v, e.value)
+	case "~":
+		return e.re.MatchString(v)
+	case "!~":
+		return !e.re.MatchString(v)
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+
+	switch e.op {
+	case "<":
+		return n < e.num
+	case "<=":
+		return n <= e.num
+	case ">":
+		return n > e.num
+	default:
+		return n >= e.num
+	}
+}
+
+// headerFilterParser is a recursive descent parser over the tokens of an
+// expression.
+type headerFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+// operators are tried longest first so "<=" isn't read as "<".
+var operators = []string{"||", "&&", "==", "!=", "!~", "<=", ">=", "(", ")", "!", "~", "<", ">"}
+
+// comparisons are the operators a value follows.
+var comparisons = []string{"==", "!=", "~", "!~", "<", "<=", ">", ">="}
+
+func tokenizeHeaderFilter(s string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+
+				j++
+			}
+
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+			continue
+
+		case len(tokens) > 0 && slices.Contains(comparisons, tokens[len(tokens)-1]):
+			// a bare value, such as a regexp, runs to the next space, so
+			// it can hold |, ( and ! itself
+			j := bareValueEnd(s, i)
+			tokens = append(tokens, s[i:j])
+			i = j
+			continue
+		}
+
+		op := ""
+		for _, o := range operators {
+			if strings.HasPrefix(s[i:], o) {
+				op = o
+				break
+			}
+		}
+
+		if op != "" {
+			tokens = append(tokens, op)
+			i += len(op)
+			continue
+		}
+
+		j := i
+		for j < len(s) && !strings.ContainsRune(" \t\"()!~<>=|&", rune(s[j])) {
+			j++
+		}
+
+		if j == i {
+			return nil, fmt.Errorf("unexpected `%c` at offset %d", c, i)
+		}
+
+		tokens = append(tokens, s[i:j])
+		i = j
+	}
+
+	return tokens, nil
+}
+
+// bareValueEnd returns where the bare value starting at i in s ends: at a
+// space, at "||" or "&&", or at a ")" closing a parenthesis opened before
+// the value.
+func bareValueEnd(s string, i int) int {
+	depth := 0
+
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case ' ', '\t':
+			return j
+		case '\\':
+			j++
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return j
+			}
+
+			depth--
+		case '|', '&':
+			if depth == 0 && strings.HasPrefix(s[j:], s[j:j+1]+s[j:j+1]) {
+				return j
+			}
+		}
+	}
+
+	return len(s)
+}
+
+// parseHeaderFilter parses a -header-filter expression.
+func parseHeaderFilter(s string) (headerExpr, error) {
+	tokens, err := tokenizeHeaderFilter(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &headerFilterParser{tokens: tokens}
+
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected `%s`", p.tokens[p.pos])
+	}
+
+	return e, nil
+}
+
+func (p *headerFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *headerFilterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *headerFilterParser) or() (headerExpr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.next()
+
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		l = orExpr{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *headerFilterParser) and() (headerExpr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.next()
+
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		l = andExpr{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *headerFilterParser) unary() (headerExpr, error) {
+	switch t := p.next(); {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+
+	case t == "!":
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return notExpr{e}, nil
+
+	case t == "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing `)`")
+		}
+
+		return e, nil
+
+	case !isHeaderName(t):
+		return nil, fmt.Errorf("expected a header name, got `%s`", t)
+
+	default:
+		return p.comparison(t)
+	}
+}
+
+func isHeaderName(t string) bool {
+	for _, r := range t {
+		if r != '-' && r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return t != ""
+}
+
+func (p *headerFilterParser) comparison(name string) (headerExpr, error) {
+	op := p.peek()
+
+	if !slices.Contains(comparisons, op) {
+		return presentExpr{name}, nil
+	}
+
+	p.next()
+
+	value := p.next()
+
+	switch value {
+	case "", "||", "&&", "(", ")", "!", "==", "!=", "~", "!~", "<", "<=", ">", ">=":
+		return nil, fmt.Errorf("expected a value after `%s %s`", name, op)
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s after `%s %s`, backslashes need escaping as in Go", value, name, op)
+		}
+
+		value = unquoted
+	}
+
+	e := cmpExpr{name: name, op: op, value: value}
+
+	switch op {
+	case "~", "!~":
+		re, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile regexp `%s`: %w", value, err)
+		}
+
+		e.re = re
+
+	case "<", "<=", ">", ">=":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("`%s %s` needs a number, got `%s`", name, op, value)
+		}
+
+		e.num = n
+	}
+
+	return e, nil
+}
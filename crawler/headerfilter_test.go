@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeaderFilter(t *testing.T) {
+	h := http.Header{
+		"Content-Type":   {"video/mp4"},
+		"Content-Length": {"20000000"},
+		"X-Robots-Tag":   {"noindex"},
+	}
+
+	for _, c := range []struct {
+		expr string
+		want bool
+	}{
+		{"content-length > 10485760", true},
+		{"content-length <= 10485760", false},
+		{"content-type == VIDEO/MP4", true},
+		{"content-type != video/mp4", false},
+		{"x-robots-tag", true},
+		{"etag", false},
+		{"!etag && x-robots-tag", true},
+		{"etag || content-length >= 20000000", true},
+
+		// bare regexps can hold |, ( and !
+		{"content-type ~ ^(image|video)/", true},
+		{"content-type ~ ^image/|^video/", true},
+		{"x-robots-tag ~ ^no!?index$", true},
+		{"(content-type ~ ^(image|audio)/)", false},
+		{"(content-type ~ ^video/(mp4|webm)$) && content-length > 1", true},
+		{"content-type ~ ^image/||x-robots-tag", true},
+
+		// quoted strings take Go escapes
+		{`content-type == "video/mp4"`, true},
+		{`content-type ~ "^video/\\w+$"`, true},
+		{`x-robots-tag == "no\"index"`, false},
+
+		// a missing header, or one that isn't a number, compares false
+		{"etag == x", false},
+		{"etag != x", false},
+		{"content-type > 1", false},
+	} {
+		e, err := parseHeaderFilter(c.expr)
+		if err != nil {
+			t.Errorf("parseHeaderFilter(%q): %v", c.expr, err)
+			continue
+		}
+
+		if got := e.eval(h); got != c.want {
+			t.Errorf("%q = %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestHeaderFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"content-length >",
+		"content-length > big",
+		"content-type ~ (",
+		`content-type == "unterminated`,
+		`content-type ~ "^\d+$"`,
+		"(etag",
+		"etag)",
+		"etag etag",
+		"== x",
+		"etag && || x",
+	} {
+		if _, err := parseHeaderFilter(expr); err == nil {
+			t.Errorf("parseHeaderFilter(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"net"
+	"strings"
+)
+
+// inDomain reports whether host, which may have a port, is one of domains
+// or a subdomain of one, e.g. cdn.example.org of example.org.
+func inDomain(host string, domains []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	for _, d := range domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
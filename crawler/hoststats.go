@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// hostStats counts what happened with the downloads from one host.
+type hostStats struct {
+	files   int
+	bytes   int64
+	elapsed time.Duration
+	errors  int
+}
+
+func (s *hostStats) average() time.Duration {
+	if n := s.files + s.errors; n > 0 {
+		return s.elapsed / time.Duration(n)
+	}
+
+	return 0
+}
+
+// hostTable collects hostStats by lower-cased host for -host-stats.
+type hostTable map[string]*hostStats
+
+func (t hostTable) get(host string) *hostStats {
+	s := t[host]
+	if s == nil {
+		s = &hostStats{}
+		t[host] = s
+	}
+
+	return s
+}
+
+// report writes a row per host, busiest first, and points out the slowest
+// host and the one with the most errors when there's more than one host.
+func (t hostTable) report(w io.Writer) {
+	hosts := make([]string, 0, len(t))
+	for h := range t {
+		hosts = append(hosts, h)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := t[hosts[i]], t[hosts[j]]
+		if a.files != b.files {
+			return a.files > b.files
+		}
+
+		return hosts[i] < hosts[j]
+	})
+
+	fmt.Fprintf(w, "%-40s %8s %14s %12s %8s\n", "host", "files", "bytes", "avg time", "errors")
+
+	var slowest, failing string
+
+	for _, h := range hosts {
+		s := t[h]
+		fmt.Fprintf(w, "%-40s %8d %14d %12v %8d\n", h, s.files, s.bytes, s.average().Round(time.Millisecond), s.errors)
+
+		if slowest == "" || s.average() > t[slowest].average() {
+			slowest = h
+		}
+
+		if s.errors > 0 && (failing == "" || s.errors > t[failing].errors) {
+			failing = h
+		}
+	}
+
+	if len(hosts) < 2 {
+		return
+	}
+
+	fmt.Fprintf(w, "slowest host: %s (%v per download)\n", slowest, t[slowest].average().Round(time.Millisecond))
+
+	if failing != "" {
+		fmt.Fprintf(w, "most errors: %s (%d)\n", failing, t[failing].errors)
+	}
+}
@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostTableReport(t *testing.T) {
+	table := hostTable{}
+
+	a := table.get("a.example")
+	a.files, a.bytes, a.elapsed, a.errors = 3, 3000, 400*time.Millisecond, 1
+
+	b := table.get("b.example")
+	b.files, b.bytes, b.elapsed = 1, 10, 300*time.Millisecond
+
+	if table.get("a.example") != a {
+		t.Fatal("a host's stats weren't added to")
+	}
+
+	var out bytes.Buffer
+	table.report(&out)
+
+	want := `host                                        files          bytes     avg time   errors
+a.example                                       3           3000        100ms        1
+b.example                                       1             10        300ms        0
+slowest host: b.example (300ms per download)
+most errors: a.example (1)
+`
+
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestHostStats(t *testing.T) {
+	otherPages := map[string]string{
+		"/x.html": "x",
+		"/y.png":  "png",
+		"/z.css":  "body {}",
+	}
+
+	other := newSite(t, otherPages)
+
+	pages := map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/missing.html">missing</a> <a href="` + other.URL + `/x.html">x</a> <img src="` + other.URL + `/y.png"> <link rel="stylesheet" href="` + other.URL + `/z.css">`,
+		"/a.html": "a",
+	}
+
+	s := newSite(t, pages)
+
+	var out bytes.Buffer
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.SpanHosts = true
+	o.Domains = []string{"127.0.0.1"}
+	o.HostStats = true
+	o.Out = &out
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct{ files, bytes, errors int }
+
+	rows := map[string]row{}
+
+	for _, l := range strings.Split(out.String(), "\n") {
+		f := strings.Fields(l)
+		if len(f) != 5 || f[0] == "host" {
+			continue
+		}
+
+		files, _ := strconv.Atoi(f[1])
+		bytes, _ := strconv.Atoi(f[2])
+		errors, _ := strconv.Atoi(f[4])
+		rows[f[0]] = row{files, bytes, errors}
+	}
+
+	size := func(pages map[string]string) (n int) {
+		for _, p := range pages {
+			n += len(p)
+		}
+
+		return n
+	}
+
+	// the 404 counts against the host it came from
+	want := map[string]row{
+		mustParse(t, s.URL).Host:     {2, size(pages), 1},
+		mustParse(t, other.URL).Host: {3, size(otherPages), 0},
+	}
+
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v, from\n%s", rows, want, out.String())
+	}
+
+	if want := "most errors: " + mustParse(t, s.URL).Host + " (1)"; !strings.Contains(out.String(), want) {
+		t.Errorf("%q not in\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,224 @@
+package crawler
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// urlAttrs are the attributes holding a single URL, by element, that link
+// rewriting looks at.
+var urlAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"base":   {"href"},
+	"link":   {"href"},
+	"img":    {"src"},
+	"script": {"src"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"embed":  {"src"},
+	"source": {"src"},
+	"track":  {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+	"form":   {"action"},
+}
+
+// rewriteHTMLLinks copies the HTML in r to w token by token, replacing the
+// values of urlAttrs, and the URLs in srcset attributes, with what fn
+// returns for them. Tags without a changed attribute are copied byte for
+// byte.
+func rewriteHTMLLinks(r io.Reader, w io.Writer, fn func(string) string) error {
+	z := xhtml.NewTokenizer(r)
+
+	for {
+		tt := z.Next()
+
+		if tt == xhtml.ErrorToken {
+			if z.Err() == io.EOF {
+				return nil
+			}
+
+			return z.Err()
+		}
+
+		raw := z.Raw()
+
+		if tt != xhtml.StartTagToken && tt != xhtml.SelfClosingTagToken {
+			if _, err := w.Write(raw); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Raw is only valid until the next call on the tokenizer
+		raw = append([]byte(nil), raw...)
+
+		name, hasAttr := z.TagName()
+		tag := string(name)
+		attrs := urlAttrs[tag]
+
+		var b strings.Builder
+		changed := false
+
+		b.WriteString("<" + tag)
+
+		for hasAttr {
+			var k, v []byte
+			k, v, hasAttr = z.TagAttr()
+			key, val := string(k), string(v)
+
+			for _, a := range attrs {
+				if key == a {
+					if nv := fn(val); nv != val {
+						val = nv
+						changed = true
+					}
+				}
+			}
+
+			if key == "srcset" && (tag == "img" || tag == "source") {
+				if nv := rewriteSrcset(val, fn); nv != val {
+					val = nv
+					changed = true
+				}
+			}
+
+			b.WriteString(" " + key + `="` + html.EscapeString(val) + `"`)
+		}
+
+		if tt == xhtml.SelfClosingTagToken {
+			b.WriteString("/")
+		}
+
+		b.WriteString(">")
+
+		if changed {
+			raw = []byte(b.String())
+		}
+
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// rewriteHTMLFile applies rewriteHTMLLinks to the file at path, replacing it
+// only if something changed. It reports whether it did.
+func rewriteHTMLFile(path string, fn func(string) string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+
+	out, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	bw := bufio.NewWriter(out)
+
+	err = rewriteHTMLLinks(bufio.NewReader(f), bw, func(u string) string {
+		nu := fn(u)
+		changed = changed || nu != u
+		return nu
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil || !changed {
+		os.Remove(tmp)
+		return false, err
+	}
+
+	return true, os.Rename(tmp, path)
+}
+
+// rootRelative returns link as a root-relative URL if it's an absolute or
+// scheme-relative URL of the same scheme and host as page, which saved
+// under the same "scheme:host" directory can be served from a web root.
+func rootRelative(page *url.URL, link string) string {
+	trimmed := strings.TrimSpace(link)
+
+	u, err := url.Parse(trimmed)
+	if err != nil || u.Host == "" || u.User != nil {
+		return link
+	}
+
+	if u.Scheme == "" {
+		u.Scheme = page.Scheme
+	}
+
+	if !strings.EqualFold(u.Scheme, page.Scheme) || !strings.EqualFold(u.Host, page.Host) {
+		return link
+	}
+
+	u.Scheme = ""
+	u.Host = ""
+
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	return u.String()
+}
+
+// convertLink points link, found in the mirrored file from that was
+// downloaded from page, at the local copy of what it links to if there is
+// one, and otherwise at its absolute URL so it still works from the mirror,
+// like wget -k. resolved holds the URLs the crawl resolved links to, which
+// urlPaths is keyed by; links it doesn't have are resolved against page.
+func convertLink(from string, page *url.URL, link string, resolved map[string]string, urlPaths map[string]string) string {
+	trimmed := strings.TrimSpace(link)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return link
+	}
+
+	ref, err := url.Parse(trimmed)
+	if err != nil {
+		return link
+	}
+
+	abs := page.ResolveReference(ref)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return link
+	}
+
+	target, ok := resolved[link]
+	if !ok {
+		u := *abs
+		u.Fragment, u.RawFragment = "", ""
+		target = u.String()
+	}
+
+	if local, ok := urlPaths[target]; ok {
+		if rel, err := localRef(from, local); err == nil {
+			if abs.Fragment != "" {
+				rel += "#" + abs.EscapedFragment()
+			}
+
+			return rel
+		}
+	}
+
+	return abs.String()
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// hasRel reports whether the space separated rel attribute contains any
+// of the wanted link types.
+func hasRel(rel string, wanted ...string) bool {
+	for _, r := range strings.Fields(rel) {
+		for _, w := range wanted {
+			if strings.EqualFold(r, w) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// streamLinks fills in res from the HTML in r the same way fetch does with
+// goquery, but only ever holding a single token in memory.
+func streamLinks(r io.Reader, res *result) error {
+	z := html.NewTokenizer(r)
+
+	inTitle := false
+	inStyle := false
+	var title strings.Builder
+	haveTitle := false
+	haveDescription := false
+
+	for {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				res.title = strings.Join(strings.Fields(title.String()), " ")
+				return nil
+			}
+
+			return z.Err()
+
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+
+			if inStyle {
+				res.links = append(res.links, extractCSSLinks(string(z.Text()))...)
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if atom.Lookup(name) == atom.Title && inTitle {
+				inTitle = false
+				haveTitle = true
+			}
+
+			if atom.Lookup(name) == atom.Style {
+				inStyle = false
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := atom.Lookup(name)
+
+			if tag == atom.Title && !haveTitle && tt == html.StartTagToken {
+				inTitle = true
+			}
+
+			if tag == atom.Style && tt == html.StartTagToken {
+				inStyle = true
+			}
+
+			attrs := map[string]string{}
+
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+
+				// the first of a repeated attribute wins, as when parsing
+				if _, ok := attrs[string(k)]; !ok {
+					attrs[string(k)] = string(v)
+				}
+			}
+
+			if style, ok := attrs["style"]; ok {
+				res.links = append(res.links, extractCSSLinks(style)...)
+			}
+
+			switch tag {
+			case atom.A:
+				if href, ok := attrs["href"]; ok && !strings.HasPrefix(href, "mailto:") {
+					res.links = append(res.links, link{href, false, false})
+				}
+
+			case atom.Img, atom.Script, atom.Source, atom.Video, atom.Audio, atom.Track, atom.Embed, atom.Iframe, atom.Frame:
+				if src, ok := attrs["src"]; ok {
+					res.links = append(res.links, link{src, true, false})
+				}
+
+				if srcset, ok := attrs["srcset"]; ok && (tag == atom.Img || tag == atom.Source) {
+					for _, u := range srcsetURLs(srcset) {
+						res.links = append(res.links, link{u, true, false})
+					}
+				}
+
+				if poster, ok := attrs["poster"]; ok && tag == atom.Video {
+					res.links = append(res.links, link{poster, true, false})
+				}
+
+			case atom.Link:
+				if href, ok := attrs["href"]; ok && hasRel(attrs["rel"], "stylesheet", "icon") {
+					res.links = append(res.links, link{href, true, false})
+				}
+
+				if href, ok := attrs["href"]; ok && hasRel(attrs["rel"], "canonical") && res.canonical == "" {
+					res.canonical = href
+				}
+
+			case atom.Base:
+				if href, ok := attrs["href"]; ok && res.base == "" {
+					res.base = href
+				}
+
+			case atom.Meta:
+				if strings.EqualFold(attrs["http-equiv"], "refresh") {
+					if u := metaRefreshURL(attrs["content"]); u != "" {
+						res.links = append(res.links, link{u, false, false})
+					}
+				}
+
+				if !haveDescription && strings.EqualFold(attrs["name"], "description") {
+					res.description = strings.Join(strings.Fields(attrs["content"]), " ")
+					haveDescription = true
+				}
+			}
+		}
+	}
+}
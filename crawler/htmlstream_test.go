@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestStreamLinksLikeGoquery(t *testing.T) {
+	page := `<html><head><title>The
+	page</title>
+<meta name="description" content="about  it">
+<link rel="canonical" href="/canonical">
+<link rel="stylesheet" href="/s.css"><link rel="icon" href="/favicon.ico">
+<meta http-equiv="refresh" content="5; url=/refreshed">
+<base href="/base/">
+<style>body { background: url(/bg.png) }</style></head>
+<body><a href="/a">a</a> <a href="mailto:me@example.org">me</a>
+<img src="/i.png" srcset="/i-2x.png 2x, /i-3x.png 3x">
+<div style="background: url('/div.png')"></div>
+<video src="/v.mp4" poster="/poster.jpg"><track src="/t.vtt"></video>
+<script src="/s.js"></script><iframe src="/frame"></iframe>
+</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := findLinks(doc.Selection)
+
+	var res result
+	if err := streamLinks(strings.NewReader(page), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	// the order they're found in doesn't matter
+	byURL := func(a, b link) int { return strings.Compare(a.url, b.url) }
+	slices.SortFunc(want, byURL)
+	slices.SortFunc(res.links, byURL)
+
+	if !reflect.DeepEqual(res.links, want) {
+		t.Errorf("got links %v, want %v", res.links, want)
+	}
+
+	if res.title != "The page" || res.description != "about it" || res.canonical != "/canonical" || res.base != "/base/" {
+		t.Errorf("got title %q, description %q, canonical %q and base %q", res.title, res.description, res.canonical, res.base)
+	}
+}
+
+func TestStreamParseLargePage(t *testing.T) {
+	filler := "<p>" + strings.Repeat("filler text ", 100) + "</p>\n"
+
+	// 4MB, with links at the start, in the middle and at the very end
+	var b strings.Builder
+	b.WriteString(`<html><body><a href="/first.html">first</a>`)
+
+	for b.Len() < 2<<20 {
+		b.WriteString(filler)
+	}
+
+	b.WriteString(`<img src="/middle.png">`)
+
+	for b.Len() < 4<<20 {
+		b.WriteString(filler)
+	}
+
+	b.WriteString(`<a href="/last.html">last</a></body></html>`)
+
+	s := newSite(t, map[string]string{
+		"/":           b.String(),
+		"/first.html": "first",
+		"/middle.png": "png",
+		"/last.html":  "last",
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.StreamParseAbove = 1 << 20
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != 4 {
+		t.Errorf("fetched %d, want the page and the 3 files it links to", res.Fetched)
+	}
+
+	for _, p := range []string{"/first.html", "/middle.png", "/last.html"} {
+		if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+			t.Errorf("%s not followed: %v", p, err)
+		}
+	}
+}
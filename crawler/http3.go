@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3HandshakeTimeout is how long a QUIC handshake is given, without a
+// ConnectTimeout, before a host is taken not to speak HTTP/3.
+const http3HandshakeTimeout = 3 * time.Second
+
+// http3Transport sends the requests for https URLs over HTTP/3, falling back
+// to base, with HTTP/2 or HTTP/1.1, for the rest of the crawl for hosts no
+// QUIC connection can be made to, e.g. because they don't listen on UDP or
+// it's blocked on the way.
+type http3Transport struct {
+	base http.RoundTripper
+	h3   *http3.Transport
+	log  *slog.Logger
+
+	mu sync.Mutex
+
+	// tcp has the hosts, as host:port, that are only sent requests
+	// through base
+	tcp map[string]bool
+}
+
+// dialError is a failure to make a QUIC connection, as opposed to one of a
+// request sent over it.
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string { return e.err.Error() }
+func (e *dialError) Unwrap() error { return e.err }
+
+func newHTTP3Transport(base http.RoundTripper, tlsConfig *tls.Config, connectTimeout, readTimeout time.Duration, log *slog.Logger) *http3Transport {
+	config := &quic.Config{
+		HandshakeIdleTimeout: cmp.Or(connectTimeout, http3HandshakeTimeout),
+		MaxIdleTimeout:       readTimeout,
+	}
+
+	dial := func(ctx context.Context, addr string, tlsConfig *tls.Config, config *quic.Config) (*quic.Conn, error) {
+		conn, err := quic.DialAddrEarly(ctx, addr, tlsConfig, config)
+		if err != nil {
+			return nil, &dialError{err}
+		}
+
+		return conn, nil
+	}
+
+	return &http3Transport{
+		base: base,
+		h3:   &http3.Transport{TLSClientConfig: tlsConfig, QUICConfig: config, Dial: dial},
+		log:  log,
+		tcp:  map[string]bool{},
+	}
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.base.RoundTrip(req)
+	}
+
+	host := hostPort(req.URL.Scheme, req.URL.Host)
+
+	t.mu.Lock()
+	tcp := t.tcp[host]
+	t.mu.Unlock()
+
+	if tcp {
+		return t.base.RoundTrip(req)
+	}
+
+	resp, err := t.h3.RoundTrip(req)
+
+	var de *dialError
+	if err == nil || !errors.As(err, &de) || req.Context().Err() != nil {
+		return resp, err
+	}
+
+	t.mu.Lock()
+	t.tcp[host] = true
+	t.mu.Unlock()
+
+	t.log.Info("no HTTP/3, falling back to TCP", "host", host, "err", de.err)
+
+	// nothing was sent, but the body may have been closed on the way
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// close closes the QUIC connections.
+func (t *http3Transport) close() {
+	t.h3.Close()
+}
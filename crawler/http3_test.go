@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTPSSite serves pages over HTTP/2, and over HTTP/3 on the same port if
+// quic is set, returning the server and the protocols requests came in with
+// by path.
+func newHTTPSSite(t *testing.T, pages map[string]string, quic bool) (*httptest.Server, func() map[string]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	protos := map[string]string{}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos[r.URL.Path] = r.Proto
+		mu.Unlock()
+
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, body)
+	})
+
+	s := httptest.NewUnstartedServer(handler)
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	if quic {
+		conn, err := net.ListenPacket("udp", s.Listener.Addr().String())
+		if err != nil {
+			t.Skipf("can't listen for QUIC on the server's port: %v", err)
+		}
+
+		h3 := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(s.TLS)}
+		go h3.Serve(conn)
+
+		t.Cleanup(func() {
+			h3.Close()
+			conn.Close()
+		})
+	}
+
+	return s, func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return protos
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	pages := map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/b.html">b</a>`,
+		"/a.html": "a",
+		"/b.html": "b",
+	}
+
+	for _, c := range []struct {
+		name  string
+		quic  bool
+		proto string
+	}{
+		{"quic", true, "HTTP/3.0"},
+		{"fallback", false, "HTTP/2.0"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s, protos := newHTTPSSite(t, pages, c.quic)
+
+			o := testOptions(t, s.URL+"/")
+			o.HTTP3 = true
+			o.Insecure = true
+			o.NoRobots = true
+			o.ConnectTimeout = 500 * time.Millisecond
+
+			started := time.Now()
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 3 {
+				t.Fatalf("fetched %d, want 3", res.Fetched)
+			}
+
+			for p := range pages {
+				if got := protos()[p]; got != c.proto {
+					t.Errorf("%s fetched over %s, want %s", p, got, c.proto)
+				}
+
+				if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+					t.Errorf("not saved: %v", err)
+				}
+			}
+
+			// the host is only given up on over QUIC once
+			if elapsed := time.Since(started); elapsed > 2*o.ConnectTimeout {
+				t.Errorf("took %v, want one failed handshake at most", elapsed)
+			}
+		})
+	}
+}
+
+func TestHTTP3Proxy(t *testing.T) {
+	o := testOptions(t, "https://example.org/")
+	o.HTTP3 = true
+	o.Proxy = "http://127.0.0.1:3128"
+
+	if _, err := New(o).Run(context.Background()); err == nil {
+		t.Error("HTTP3 with a Proxy was accepted")
+	}
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// originalSuffix is appended to the name of an optimized image to keep the
+// bytes as they were downloaded with -keep-original-images.
+const originalSuffix = ".orig"
+
+// optimizeImage re-encodes the JPEG or PNG at path, JPEGs at the given
+// quality and PNGs with the best compression, replacing it when that makes
+// it smaller. It returns how many bytes were saved, which is 0 for other
+// formats, including GIFs and animated PNGs, whose frames past the first
+// would be lost.
+func optimizeImage(path string, contentType string, quality int, keepOriginal bool) (int64, error) {
+	var encode func(b *bytes.Buffer, img image.Image) error
+
+	switch mediaType(contentType) {
+	case "image/jpeg":
+		encode = func(b *bytes.Buffer, img image.Image) error {
+			return jpeg.Encode(b, img, &jpeg.Options{Quality: quality})
+		}
+	case "image/png":
+		encode = func(b *bytes.Buffer, img image.Image) error {
+			enc := png.Encoder{CompressionLevel: png.BestCompression}
+			return enc.Encode(b, img)
+		}
+	default:
+		return 0, nil
+	}
+
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if isAnimatedPNG(orig) {
+		return 0, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(orig))
+	if err != nil {
+		return 0, err
+	}
+
+	var b bytes.Buffer
+
+	if err = encode(&b, img); err != nil {
+		return 0, err
+	}
+
+	if b.Len() >= len(orig) {
+		return 0, nil
+	}
+
+	if keepOriginal {
+		if err = os.WriteFile(path+originalSuffix, orig, 0666); err != nil {
+			return 0, err
+		}
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+
+	if err = os.WriteFile(tmp, b.Bytes(), 0666); err != nil {
+		return 0, err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	return int64(len(orig) - b.Len()), nil
+}
+
+// isAnimatedPNG reports whether b is an APNG, which has an acTL chunk ahead
+// of its image data.
+func isAnimatedPNG(b []byte) bool {
+	const signature = "\x89PNG\r\n\x1a\n"
+
+	if !bytes.HasPrefix(b, []byte(signature)) {
+		return false
+	}
+
+	// each chunk is its length, type, data and CRC
+	for b = b[len(signature):]; len(b) >= 8; {
+		length, typ := binary.BigEndian.Uint32(b), string(b[4:8])
+
+		switch typ {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+
+		if uint64(length)+12 > uint64(len(b)) {
+			return false
+		}
+
+		b = b[length+12:]
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// noise is an image of random pixels, which compresses poorly.
+func noise(size int) image.Image {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for i := range img.Pix {
+		img.Pix[i] = byte(rnd.Intn(256))
+	}
+
+	return img
+}
+
+func TestOptimizeImages(t *testing.T) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, noise(512), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	big := b.String()
+
+	s := newSite(t, map[string]string{
+		"/":        `<img src="/big.jpg">`,
+		"/big.jpg": big,
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.OptimizeImages = true
+	o.KeepOriginalImages = true
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := mirrored(t, o, s.URL+"/big.jpg")
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) >= len(big) {
+		t.Errorf("got %d bytes, want fewer than the %d downloaded", len(got), len(big))
+	}
+
+	if _, err := jpeg.Decode(bytes.NewReader(got)); err != nil {
+		t.Errorf("not a JPEG: %v", err)
+	}
+
+	if orig, err := os.ReadFile(dest + originalSuffix); err != nil || string(orig) != big {
+		t.Errorf("original not kept: %v", err)
+	}
+}
+
+// withChunk returns the PNG p with a chunk of typ added after its header.
+func withChunk(p []byte, typ string, data []byte) []byte {
+	// the signature and the IHDR chunk, whose data is 13 bytes
+	const header = 8 + 12 + 13
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	return append(append(append([]byte{}, p[:header]...), chunk...), p[header:]...)
+}
+
+func TestAnimatedPNGKept(t *testing.T) {
+	// a flat image stored uncompressed, which re-encoding would shrink
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+
+	var b bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := enc.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		chunk    string
+		animated bool
+	}{
+		{"still", "tEXt", false},
+		{"animated", "acTL", true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := withChunk(b.Bytes(), c.chunk, []byte{0, 0, 0, 2, 0, 0, 0, 0})
+
+			if got := isAnimatedPNG(p); got != c.animated {
+				t.Errorf("isAnimatedPNG = %v, want %v", got, c.animated)
+			}
+
+			path := filepath.Join(t.TempDir(), "i.png")
+			if err := os.WriteFile(path, p, 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := optimizeImage(path, "image/png", 80, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (saved == 0) != c.animated {
+				t.Errorf("saved %d bytes, want it left alone only if animated", saved)
+			}
+		})
+	}
+}
+
+func TestIsAnimatedPNGTruncated(t *testing.T) {
+	for _, b := range [][]byte{
+		nil,
+		[]byte("GIF89a"),
+		[]byte("\x89PNG\r\n\x1a\n"),
+		[]byte("\x89PNG\r\n\x1a\n\xff\xff\xff\xffIHDR"),
+	} {
+		if isAnimatedPNG(b) {
+			t.Errorf("%q taken for an animated PNG", b)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+)
+
+// crawlIndex is the -index file, a CSV row for every URL fetched that can be
+// queried as it is or loaded into SQLite with
+//
+//	sqlite3 crawl.db '.import --csv index.csv urls'
+//
+// A nil *crawlIndex records nothing.
+type crawlIndex struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func createIndex(file string) (*crawlIndex, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &crawlIndex{f, csv.NewWriter(f)}
+	x.w.Write([]string{"url", "status", "content_type", "size", "sha256", "path", "fetched_at"})
+
+	return x, nil
+}
+
+// add records a fetch of url; path is relative to the mirror, and empty for
+// pages only crawled through or URLs that failed.
+func (x *crawlIndex) add(url string, status int, contentType string, size int64, sum []byte, path string, at time.Time) {
+	if x == nil {
+		return
+	}
+
+	x.w.Write([]string{
+		url,
+		strconv.Itoa(status),
+		contentType,
+		strconv.FormatInt(size, 10),
+		hex.EncodeToString(sum),
+		path,
+		at.UTC().Format(time.RFC3339),
+	})
+}
+
+func (x *crawlIndex) close() error {
+	if x == nil {
+		return nil
+	}
+
+	x.w.Flush()
+
+	if err := x.w.Error(); err != nil {
+		x.f.Close()
+		return err
+	}
+
+	return x.f.Close()
+}
@@ -0,0 +1,203 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journalSync is how often the journal is flushed and synced to disk, so a
+// crash loses at most that much progress.
+const journalSync = 5 * time.Second
+
+// journal is an append-only log of a crawl's progress for -continue-crawl,
+// one JSON record per line for every URL queued and every URL done with.
+// A nil *journal records nothing.
+type journal struct {
+	f    *os.File
+	w    *bufio.Writer
+	last time.Time
+}
+
+type journalRecord struct {
+	Queued *frontierEntry `json:"queued,omitempty"`
+	Seen   string         `json:"seen,omitempty"`
+}
+
+// openJournal replays the journal in file into the state it left the crawl
+// in, nil if there's no journal yet, and opens it to carry on recording. A
+// replayed journal is first rewritten to only what's still needed. Lines
+// that can't be read are warned about to logger.
+func openJournal(file string, logger *slog.Logger) (*journal, *crawlState, error) {
+	state, err := replayJournal(file, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if state != nil {
+		if err = compactJournal(file, state); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &journal{f: f, w: bufio.NewWriter(f), last: time.Now()}, state, nil
+}
+
+// replayJournal reads a journal back: the URLs queued but never done with,
+// in the order they were queued, make up the frontier.
+func replayJournal(file string, logger *slog.Logger) (*crawlState, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var queued []frontierEntry
+	seen := map[string]bool{}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+
+	for n := 1; s.Scan(); n++ {
+		var r journalRecord
+
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			// the last line may have been cut short by a crash
+			logger.Warn("ignoring unreadable line", "line", n, "file", file)
+			continue
+		}
+
+		if r.Queued != nil {
+			queued = append(queued, *r.Queued)
+		}
+
+		if r.Seen != "" {
+			seen[r.Seen] = true
+		}
+	}
+
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(queued) == 0 && len(seen) == 0 {
+		return nil, nil
+	}
+
+	state := &crawlState{}
+	frontier := map[string]bool{}
+
+	for _, e := range queued {
+		if !seen[e.URL] && !frontier[e.URL] {
+			frontier[e.URL] = true
+			state.Frontier = append(state.Frontier, e)
+		}
+	}
+
+	for u := range seen {
+		state.Seen = append(state.Seen, u)
+	}
+
+	return state, nil
+}
+
+// compactJournal replaces the journal with one recording just state.
+func compactJournal(file string, state *crawlState) error {
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for _, u := range state.Seen {
+		if err == nil {
+			err = enc.Encode(journalRecord{Seen: u})
+		}
+	}
+
+	for i := range state.Frontier {
+		if err == nil {
+			err = enc.Encode(journalRecord{Queued: &state.Frontier[i]})
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+func (j *journal) queued(e frontierEntry) {
+	j.record(journalRecord{Queued: &e})
+}
+
+func (j *journal) seen(u string) {
+	j.record(journalRecord{Seen: u})
+}
+
+func (j *journal) record(r journalRecord) {
+	if j == nil {
+		return
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	j.w.Write(append(data, '\n'))
+
+	if time.Since(j.last) >= journalSync {
+		j.sync()
+	}
+}
+
+func (j *journal) sync() {
+	if err := j.w.Flush(); err == nil {
+		j.f.Sync()
+	}
+
+	j.last = time.Now()
+}
+
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.sync()
+
+	return j.f.Close()
+}
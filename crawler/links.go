@@ -0,0 +1,223 @@
+package crawler
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// findLinks returns the links fetch follows from the elements under s:
+// anchors and meta refresh targets to pages, and as requisites images (every candidate of a srcset
+// too), scripts, stylesheets, icons, media, frames and what inline styles
+// refer to.
+func findLinks(s *goquery.Selection) []link {
+	links := []link{}
+
+	s.Find("a[href]").Each(func(index int, item *goquery.Selection) {
+		href, _ := item.Attr("href")
+		if !strings.HasPrefix(href, "mailto:") {
+			links = append(links, link{href, false, false})
+		}
+	})
+
+	s.Find(`meta[http-equiv="refresh" i][content]`).Each(func(index int, item *goquery.Selection) {
+		content, _ := item.Attr("content")
+
+		if u := metaRefreshURL(content); u != "" {
+			links = append(links, link{u, false, false})
+		}
+	})
+
+	s.Find(srcElements).Each(func(index int, item *goquery.Selection) {
+		src, _ := item.Attr("src")
+		links = append(links, link{src, true, false})
+	})
+
+	s.Find("img[srcset], source[srcset]").Each(func(index int, item *goquery.Selection) {
+		srcset, _ := item.Attr("srcset")
+
+		for _, u := range srcsetURLs(srcset) {
+			links = append(links, link{u, true, false})
+		}
+	})
+
+	s.Find("video[poster]").Each(func(index int, item *goquery.Selection) {
+		poster, _ := item.Attr("poster")
+		links = append(links, link{poster, true, false})
+	})
+
+	s.Find(`link[href][rel~="stylesheet" i], link[href][rel~="icon" i]`).Each(func(index int, item *goquery.Selection) {
+		href, _ := item.Attr("href")
+		links = append(links, link{href, true, false})
+	})
+
+	s.Find("style").Each(func(index int, item *goquery.Selection) {
+		links = append(links, extractCSSLinks(item.Text())...)
+	})
+
+	s.Find("[style]").Each(func(index int, item *goquery.Selection) {
+		style, _ := item.Attr("style")
+		links = append(links, extractCSSLinks(style)...)
+	})
+
+	return links
+}
+
+// metaRefreshURL returns the URL a meta refresh redirects to, given its
+// content, e.g. "0; url=/new/", or "" for one that only reloads the page.
+func metaRefreshURL(content string) string {
+	_, rest, ok := strings.Cut(content, ";")
+	if !ok {
+		// a comma was common enough that browsers accept it too
+		if _, rest, ok = strings.Cut(content, ","); !ok {
+			return ""
+		}
+	}
+
+	rest = strings.TrimSpace(rest)
+
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		if after := strings.TrimSpace(rest[3:]); strings.HasPrefix(after, "=") {
+			rest = strings.TrimSpace(after[1:])
+		}
+	}
+
+	if rest != "" && (rest[0] == '\'' || rest[0] == '"') {
+		if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+			rest = rest[1 : end+1]
+		} else {
+			rest = rest[1:]
+		}
+	}
+
+	return strings.TrimSpace(rest)
+}
+
+// srcElements are the elements whose src is a requisite of the page.
+const srcElements = "img[src], script[src], source[src], video[src], audio[src], track[src], embed[src], iframe[src], frame[src]"
+
+// srcsetURLs returns the URLs of the image candidates in a srcset attribute,
+// e.g. "a.jpg 1x, b.jpg 2x". As in browsers, a URL only ends at whitespace,
+// so commas in it (as in data: URLs) don't split it, unless they trail it.
+func srcsetURLs(srcset string) []string {
+	var urls []string
+
+	for _, c := range srcsetCandidates(srcset) {
+		urls = append(urls, c[0])
+	}
+
+	return urls
+}
+
+// srcsetCandidates splits srcset into its candidates' URLs and descriptors.
+func srcsetCandidates(srcset string) [][2]string {
+	var candidates [][2]string
+
+	s := srcset
+
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return candidates
+		}
+
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+
+		u := s[:end]
+		s = s[end:]
+
+		descriptor := ""
+
+		if trimmed := strings.TrimRight(u, ","); trimmed != u {
+			// a trailing comma ends the candidate right there
+			u = trimmed
+		} else {
+			descriptor, s, _ = strings.Cut(s, ",")
+			descriptor = strings.TrimSpace(descriptor)
+		}
+
+		if u != "" {
+			candidates = append(candidates, [2]string{u, descriptor})
+		}
+	}
+}
+
+// rewriteSrcset passes the URL of every candidate in srcset through fn.
+func rewriteSrcset(srcset string, fn func(string) string) string {
+	candidates := srcsetCandidates(srcset)
+	changed := false
+
+	for i, c := range candidates {
+		if u := fn(c[0]); u != c[0] {
+			candidates[i][0] = u
+			changed = true
+		}
+	}
+
+	if !changed {
+		return srcset
+	}
+
+	parts := make([]string, len(candidates))
+
+	for i, c := range candidates {
+		parts[i] = strings.TrimSpace(c[0] + " " + c[1])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// noscriptLinks returns the links in the <noscript> elements under s. The
+// parser runs with scripting enabled, as browsers do, so their content is
+// only text and has to be parsed again.
+func noscriptLinks(s *goquery.Selection) []link {
+	var links []link
+
+	s.Find("noscript").Each(func(index int, item *goquery.Selection) {
+		inner, err := goquery.NewDocumentFromReader(strings.NewReader(item.Text()))
+		if err == nil {
+			links = append(links, findLinks(inner.Selection)...)
+		}
+	})
+
+	return links
+}
+
+// commentURL matches what looks like a link in an HTML comment: the value of
+// an href or src attribute of commented out markup, or a bare http(s) URL.
+var commentURL = regexp.MustCompile(`(?i)\b(?:href|src)\s*=\s*["']([^"']+)["']|\bhttps?://[^\s"'<>()]+`)
+
+// commentLinks returns the URL-like strings in the comments of the nodes
+// under s, followed as pages.
+func commentLinks(s *goquery.Selection) []link {
+	var links []link
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.CommentNode {
+			for _, m := range commentURL.FindAllStringSubmatch(n.Data, -1) {
+				u := m[1]
+				if u == "" {
+					u = m[0]
+				}
+
+				links = append(links, link{u, false, false})
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	for _, n := range s.Nodes {
+		walk(n)
+	}
+
+	return links
+}
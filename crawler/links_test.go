@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// noscriptPage has links only inside noscript blocks and comments, as
+// sites rendering everything with scripts often do.
+const noscriptPage = `<html><head><noscript><link rel="stylesheet" href="/noscript.css"></noscript></head>
+<body><div id="app"></div><script src="/app.js"></script>
+<noscript><p>Enable JavaScript, or <a href="/plain.html">see the plain page</a>
+<img src="/fallback.png"></p></noscript>
+<!-- <a href="/old.html">old</a> moved to https://example.org/new.html -->
+</body></html>`
+
+func TestNoscriptAndCommentLinks(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(noscriptPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// to the parser, noscript holds text
+	for _, l := range findLinks(doc.Selection) {
+		if l.url != "/app.js" {
+			t.Errorf("%s found outside noscript", l.url)
+		}
+	}
+
+	want := []link{{"/noscript.css", true, false}, {"/plain.html", false, false}, {"/fallback.png", true, false}}
+	if got := noscriptLinks(doc.Selection); !reflect.DeepEqual(got, want) {
+		t.Errorf("got noscript links %v, want %v", got, want)
+	}
+
+	want = []link{{"/old.html", false, false}, {"https://example.org/new.html", false, false}}
+	if got := commentLinks(doc.Selection); !reflect.DeepEqual(got, want) {
+		t.Errorf("got comment links %v, want %v", got, want)
+	}
+}
+
+func TestNoscriptLinksCrawl(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":             noscriptPage,
+		"/app.js":       "js",
+		"/noscript.css": "body {}",
+		"/plain.html":   "plain",
+		"/fallback.png": "png",
+		"/old.html":     "old",
+	})
+
+	for _, c := range []struct {
+		noscript, comments bool
+		want               []string
+	}{
+		{false, false, []string{"/app.js"}},
+		{true, false, []string{"/app.js", "/noscript.css", "/plain.html", "/fallback.png"}},
+		{false, true, []string{"/app.js", "/old.html"}},
+	} {
+		t.Run(fmt.Sprintf("noscript=%v,comments=%v", c.noscript, c.comments), func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.NoscriptLinks = c.noscript
+			o.CommentLinks = c.comments
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Fetched != 1+len(c.want) {
+				t.Errorf("fetched %d, want %d", res.Fetched, 1+len(c.want))
+			}
+
+			for _, p := range c.want {
+				if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+					t.Errorf("%s not followed: %v", p, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LevelTrace is below debug, for the requests and responses -vv logs.
+const LevelTrace = slog.LevelDebug - 4
+
+// NewLogHandler returns a handler logging records of level and up to w in
+// format, text for people to read or json with an object per line.
+func NewLogHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	switch format {
+	case "text":
+		return newPlainHandler(w, level), nil
+	case "json":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.LevelKey && len(groups) == 0 && a.Value.Any() == LevelTrace {
+					a.Value = slog.StringValue("TRACE")
+				}
+
+				return a
+			},
+		}), nil
+	}
+
+	return nil, fmt.Errorf("expected text or json")
+}
+
+// plainHandler writes a record as its message followed by its attributes as
+// key=value, for people to read. There's no time or level, other than
+// warnings and errors starting with "warning, " and "error, ".
+type plainHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+}
+
+func newPlainHandler(w io.Writer, level slog.Leveler) *plainHandler {
+	return &plainHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+// to is the handler writing to w instead, e.g. through the progress bars.
+func (h *plainHandler) to(w io.Writer) *plainHandler {
+	h2 := *h
+	h2.mu, h2.w = &sync.Mutex{}, w
+
+	return &h2
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("error, ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("warning, ")
+	}
+
+	b.WriteString(r.Message)
+
+	for _, a := range h.attrs {
+		writeAttr(&b, "", a)
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr(nil), h.attrs...)
+
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+	}
+
+	return &h2
+}
+
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.prefix += name + "."
+
+	return &h2
+}
+
+// writeAttr writes a as " key=value", quoting values that wouldn't read
+// back as one word, and flattening groups into dotted keys.
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+
+		for _, g := range a.Value.Group() {
+			writeAttr(b, prefix, g)
+		}
+
+		return
+	}
+
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = strconv.Quote(v)
+	}
+
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, v)
+}
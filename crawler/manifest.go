@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// manifestRecord is a line of the -manifest file.
+type manifestRecord struct {
+	URL         string `json:"url"`
+	Path        string `json:"path,omitempty"`
+	Status      int    `json:"status"`
+	Bytes       int64  `json:"bytes"`
+	SHA256      string `json:"sha256,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	DurationMS  int64  `json:"duration_ms"`
+	Parent      string `json:"parent,omitempty"`
+}
+
+// crawlManifest is the -manifest file, a JSON line for every URL fetched,
+// for pipelines to pick the crawl up from. A nil *crawlManifest records
+// nothing.
+type crawlManifest struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func createManifest(file string) (*crawlManifest, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(f)
+
+	return &crawlManifest{f, w, json.NewEncoder(w)}, nil
+}
+
+// add records a fetch of url found on parent, which is empty for the start
+// URL; path is relative to the mirror, and empty for pages only crawled
+// through or URLs that failed.
+func (m *crawlManifest) add(url string, status int, contentType string, size int64, sum []byte, path string, took time.Duration, parent string) {
+	if m == nil {
+		return
+	}
+
+	m.enc.Encode(manifestRecord{
+		URL:         url,
+		Path:        path,
+		Status:      status,
+		Bytes:       size,
+		SHA256:      hex.EncodeToString(sum),
+		ContentType: contentType,
+		DurationMS:  took.Milliseconds(),
+		Parent:      parent,
+	})
+}
+
+func (m *crawlManifest) close() error {
+	if m == nil {
+		return nil
+	}
+
+	if err := m.w.Flush(); err != nil {
+		m.f.Close()
+		return err
+	}
+
+	return m.f.Close()
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// metaDir is where sidecar metadata is kept, relative to the mirror root,
+// away from the host directories so it never mixes with mirrored files.
+const metaDir = ".mrdriller/meta"
+
+// fileMeta is what we remember about a downloaded file between crawls.
+type fileMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Partial      bool   `json:"partial,omitempty"`
+}
+
+// metaPath is the sidecar file for the mirrored file at path.
+func metaPath(root string, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, metaDir, rel+".json"), nil
+}
+
+// loadMeta returns the stored metadata for path, or nil if there is none.
+func loadMeta(root string, path string) (*fileMeta, error) {
+	mp, err := metaPath(root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(mp)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	m := &fileMeta{}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// saveMeta records the validators from a download of url saved at path, and
+// whether only part of it was downloaded with -partial-bytes.
+func saveMeta(root string, path string, url string, header http.Header, partial bool) error {
+	mp, err := metaPath(root, path)
+	if err != nil {
+		return err
+	}
+
+	m := fileMeta{
+		URL:          url,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Partial:      partial,
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(mp), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(mp, b, 0666)
+}
+
+// conditional makes req only succeed if the resource has changed since it
+// was stored.
+func (m *fileMeta) conditional(req *http.Request) {
+	if m.ETag != "" {
+		req.Header.Set("If-None-Match", m.ETag)
+	}
+
+	if m.LastModified != "" {
+		req.Header.Set("If-Modified-Since", m.LastModified)
+	}
+}
+
+// changed compares the response to a conditional request against what was
+// stored, reporting whether the resource changed and whether that could be
+// told from the validators at all.
+func (m *fileMeta) changed(resp *http.Response) (changed bool, known bool) {
+	if resp.StatusCode == http.StatusNotModified {
+		return false, true
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, false
+	}
+
+	if etag := resp.Header.Get("ETag"); m.ETag != "" && etag != "" {
+		return etag != m.ETag, true
+	}
+
+	if lm := resp.Header.Get("Last-Modified"); m.LastModified != "" && lm != "" {
+		return lm != m.LastModified, true
+	}
+
+	return false, false
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the fetch latency
+// histogram, from a cached page to a large file.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// crawlMetrics are the counters and histograms -metrics-addr serves in the
+// Prometheus text format, written by hand as the format is simple enough
+// not to need the client library. A nil *crawlMetrics records nothing.
+type crawlMetrics struct {
+	mu       sync.Mutex
+	requests map[string]uint64
+	bytes    int64
+	buckets  []uint64
+	sum      float64
+	count    uint64
+
+	// read when scraped, as they belong to the crawl loop
+	queued   func() int
+	inflight func() int
+}
+
+func newCrawlMetrics(queued, inflight func() int) *crawlMetrics {
+	return &crawlMetrics{
+		requests: map[string]uint64{},
+		buckets:  make([]uint64, len(latencyBuckets)),
+		queued:   queued,
+		inflight: inflight,
+	}
+}
+
+// observe records a download that got status, 0 if it failed without one,
+// having read size bytes in took.
+func (m *crawlMetrics) observe(status int, size int64, took time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code := "error"
+	if status > 0 {
+		code = strconv.Itoa(status)
+	}
+
+	m.requests[code]++
+	m.bytes += size
+
+	s := took.Seconds()
+	m.sum += s
+	m.count++
+
+	for i, le := range latencyBuckets {
+		if s <= le {
+			m.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *crawlMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+func (m *crawlMetrics) write(w io.Writer) {
+	queued, inflight := m.queued(), m.inflight()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP mrdriller_requests_total Downloads finished, by status code, or error when there was none.")
+	fmt.Fprintln(w, "# TYPE mrdriller_requests_total counter")
+
+	codes := make([]string, 0, len(m.requests))
+	for c := range m.requests {
+		codes = append(codes, c)
+	}
+
+	sort.Strings(codes)
+
+	for _, c := range codes {
+		fmt.Fprintf(w, "mrdriller_requests_total{code=%q} %d\n", c, m.requests[c])
+	}
+
+	fmt.Fprintln(w, "# HELP mrdriller_downloaded_bytes_total Bytes downloaded.")
+	fmt.Fprintln(w, "# TYPE mrdriller_downloaded_bytes_total counter")
+	fmt.Fprintf(w, "mrdriller_downloaded_bytes_total %d\n", m.bytes)
+
+	fmt.Fprintln(w, "# HELP mrdriller_queue_urls URLs waiting in the queue.")
+	fmt.Fprintln(w, "# TYPE mrdriller_queue_urls gauge")
+	fmt.Fprintf(w, "mrdriller_queue_urls %d\n", queued)
+
+	fmt.Fprintln(w, "# HELP mrdriller_downloads_in_progress Downloads handed to workers and not yet finished.")
+	fmt.Fprintln(w, "# TYPE mrdriller_downloads_in_progress gauge")
+	fmt.Fprintf(w, "mrdriller_downloads_in_progress %d\n", inflight)
+
+	fmt.Fprintln(w, "# HELP mrdriller_fetch_duration_seconds How long downloads took, retries included.")
+	fmt.Fprintln(w, "# TYPE mrdriller_fetch_duration_seconds histogram")
+
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(w, "mrdriller_fetch_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), m.buckets[i])
+	}
+
+	fmt.Fprintf(w, "mrdriller_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(w, "mrdriller_fetch_duration_seconds_sum %g\n", m.sum)
+	fmt.Fprintf(w, "mrdriller_fetch_duration_seconds_count %d\n", m.count)
+}
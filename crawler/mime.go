@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// mediaType returns the lower cased type/subtype of a Content-Type header,
+// without any parameters such as charset.
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t, _, _ = strings.Cut(contentType, ";")
+	}
+
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+// mimeMatch reports whether contentType matches pattern, which is either an
+// exact media type ("text/css"), a whole top level type ("image/*") or any
+// type at all ("*/*" or "*").
+func mimeMatch(pattern string, contentType string) bool {
+	pattern = strings.ToLower(pattern)
+	t := mediaType(contentType)
+
+	if pattern == "*" || pattern == "*/*" {
+		return true
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(t, prefix+"/")
+	}
+
+	return t == pattern
+}
+
+// typeAccepted reports whether files of contentType are saved: it mustn't
+// match a pattern of RejectTypes, and must match one of AcceptTypes if there
+// are any, as for mimeMatch.
+func (r *run) typeAccepted(contentType string) bool {
+	for _, p := range r.o.RejectTypes {
+		if mimeMatch(p, contentType) {
+			return false
+		}
+	}
+
+	if len(r.o.AcceptTypes) == 0 {
+		return true
+	}
+
+	for _, p := range r.o.AcceptTypes {
+		if mimeMatch(p, contentType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkType declines a download of a type that isn't accepted, unless it's
+// an HTML page, which still has to be fetched for its links.
+func (r *run) checkType(resp *http.Response) error {
+	ct := resp.Header.Get("Content-Type")
+
+	if r.typeAccepted(ct) || mediaType(ct) == "text/html" {
+		return nil
+	}
+
+	return fmt.Errorf("%w, %s isn't an accepted type", ErrDeclined, mediaType(ct))
+}
+
+type typeDir struct {
+	pattern string
+	dir     string
+}
+
+// typeDirs maps content types to the subdirectories of a host's mirror
+// their files are saved under, as configured with -type-dir.
+type typeDirs []typeDir
+
+// parseTypeDirs parses comma separated type=dir pairs, e.g.
+// "image/*=images,text/css=styles".
+func parseTypeDirs(s string) (typeDirs, error) {
+	var t typeDirs
+
+	for _, m := range strings.Split(s, ",") {
+		pattern, dir, ok := strings.Cut(strings.TrimSpace(m), "=")
+		if !ok || pattern == "" || dir == "" {
+			return nil, fmt.Errorf("mapping `%s` is not of the form type=dir", m)
+		}
+
+		dir = filepath.Clean(dir)
+		if !filepath.IsLocal(dir) {
+			return nil, fmt.Errorf("directory `%s` must be relative and stay within the mirror", dir)
+		}
+
+		t = append(t, typeDir{pattern, dir})
+	}
+
+	return t, nil
+}
+
+// dirFor returns the directory for the first mapping matching contentType,
+// or "" if files of that type keep the normal layout.
+func (t typeDirs) dirFor(contentType string) string {
+	for _, m := range t {
+		if mimeMatch(m.pattern, contentType) {
+			return m.dir
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTypeDirs(t *testing.T) {
+	dirs, err := parseTypeDirs("image/*=images, text/css=styles ,image/svg+xml=vector,*/*=other/misc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		contentType string
+		want        string
+	}{
+		{"image/png", "images"},
+		{"IMAGE/JPEG", "images"},
+		// the first match wins
+		{"image/svg+xml", "images"},
+		{"text/css", "styles"},
+		{"text/css; charset=utf-8", "styles"},
+		{"text/html", filepath.Join("other", "misc")},
+		{"", filepath.Join("other", "misc")},
+	} {
+		if got := dirs.dirFor(c.contentType); got != c.want {
+			t.Errorf("dirFor(%q) = %q, want %q", c.contentType, got, c.want)
+		}
+	}
+
+	exact, err := parseTypeDirs("text/css=styles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ct := range []string{"text/html", "text/cssx", "image/png"} {
+		if got := exact.dirFor(ct); got != "" {
+			t.Errorf("dirFor(%q) = %q, want the normal layout", ct, got)
+		}
+	}
+
+	for _, s := range []string{"", "image/*", "=images", "image/*=", "image/*=../up", "image/*=/abs"} {
+		if _, err := parseTypeDirs(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestTypeDirCrawl(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":             `<link rel="stylesheet" href="/css/site.css"><img src="/img/logo.png"><script src="/app.js"></script>`,
+		"/css/site.css": `body { background: url(/img/bg.gif) }`,
+		"/img/logo.png": "png",
+		"/img/bg.gif":   "gif",
+		"/app.js":       "js",
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.TypeDir = "image/*=images,text/css=styles"
+	o.ConvertLinks = true
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	host := filepath.Dir(mirrored(t, o, s.URL+"/app.js"))
+
+	for _, p := range []string{
+		"index.html",
+		"app.js",
+		filepath.Join("styles", "css", "site.css"),
+		filepath.Join("images", "img", "logo.png"),
+		filepath.Join("images", "img", "bg.gif"),
+	} {
+		if _, err := os.Stat(filepath.Join(host, p)); err != nil {
+			t.Errorf("%s not saved: %v", p, err)
+		}
+	}
+
+	// and links to them lead there
+	for file, want := range map[string][]string{
+		"index.html": {"styles/css/site.css", "images/img/logo.png", "app.js"},
+		filepath.Join("styles", "css", "site.css"): {"../../images/img/bg.gif"},
+	} {
+		b, err := os.ReadFile(filepath.Join(host, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, w := range want {
+			if !strings.Contains(string(b), w) {
+				t.Errorf("%s doesn't link to %s: %s", file, w, b)
+			}
+		}
+	}
+}
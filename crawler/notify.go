@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// notifyTimeout is how long the -notify-url webhook gets to answer.
+const notifyTimeout = 30 * time.Second
+
+// notification is what's posted to -notify-url when a crawl ends.
+type notification struct {
+	Status  string          `json:"status"`
+	Reason  string          `json:"reason,omitempty"`
+	URL     string          `json:"url"`
+	Summary json.RawMessage `json:"summary"`
+	Failed  []string        `json:"failed_urls"`
+}
+
+// notify posts a notification that the crawl of startURL finished, or was
+// aborted for reason, with its summary and the URLs that failed.
+func notify(webhook, startURL string, summary *crawlSummary, aborted bool, reason string) error {
+	b, err := summary.marshal()
+	if err != nil {
+		return err
+	}
+
+	n := notification{
+		Status:  "finished",
+		Reason:  reason,
+		URL:     startURL,
+		Summary: b,
+		Failed:  summary.failedURLs(),
+	}
+
+	if aborted {
+		n.Status = "aborted"
+	}
+
+	if n.Failed == nil {
+		n.Failed = []string{}
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	// not the crawl's client, which may send the site's credentials
+	resp, err := (&http.Client{Timeout: notifyTimeout}).Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got %s", resp.Status)
+	}
+
+	return nil
+}
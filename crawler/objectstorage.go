@@ -0,0 +1,319 @@
+package crawler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// objectStorage keeps files in an S3 bucket, or a GCS bucket through its S3
+// compatible XML API, by talking to the REST API directly with requests
+// signed with AWS Signature Version 4, rather than depending on the SDKs.
+type objectStorage struct {
+	scheme string
+	host   string
+	bucket string
+	prefix string
+	region string
+
+	// with path-style URLs the bucket is the first segment of the path
+	// instead of a subdomain of host
+	pathStyle bool
+
+	keyID  string
+	secret string
+	token  string
+
+	client *http.Client
+}
+
+// objectTimeout bounds every request to a bucket, long enough to upload a
+// large file but not to hang the crawl on a stalled one.
+const objectTimeout = 10 * time.Minute
+
+// newS3Storage keeps files under bucket/prefix on S3, with the credentials
+// of AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, in the
+// region of AWS_REGION, or at AWS_ENDPOINT_URL, e.g. for MinIO, sending
+// requests through transport.
+func newS3Storage(location string, transport http.RoundTripper) (*objectStorage, error) {
+	s, err := newObjectStorage(location, transport, "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = os.Getenv("AWS_SESSION_TOKEN")
+
+	s.region = os.Getenv("AWS_REGION")
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid AWS_ENDPOINT_URL `%s`", endpoint)
+		}
+
+		s.scheme, s.host, s.pathStyle = u.Scheme, u.Host, true
+
+		return s, nil
+	}
+
+	// dots in the bucket name would break the certificate's wildcard
+	s.pathStyle = strings.Contains(s.bucket, ".")
+
+	s.host = "s3." + s.region + ".amazonaws.com"
+	if !s.pathStyle {
+		s.host = s.bucket + "." + s.host
+	}
+
+	return s, nil
+}
+
+// newGCSStorage keeps files under bucket/prefix on GCS, with the HMAC key of
+// GS_ACCESS_KEY_ID and GS_SECRET_ACCESS_KEY, sending requests through
+// transport.
+func newGCSStorage(location string, transport http.RoundTripper) (*objectStorage, error) {
+	s, err := newObjectStorage(location, transport, "GS_ACCESS_KEY_ID", "GS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	s.host, s.region, s.pathStyle = "storage.googleapis.com", "auto", true
+
+	return s, nil
+}
+
+func newObjectStorage(location string, transport http.RoundTripper, keyIDVar, secretVar string) (*objectStorage, error) {
+	bucket, prefix, _ := strings.Cut(location, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("expected a bucket, and optionally a prefix, e.g. bucket/mirrors")
+	}
+
+	s := &objectStorage{
+		scheme: "https",
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		keyID:  os.Getenv(keyIDVar),
+		secret: os.Getenv(secretVar),
+		client: &http.Client{Transport: transport, Timeout: objectTimeout},
+	}
+
+	if s.keyID == "" || s.secret == "" {
+		return nil, fmt.Errorf("%s and %s must be set", keyIDVar, secretVar)
+	}
+
+	return s, nil
+}
+
+func (s *objectStorage) Put(name string, r io.Reader, size int64, modTime time.Time) error {
+	header := http.Header{}
+
+	// S3 sets Last-Modified to when the object was stored, so the server's
+	// is kept in the object's metadata for -timestamping
+	header.Set("X-Amz-Meta-Mtime", strconv.FormatInt(modTime.Unix(), 10))
+
+	resp, err := s.do("PUT", name, r, size, header)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not store %s: %s", name, resp.Status)
+	}
+
+	return nil
+}
+
+func (s *objectStorage) Stat(name string) (fs.FileInfo, error) {
+	resp, err := s.do("HEAD", name, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	default:
+		return nil, fmt.Errorf("could not stat %s: %s", name, resp.Status)
+	}
+
+	info := objectInfo{name: name, size: resp.ContentLength}
+
+	if mtime, err := strconv.ParseInt(resp.Header.Get("X-Amz-Meta-Mtime"), 10, 64); err == nil {
+		info.modTime = time.Unix(mtime, 0)
+	} else if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = lm
+	}
+
+	return info, nil
+}
+
+func (s *objectStorage) Open(name string) (io.ReadCloser, error) {
+	resp, err := s.do("GET", name, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	resp.Body.Close()
+
+	return nil, fmt.Errorf("could not open %s: %s", name, resp.Status)
+}
+
+// do sends a signed request for the object stored as name, with a body of
+// size bytes read from body, if any.
+func (s *objectStorage) do(method, name string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	key := name
+	if s.prefix != "" {
+		key = s.prefix + "/" + name
+	}
+
+	p := "/" + key
+	if s.pathStyle {
+		p = "/" + s.bucket + p
+	}
+
+	u := &url.URL{Scheme: s.scheme, Host: s.host, Path: p, RawPath: escapeObjectPath(p)}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// an unknown length would be sent chunked, which S3 refuses
+	req.ContentLength = size
+	if body != nil && size == 0 {
+		req.Body = http.NoBody
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	s.sign(req)
+
+	return s.client.Do(req)
+}
+
+// sign adds the headers of AWS Signature Version 4 to req, leaving its body
+// unsigned so it can be streamed, unless req already has the body's hash in
+// X-Amz-Content-Sha256.
+func (s *objectStorage) sign(req *http.Request) {
+	stamp := now().UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = "UNSIGNED-PAYLOAD"
+	}
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	names := []string{"host"}
+	for k := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			names = append(names, k)
+		}
+	}
+
+	sort.Strings(names)
+
+	var canonical strings.Builder
+
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", req.Method, req.URL.EscapedPath(), req.URL.RawQuery)
+
+	for _, n := range names {
+		v := req.URL.Host
+		if n != "host" {
+			v = strings.TrimSpace(req.Header.Get(n))
+		}
+
+		fmt.Fprintf(&canonical, "%s:%s\n", n, v)
+	}
+
+	signed := strings.Join(names, ";")
+	fmt.Fprintf(&canonical, "\n%s\n%s", signed, payload)
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + s.secret)
+	for _, part := range []string{day, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x", s.keyID, scope, signed, hmacSHA256(key, toSign)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// escapeObjectPath percent-encodes everything in p but unreserved characters
+// and slashes, as signing expects, e.g. the colon of "https:example.org".
+func escapeObjectPath(p string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// objectInfo is what Stat tells about an object.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i objectInfo) Name() string       { return path.Base(i.name) }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) Mode() fs.FileMode  { return 0644 }
+func (i objectInfo) ModTime() time.Time { return i.modTime }
+func (i objectInfo) IsDir() bool        { return false }
+func (i objectInfo) Sys() any           { return nil }
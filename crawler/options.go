@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Options are the settings of a crawl, one for every flag of mrdriller's
+// crawl command, which documents them at length; the field comments name
+// the flag. Start from DefaultOptions, as some of the defaults aren't the
+// zero value.
+type Options struct {
+	// URLs are the URLs to start from. The first one's host is the one the
+	// crawl is about, e.g. for sitemaps and VerifyComplete.
+	URLs []string
+
+	// Dir is the directory the mirror is saved in, the current directory
+	// if empty.
+	Dir string
+
+	// Logger is where the crawl logs what it's doing, as text on stderr if
+	// nil. See NewLogHandler for the handlers of -log-format.
+	Logger *slog.Logger
+
+	// Out is where the plan, -spider and -host-stats are printed, stdout if
+	// nil.
+	Out io.Writer
+
+	// Progress draws progress bars of the downloads in progress on stderr,
+	// when it's a terminal, with lines logged by a nil Logger above them.
+	Progress bool
+
+	// Storage, when set, is where downloads are moved once complete
+	// instead of the storage Output names.
+	Storage Storage
+
+	// Decide, when set, may veto a download by its response headers, like
+	// HeaderFilter. It's only called once the freshness check has decided
+	// the file needs fetching, with the headers of the GET (or ranged GET
+	// when resuming) before any of the body is read or the destination file
+	// is touched, and with PlanFirst or PlanOnly with those of the HEAD the
+	// plan is made from. Returning false skips the download. With several
+	// Workers it may be called concurrently.
+	Decide func(url string, header http.Header) bool
+
+	Resume                  bool          // -resume
+	Depth                   uint          // -depth
+	Workers                 int           // -workers
+	Include                 []string      // -include
+	Exclude                 []string      // -exclude
+	Refresh                 []string      // -refresh
+	Seed                    []string      // -seed
+	SeedHops                uint          // -seed-hops
+	MaxQueryVariants        uint          // -max-query-variants
+	MaxPathDepth            uint          // -max-path-depth
+	Sitemap                 bool          // -sitemap
+	UseSitemapHints         bool          // -use-sitemap-hints
+	TemplateSample          uint          // -template-sample
+	PlanFirst               bool          // -plan-first
+	PlanOnly                bool          // -plan-only
+	Spider                  bool          // -spider
+	Verify                  string        // -verify
+	VerifySums              string        // -verify-sums
+	NewerOnly               bool          // -newer-only
+	Timestamping            bool          // -timestamping
+	StoreValidators         bool          // -store-validators
+	IPFSAware               bool          // -ipfs-aware
+	HeaderFilter            string        // -header-filter
+	FrontierOut             string        // -frontier-out
+	FrontierIn              string        // -frontier-in
+	DetectChallenges        bool          // -detect-challenges
+	ChallengeMarkers        []string      // -challenge-marker
+	ChallengeWait           time.Duration // -challenge-wait
+	StripParams             []string      // -strip-params
+	KeepTrackingParams      bool          // -keep-tracking-params
+	Retries                 int           // -retries
+	OnStatus                []string      // -on-status
+	IncludeSubdomains       bool          // -include-subdomains
+	SpanHosts               bool          // -span-hosts
+	Domains                 []string      // -domain
+	PageRequisites          bool          // -page-requisites
+	PageRequisitesSpanHosts bool          // -page-requisites-span-hosts
+	CrossScheme             string        // -cross-scheme
+	Canonical               string        // -canonical
+	CollapseWWW             bool          // -collapse-www
+	WARCFile                string        // -warc-file
+	Index                   string        // -index
+	Manifest                string        // -manifest
+	SummaryFile             string        // -summary-file
+	MetricsAddr             string        // -metrics-addr
+	NotifyURL               string        // -notify-url
+	PageMetadata            string        // -page-metadata
+	RedirectMap             string        // -redirect-map
+	EventSocket             string        // -event-socket
+	VerifyComplete          bool          // -verify-complete
+	HostStats               bool          // -host-stats
+	BaseArchive             string        // -base-archive
+	OutputArchive           string        // -output-archive
+	Output                  string        // -output
+	ArchivePerHost          string        // -archive-per-host
+	MaxRedirectRatio        float64       // -max-redirect-ratio
+	Strict                  bool          // -strict
+	UserAgent               string        // -user-agent
+	Headers                 []string      // -header
+	MaxRedirects            int           // -max-redirects
+	NoFollowRedirects       bool          // -no-follow-redirects
+	SaveFinalURL            bool          // -save-final-url
+	Proxy                   string        // -proxy
+	Insecure                bool          // -insecure
+	CACert                  string        // -cacert
+	Cert                    string        // -cert
+	Key                     string        // -key
+	PinSHA256               []string      // -pin-sha256
+	ConnectTimeout          time.Duration // -connect-timeout
+	ReadTimeout             time.Duration // -read-timeout
+	HTTP3                   bool          // -http3
+	RequestTimeout          time.Duration // -request-timeout
+	StallTimeout            time.Duration // -stall-timeout
+	PartialBytes            int64         // -partial-bytes
+	NearDupThreshold        int           // -near-dup-threshold
+	SkipNearDups            bool          // -skip-near-dups
+	OptimizeImages          bool          // -optimize-images
+	JPEGQuality             int           // -jpeg-quality
+	KeepOriginalImages      bool          // -keep-original-images
+	StreamParseAbove        int64         // -stream-parse-above
+	ConvertLinks            bool          // -convert-links
+	RootRelative            bool          // -root-relative
+	NoscriptLinks           bool          // -noscript-links
+	CommentLinks            bool          // -comment-links
+	WebFonts                bool          // -web-fonts
+	Raw                     bool          // -raw
+	MaxFiles                uint          // -max-files
+	Quota                   string        // -quota
+	Budget                  string        // -budget
+	BudgetFile              string        // -budget-file
+	TimeBox                 time.Duration // -time-box
+	ContinueCrawl           string        // -continue-crawl
+	StateFile               string        // -state-file
+	NoRobots                bool          // -no-robots
+	Wait                    time.Duration // -wait
+	RandomWait              bool          // -random-wait
+	AcceptTypes             []string      // -accept-type
+	RejectTypes             []string      // -reject-type
+	MaxFilesize             string        // -max-filesize
+	MinFilesize             string        // -min-filesize
+	LimitRate               string        // -limit-rate
+	Schedule                string        // -schedule
+	Bearer                  string        // -bearer
+	AuthHeaderFile          string        // -auth-header-file
+	AuthCommand             string        // -auth-command
+	LoadCookies             string        // -load-cookies
+	SaveCookies             string        // -save-cookies
+	NoCookies               bool          // -no-cookies
+	TypeDir                 string        // -type-dir
+	ChecksumManifest        string        // -checksum-manifest
+	NoAtomic                bool          // -no-atomic
+}
+
+// DefaultOptions are the options of a crawl with no flags given: crawling
+// to any depth with one worker.
+func DefaultOptions() Options {
+	return Options{
+		Depth:            math.MaxUint,
+		Workers:          1,
+		CrossScheme:      "follow",
+		Canonical:        "keep",
+		MaxRedirects:     10,
+		JPEGQuality:      80,
+		StreamParseAbove: 16 << 20,
+	}
+}
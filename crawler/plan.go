@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// crawlPlan tallies what a -plan-first pass found would be downloaded, by
+// media type.
+type crawlPlan struct {
+	types    map[string]*planTotal
+	paths    map[string]bool
+	upToDate int
+}
+
+type planTotal struct {
+	files   int
+	bytes   int64
+	unknown int
+}
+
+// add records the file to be saved at path from the headers of its HEAD
+// response, once for each path as different URLs can share one. Files whose
+// size the server doesn't say are counted separately.
+func (p *crawlPlan) add(path string, header http.Header) {
+	if p.types == nil {
+		p.types = map[string]*planTotal{}
+		p.paths = map[string]bool{}
+	}
+
+	if p.paths[path] {
+		return
+	}
+
+	p.paths[path] = true
+
+	t := mediaType(header.Get("Content-Type"))
+	if t == "" {
+		t = "unknown"
+	}
+
+	total := p.types[t]
+	if total == nil {
+		total = &planTotal{}
+		p.types[t] = total
+	}
+
+	total.files++
+
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || size < 0 {
+		total.unknown++
+		return
+	}
+
+	total.bytes += size
+}
+
+// report writes the plan as a table, largest media type first.
+func (p *crawlPlan) report(w io.Writer) {
+	types := make([]string, 0, len(p.types))
+	for t := range p.types {
+		types = append(types, t)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		a, b := p.types[types[i]], p.types[types[j]]
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+
+		return types[i] < types[j]
+	})
+
+	var all planTotal
+
+	fmt.Fprintf(w, "Plan:\n")
+
+	for _, t := range types {
+		total := p.types[t]
+		fmt.Fprintf(w, "  %-32s %6d file(s) %14d bytes", t, total.files, total.bytes)
+
+		if total.unknown > 0 {
+			fmt.Fprintf(w, " (%d of unknown size)", total.unknown)
+		}
+
+		fmt.Fprintln(w)
+
+		all.files += total.files
+		all.bytes += total.bytes
+		all.unknown += total.unknown
+	}
+
+	fmt.Fprintf(w, "  %-32s %6d file(s) %14d bytes", "total", all.files, all.bytes)
+
+	if all.unknown > 0 {
+		fmt.Fprintf(w, " (%d of unknown size)", all.unknown)
+	}
+
+	fmt.Fprintln(w)
+
+	if p.upToDate > 0 {
+		fmt.Fprintf(w, "  %d more file(s) are already up to date in the mirror\n", p.upToDate)
+	}
+}
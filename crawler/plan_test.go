@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPlanReport(t *testing.T) {
+	var p crawlPlan
+
+	p.add("a.png", http.Header{"Content-Type": {"image/png"}, "Content-Length": {"1000"}})
+	p.add("b.png", http.Header{"Content-Type": {"image/png"}, "Content-Length": {"500"}})
+	// a URL saved to the same path as another is only counted once
+	p.add("b.png", http.Header{"Content-Type": {"image/png"}, "Content-Length": {"500"}})
+	p.add("index.html", http.Header{"Content-Type": {"text/html; charset=utf-8"}})
+	p.add("blob", http.Header{"Content-Length": {"20"}})
+	p.upToDate = 2
+
+	var b bytes.Buffer
+	p.report(&b)
+
+	want := `Plan:
+  image/png                             2 file(s)           1500 bytes
+  unknown                               1 file(s)             20 bytes
+  text/html                             1 file(s)              0 bytes (1 of unknown size)
+  total                                 4 file(s)           1520 bytes (1 of unknown size)
+  2 more file(s) are already up to date in the mirror
+`
+
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	pages := map[string]string{
+		"/":          `<a href="/a.html">a</a> <img src="/logo.png"> <link rel="stylesheet" href="/s.css">`,
+		"/a.html":    `<img src="/logo.png"> <img src="/photo.png">`,
+		"/logo.png":  "0123456789",
+		"/photo.png": "01234567890123456789",
+		"/s.css":     "body {}",
+	}
+
+	s := newSite(t, pages)
+
+	html := len(pages["/"]) + len(pages["/a.html"])
+
+	want := fmt.Sprintf(`Plan:
+  text/html                             2 file(s) %14d bytes
+  image/png                             2 file(s)             30 bytes
+  text/css                              1 file(s)              7 bytes
+  total                                 5 file(s) %14d bytes
+`, html, html+37)
+
+	for _, only := range []bool{true, false} {
+		var out bytes.Buffer
+
+		o := testOptions(t, s.URL+"/")
+		o.NoRobots = true
+		o.PlanOnly = only
+		o.PlanFirst = !only
+		o.Out = &out
+
+		res, err := New(o).Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := out.String(); !strings.HasPrefix(got, want) {
+			t.Errorf("plan-only=%v: got\n%s\nwant it to start with\n%s", only, got, want)
+		}
+
+		// planned, but only downloaded with PlanFirst
+		_, err = os.Stat(mirrored(t, o, s.URL+"/photo.png"))
+		if downloaded := err == nil; downloaded == only || (res.Fetched == 5) == only {
+			t.Errorf("plan-only=%v: fetched %d, photo.png downloaded %v", only, res.Fetched, downloaded)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressBars redraws the bars of the downloads in progress a few times a
+// second, one line each, at the bottom of the terminal. Log lines are
+// written through it, so they scroll by above the bars.
+type progressBars struct {
+	mu    sync.Mutex
+	w     io.Writer
+	bars  []*progressBar
+	drawn int
+	width int
+	stop  chan struct{}
+}
+
+// progressBar is a download's progress: the bytes of it read so far, out of
+// total, or -1 when the server didn't say.
+type progressBar struct {
+	name    string
+	n       atomic.Int64
+	resumed int64
+	total   int64
+	start   time.Time
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth is how many columns the terminal f is wide, or 80 if it
+// can't be told or is too narrow for a bar.
+func terminalWidth(f *os.File) int {
+	cols, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || cols < 40 {
+		return 80
+	}
+
+	return cols
+}
+
+func newProgressBars(w io.Writer) *progressBars {
+	p := &progressBars{w: w, width: terminalWidth(os.Stderr), stop: make(chan struct{})}
+
+	go func() {
+		t := time.NewTicker(200 * time.Millisecond)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// start adds a bar for the download of url, of which the first resumed
+// bytes were already on disk, with length more to come, or -1 if unknown.
+func (p *progressBars) start(url string, resumed, length int64) *progressBar {
+	if p == nil {
+		return nil
+	}
+
+	total := int64(-1)
+	if length >= 0 {
+		total = resumed + length
+	}
+
+	b := &progressBar{name: url, resumed: resumed, total: total, start: time.Now()}
+	b.n.Store(resumed)
+
+	p.mu.Lock()
+	p.bars = append(p.bars, b)
+	p.mu.Unlock()
+
+	return b
+}
+
+// finish takes the bar of a download that's done off the screen.
+func (p *progressBars) finish(b *progressBar) {
+	if p == nil || b == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, o := range p.bars {
+		if o == b {
+			p.bars = append(p.bars[:i], p.bars[i+1:]...)
+			break
+		}
+	}
+
+	p.redraw()
+}
+
+// Write writes a log line above the bars.
+func (p *progressBars) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+
+	n, err := p.w.Write(b)
+	p.redraw()
+
+	return n, err
+}
+
+// close takes the bars off the screen for good.
+func (p *progressBars) close() {
+	if p == nil {
+		return
+	}
+
+	close(p.stop)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bars = nil
+	p.clear()
+}
+
+// clear erases the bars drawn last, leaving the cursor where they started.
+func (p *progressBars) clear() {
+	if p.drawn == 0 {
+		return
+	}
+
+	fmt.Fprintf(p.w, "\x1b[%dA\x1b[J", p.drawn)
+	p.drawn = 0
+}
+
+func (p *progressBars) redraw() {
+	p.clear()
+
+	var b strings.Builder
+
+	for _, bar := range p.bars {
+		b.WriteString(bar.line(p.width))
+		b.WriteByte('\n')
+	}
+
+	io.WriteString(p.w, b.String())
+	p.drawn = len(p.bars)
+}
+
+// line is the bar as a line at most width wide, e.g.
+//
+//	index.html [=====>     ]  52%  1.2MiB  340KiB/s  ETA 3s
+func (b *progressBar) line(width int) string {
+	n := b.n.Load()
+
+	speed := int64(0)
+	if d := time.Since(b.start).Seconds(); d > 0 {
+		speed = int64(float64(n-b.resumed) / d)
+	}
+
+	var stats string
+
+	if b.total > 0 {
+		eta := "?"
+		if speed > 0 {
+			eta = time.Duration(float64(b.total-n) / float64(speed) * float64(time.Second)).Round(time.Second).String()
+		}
+
+		stats = fmt.Sprintf(" %3d%% %8s %8s/s  ETA %s", n*100/b.total, formatSize(n), formatSize(speed), eta)
+	} else {
+		stats = fmt.Sprintf(" %8s %8s/s", formatSize(n), formatSize(speed))
+	}
+
+	name := b.name
+	if i := strings.LastIndexByte(strings.TrimSuffix(name, "/"), '/'); i >= 0 {
+		name = name[i+1:]
+	}
+
+	// the name gets what the stats and the bar leave
+	const barWidth = 12
+	if room := width - len(stats) - barWidth - 2; len(name) > room {
+		name = name[:max(room, 0)]
+	}
+
+	bar := strings.Repeat(" ", barWidth-2)
+	if b.total > 0 {
+		done := int(int64(barWidth-2) * min(n, b.total) / b.total)
+		bar = strings.Repeat("=", done) + strings.Repeat(" ", barWidth-2-done)
+
+		if done > 0 && done < barWidth-2 {
+			bar = bar[:done-1] + ">" + bar[done:]
+		}
+	}
+
+	return fmt.Sprintf("%s [%s]%s", name, bar, stats)
+}
+
+// reader counts what's read from r towards the bar.
+func (b *progressBar) reader(r io.Reader) io.Reader {
+	if b == nil {
+		return r
+	}
+
+	return progressReader{r, b}
+}
+
+type progressReader struct {
+	r   io.Reader
+	bar *progressBar
+}
+
+func (p progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.bar.n.Add(int64(n))
+
+	return n, err
+}
+
+// formatSize is n bytes in binary units, e.g. "1.2MiB".
+func formatSize(n int64) string {
+	const units = "KMGTPE"
+
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	f := float64(n)
+	i := -1
+
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", f, units[i])
+}
@@ -0,0 +1,59 @@
+package crawler
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all downloads in progress. It fills
+// at rate bytes per second and holds at most a second's worth, so a quiet
+// spell can't be made up for with a burst.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// take accounts for n bytes read and sleeps for as long as that puts the
+// bucket in debt. Later readers see the debt too, so between them they
+// keep to the rate.
+func (l *rateLimiter) take(n int) {
+	l.mu.Lock()
+
+	t := time.Now()
+	l.tokens = min(l.tokens+t.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = t
+	l.tokens -= float64(n)
+	debt := -l.tokens
+
+	l.mu.Unlock()
+
+	if debt > 0 {
+		time.Sleep(time.Duration(debt / l.rate * float64(time.Second)))
+	}
+}
+
+// throttledReader reads through a rateLimiter in small enough pieces that
+// the downloads sharing it take turns.
+type throttledReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	// at most a tenth of a second's worth at a time
+	if max := max(int(t.l.rate/10), 512); len(p) > max {
+		p = p[:max]
+	}
+
+	n, err := t.r.Read(p)
+	t.l.take(n)
+
+	return n, err
+}
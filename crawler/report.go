@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reportTotal adds up the URLs of a kind in a Report.
+type reportTotal struct {
+	urls  int
+	bytes int64
+}
+
+// Report sums up the crawl a -manifest file records, writing to w how many
+// URLs were fetched and how many bytes by status code, by content type and
+// by host, and the slowest downloads.
+func Report(manifest string, w io.Writer) error {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var all reportTotal
+	var slowest []manifestRecord
+
+	byStatus := map[string]*reportTotal{}
+	byType := map[string]*reportTotal{}
+	byHost := map[string]*reportTotal{}
+
+	add := func(totals map[string]*reportTotal, key string, rec manifestRecord) {
+		t := totals[key]
+		if t == nil {
+			t = &reportTotal{}
+			totals[key] = t
+		}
+
+		t.urls++
+		t.bytes += rec.Bytes
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec manifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s:%d: %v", manifest, line, err)
+		}
+
+		all.urls++
+		all.bytes += rec.Bytes
+
+		add(byStatus, strconv.Itoa(rec.Status), rec)
+
+		contentType := mediaType(rec.ContentType)
+		if contentType == "" {
+			contentType = "unknown"
+		}
+
+		add(byType, contentType, rec)
+
+		host := "unknown"
+		if u, err := url.Parse(rec.URL); err == nil && u.Host != "" {
+			host = strings.ToLower(u.Host)
+		}
+
+		add(byHost, host, rec)
+
+		slowest = append(slowest, rec)
+		sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].DurationMS > slowest[j].DurationMS })
+
+		if len(slowest) > 5 {
+			slowest = slowest[:5]
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d URL(s), %d bytes\n", all.urls, all.bytes)
+
+	for _, g := range []struct {
+		title  string
+		totals map[string]*reportTotal
+	}{
+		{"By status", byStatus},
+		{"By content type", byType},
+		{"By host", byHost},
+	} {
+		keys := make([]string, 0, len(g.totals))
+		for k := range g.totals {
+			keys = append(keys, k)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := g.totals[keys[i]], g.totals[keys[j]]
+			if a.urls != b.urls {
+				return a.urls > b.urls
+			}
+
+			return keys[i] < keys[j]
+		})
+
+		fmt.Fprintf(w, "%s:\n", g.title)
+
+		for _, k := range keys {
+			fmt.Fprintf(w, "  %-32s %6d URL(s) %14d bytes\n", k, g.totals[k].urls, g.totals[k].bytes)
+		}
+	}
+
+	if len(slowest) > 0 {
+		fmt.Fprintf(w, "Slowest:\n")
+
+		for _, rec := range slowest {
+			fmt.Fprintf(w, "  %8dms %s\n", rec.DurationMS, rec.URL)
+		}
+	}
+
+	return nil
+}
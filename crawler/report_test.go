@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/b.png">b</a> <a href="/missing.html">m</a>`,
+		"/a.html": "aaaa",
+		"/b.png":  "bb",
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.Manifest = filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+
+	if err := Report(o.Manifest, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	for _, want := range []string{
+		"4 URL(s), ",
+		"By status:\n  200                                   3 URL(s)",
+		"  404                                   1 URL(s)              0 bytes",
+		"  image/png                             1 URL(s)              2 bytes",
+		"  " + host,
+		"Slowest:\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("report\n%s\nwant %q in it", b.String(), want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// statusError is a response fetch wouldn't save, keeping its status code so
+// retryable can tell a struggling server from a page that isn't there.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "got bad http status " + e.status
+}
+
+// retryable reports whether a failed download is likely to succeed if tried
+// again: server errors, rate limiting, timeouts, dropped connections and
+// corrupted downloads are, anything else (a 404, a URL that can't be
+// resolved, a full disk) isn't.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests || se.code == http.StatusRequestTimeout
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrChecksum)
+}
+
+// retryLimit is how many times a download failing with err is tried again:
+// Retries if retryable says it's worth it, or if OnStatus says to retry the
+// status it got, in which case statusRetries if Retries is unset.
+func (r *run) retryLimit(err error) int {
+	var se *statusError
+	if errors.As(err, &se) && r.statusActions[se.code] == "retry" {
+		return cmp.Or(r.o.Retries, statusRetries)
+	}
+
+	if retryable(err) {
+		return r.o.Retries
+	}
+
+	return 0
+}
+
+// backoff is how long to wait before retry number attempt (from 0): a second,
+// doubling each time up to a minute, plus up to half as long again at random
+// so downloads failing together don't all come back at once.
+func backoff(attempt int) time.Duration {
+	d := min(time.Second<<min(attempt, 6), time.Minute)
+	return d + time.Duration(rand.Int63n(int64(d/2)+1))
+}
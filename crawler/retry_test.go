@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryLimit(t *testing.T) {
+	r := &run{statusActions: map[int]string{404: "retry", 410: "skip"}}
+
+	for _, c := range []struct {
+		err     error
+		retries int
+		want    int
+	}{
+		{&statusError{503, "503"}, 0, 0},
+		{&statusError{503, "503"}, 5, 5},
+		{&statusError{404, "404"}, 0, statusRetries},
+		{&statusError{404, "404"}, 5, 5},
+		{&statusError{410, "410"}, 5, 0},
+		{&statusError{403, "403"}, 5, 0},
+		{ErrDeclined, 5, 0},
+		{nil, 5, 0},
+	} {
+		r.o.Retries = c.retries
+
+		if got := r.retryLimit(c.err); got != c.want {
+			t.Errorf("retryLimit(%v) with %d retries = %d, want %d", c.err, c.retries, got, c.want)
+		}
+	}
+}
+
+func TestOnStatusRetryPaced(t *testing.T) {
+	const wait = 1600 * time.Millisecond
+
+	var mu sync.Mutex
+	var at []time.Time
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		at = append(at, time.Now())
+
+		// not there the first time round
+		if len(at) == 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, "there")
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/a.txt")
+	o.NoRobots = true
+	o.OnStatus = []string{"404=retry"}
+	o.Wait = wait
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != 1 {
+		t.Errorf("fetched %d, want the retry to get it", res.Fetched)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the backoff alone would be sooner than -wait
+	if len(at) != 2 || at[1].Sub(at[0]) < wait-50*time.Millisecond {
+		t.Errorf("requested at %v, want a retry -wait %v after the first", at, wait)
+	}
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertMirror points the links in the HTML pages and stylesheets of the
+// mirror in dir at the local copies of what they link to, and links to
+// anything not mirrored at its absolute URL, as ConvertLinks does at the end
+// of a crawl, for a mirror made without it. The URL of every file is worked
+// out from where it is in the mirror, https:example.org/a/index.html being
+// https://example.org/a/. It returns how many files it changed.
+func ConvertMirror(dir string) (int, error) {
+	urlPaths, err := mirrorURLs(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	conversions := 0
+
+	for u, path := range urlPaths {
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".html" && ext != ".htm" && ext != ".css" || strings.HasSuffix(u, "/index.html") {
+			continue
+		}
+
+		pu, err := url.Parse(u)
+		if err != nil {
+			continue
+		}
+
+		convert := func(link string) string {
+			return convertLink(path, pu, link, nil, urlPaths)
+		}
+
+		// converting shouldn't make the file look newer than the server's
+		info, err := os.Stat(path)
+		if err != nil {
+			return conversions, err
+		}
+
+		changed := false
+
+		if ext == ".css" {
+			var b []byte
+
+			if b, err = os.ReadFile(path); err == nil {
+				if converted := rewriteCSSURLs(string(b), convert); converted != string(b) {
+					changed = true
+					err = os.WriteFile(path, []byte(converted), 0666)
+				}
+			}
+		} else {
+			changed, err = rewriteHTMLFile(path, convert)
+		}
+
+		if err != nil {
+			return conversions, err
+		}
+
+		if changed {
+			conversions++
+			os.Chtimes(path, info.ModTime(), info.ModTime())
+		}
+	}
+
+	return conversions, nil
+}
+
+// mirrorURLs maps the URL of every file in the mirror in dir to its path,
+// and the URL of every directory with an index.html to that.
+func mirrorURLs(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	urlPaths := map[string]string{}
+
+	for _, e := range entries {
+		// directories are laid out as "https:my.web.site:80"
+		scheme, host, ok := strings.Cut(e.Name(), ":")
+		if !e.IsDir() || !ok || scheme != "http" && scheme != "https" {
+			continue
+		}
+
+		hostDir := filepath.Join(dir, e.Name())
+
+		err = filepath.WalkDir(hostDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// metadata, and files left by interrupted downloads
+			if strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if d.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(hostDir, path)
+			if err != nil {
+				return err
+			}
+
+			p, query, _ := strings.Cut(filepath.ToSlash(rel), "?")
+			u := &url.URL{Scheme: scheme, Host: host, Path: "/" + p, RawQuery: query}
+			urlPaths[u.String()] = path
+
+			if d.Name() == "index.html" && query == "" {
+				u.Path = strings.TrimSuffix(u.Path, "index.html")
+				urlPaths[u.String()] = path
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return urlPaths, nil
+}
@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConvertMirror(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":              `<a href="/docs/">docs</a> <a href="/gone.html">gone</a> <link rel="stylesheet" href="/s.css">`,
+		"/docs/":         `<a href="../">home</a> <a href="/docs/a.html#top">a</a> <img src="/logo.png">`,
+		"/docs/a.html":   "a",
+		"/s.css":         `body { background: url(/logo.png) }`,
+		"/logo.png":      "png",
+		"/gone.html":     "not to be mirrored",
+		"/docs/ignored/": "",
+	})
+
+	o := testOptions(t, s.URL+"/")
+	o.Exclude = []string{`gone\.html$`}
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := ConvertMirror(o.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if converted != 3 {
+		t.Errorf("converted %d files, want the two pages and the stylesheet", converted)
+	}
+
+	for _, c := range []struct {
+		url  string
+		want []string
+	}{
+		{s.URL + "/", []string{`href="docs/index.html"`, `href="` + s.URL + `/gone.html"`, `href="s.css"`}},
+		{s.URL + "/docs/", []string{`href="../index.html"`, `href="a.html#top"`, `src="../logo.png"`}},
+		{s.URL + "/s.css", []string{`url("logo.png")`}},
+	} {
+		b, err := os.ReadFile(mirrored(t, o, c.url))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, w := range c.want {
+			if !strings.Contains(string(b), w) {
+				t.Errorf("%s is %s, want %s in it", c.url, b, w)
+			}
+		}
+	}
+
+	// and there's nothing left to do a second time
+	if converted, err = ConvertMirror(o.Dir); err != nil || converted != 0 {
+		t.Errorf("converted %d again: %v", converted, err)
+	}
+}
+
+func TestRootRelative(t *testing.T) {
+	page := mustParse(t, "https://example.org/docs/a.html")
+
+	for _, c := range []struct {
+		link string
+		want string
+	}{
+		{"https://example.org/docs/b.html", "/docs/b.html"},
+		{"HTTPS://EXAMPLE.ORG/x?y=1#z", "/x?y=1#z"},
+		{"https://example.org", "/"},
+		{"//example.org/img.png", "/img.png"},
+		{" https://example.org/spaced ", "/spaced"},
+		// left as they are
+		{"http://example.org/other-scheme", "http://example.org/other-scheme"},
+		{"https://example.org:8443/other-port", "https://example.org:8443/other-port"},
+		{"https://cdn.example.org/x.js", "https://cdn.example.org/x.js"},
+		{"https://user@example.org/private", "https://user@example.org/private"},
+		{"b.html", "b.html"},
+		{"/already/root.html", "/already/root.html"},
+		{"#top", "#top"},
+		{"mailto:me@example.org", "mailto:me@example.org"},
+	} {
+		if got := rootRelative(page, c.link); got != c.want {
+			t.Errorf("rootRelative(%q) = %q, want %q", c.link, got, c.want)
+		}
+	}
+}
+
+func TestRootRelativeMirror(t *testing.T) {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<a href="%[1]s/a.html">a</a> <img src="%[1]s/logo.png" srcset="%[1]s/logo-2x.png 2x"> <a href="https://elsewhere.example/">away</a> <a href="b.html">b</a>`, s.URL)
+		default:
+			fmt.Fprint(w, "page")
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.RootRelative = true
+
+	if _, err := New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(mirrored(t, o, s.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<a href="/a.html">a</a> <img src="/logo.png" srcset="/logo-2x.png 2x"> <a href="https://elsewhere.example/">away</a> <a href="b.html">b</a>`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	// what's linked is still where a web server would look for it
+	for _, p := range []string{"/a.html", "/logo.png", "/logo-2x.png", "/b.html"} {
+		if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+			t.Errorf("%s not mirrored: %v", p, err)
+		}
+	}
+}
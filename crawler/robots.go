@@ -0,0 +1,277 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsAgent is the user-agent robots.txt groups are matched against when
+// the crawl doesn't send a User-Agent of its own, falling back to the *
+// group when none names it.
+const robotsAgent = "mrdriller"
+
+// robotsTries is how many times an unreachable robots.txt is tried, further
+// and further apart, before the host is left alone; for robotsRecheck, after
+// which it's tried again.
+const (
+	robotsTries   = 4
+	robotsRecheck = 10 * time.Minute
+)
+
+// robotsToken returns the product token robots.txt groups are matched
+// against for a crawl sending userAgent: the name of its first product, or
+// of the one in a "(compatible; Name/1.0)" comment of one made to look like
+// a browser's, or robotsAgent if it's empty.
+func robotsToken(userAgent string) string {
+	if _, comment, ok := strings.Cut(userAgent, "(compatible;"); ok && strings.HasPrefix(userAgent, "Mozilla/") {
+		userAgent = comment
+	}
+
+	token := strings.FieldsFunc(userAgent, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_')
+	})
+	if len(token) == 0 {
+		return robotsAgent
+	}
+
+	return strings.ToLower(token[0])
+}
+
+// robotsRule allows or disallows the paths its pattern matches; the longest
+// matching pattern wins.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsRules are what a host's robots.txt asks of us. A nil *robotsRules
+// allows everything.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsGroup is a run of user-agent lines and the rules following them.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+
+	// closed is set by the first line after the user-agent lines, even an
+	// empty Disallow, after which another user-agent starts a new group
+	closed bool
+}
+
+// parseRobots reads a robots.txt, keeping the groups for agent, a product
+// token as robotsToken returns, or the * groups if none mention it.
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	var groups []*robotsGroup
+	var g *robotsGroup
+
+	s := bufio.NewScanner(r)
+
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// consecutive user-agent lines share the rules that follow
+			if g == nil || g.closed {
+				g = &robotsGroup{}
+				groups = append(groups, g)
+			}
+
+			g.agents = append(g.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if g == nil {
+				continue
+			}
+
+			g.closed = true
+
+			if value == "" {
+				continue
+			}
+
+			g.rules = append(g.rules, robotsRule{key == "allow", value, robotsPattern(value)})
+		case "crawl-delay":
+			if g == nil {
+				continue
+			}
+
+			g.closed = true
+
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				g.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+
+	for _, agent := range []string{agent, "*"} {
+		var rules *robotsRules
+
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if a == agent {
+					if rules == nil {
+						rules = &robotsRules{}
+					}
+
+					rules.rules = append(rules.rules, g.rules...)
+					rules.crawlDelay = max(rules.crawlDelay, g.crawlDelay)
+
+					break
+				}
+			}
+		}
+
+		if rules != nil {
+			return rules
+		}
+	}
+
+	return nil
+}
+
+// robotsPattern turns a path pattern, where * matches anything and a
+// trailing $ anchors the end, into a regexp.
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether path, including any query, may be crawled.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+
+	allow, longest := true, -1
+
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+
+		// on a tie, allow wins
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allow, longest = rule.allow, len(rule.pattern)
+		}
+	}
+
+	return allow
+}
+
+// disallowAll are the rules of a host whose robots.txt can't be had.
+var disallowAll = &robotsRules{rules: []robotsRule{{false, "/", robotsPattern("/")}}}
+
+// robotsEntry is the robots.txt of an origin, fetched by the first worker
+// to need it while any others wait for ready to be closed. expires is when
+// rules that are only disallowAll because it couldn't be had run out.
+type robotsEntry struct {
+	ready   chan struct{}
+	rules   *robotsRules
+	expires time.Time
+}
+
+// robotsFor returns the robots.txt rules for u, fetching them the first
+// time its origin comes up. A Crawl-delay in them slows down the host.
+//
+// Like RFC 9309 says, a robots.txt the server fails to give disallows
+// everything while it does, as the server may be struggling, but that's
+// taken to be temporary: it's tried again robotsTries times, the URLs of
+// the host waiting meanwhile, and if it's still not to be had, the host is
+// left alone for robotsRecheck before it's tried once more.
+func (r *run) robotsFor(u *url.URL) *robotsRules {
+	origin := u.Scheme + "://" + strings.ToLower(u.Host)
+
+	r.robotsMu.Lock()
+	e, ok := r.robots[origin]
+	if ok && !e.expires.IsZero() && now().After(e.expires) {
+		ok = false
+	}
+
+	if !ok {
+		e = &robotsEntry{ready: make(chan struct{})}
+		r.robots[origin] = e
+	}
+	r.robotsMu.Unlock()
+
+	if ok {
+		<-e.ready
+		return e.rules
+	}
+
+	defer close(e.ready)
+
+	for attempt := 0; ; attempt++ {
+		rules, err := r.getRobots(u.Scheme, u.Host)
+		if err == nil {
+			e.rules = rules
+			break
+		}
+
+		if attempt+1 == robotsTries || r.ctx.Err() != nil {
+			r.log.Warn("could not get robots.txt, not crawling the host for now", "host", u.Host, "err", err, "for", robotsRecheck)
+			e.rules, e.expires = disallowAll, now().Add(robotsRecheck)
+			break
+		}
+
+		d := backoff(attempt)
+		r.log.Warn("could not get robots.txt, retrying", "host", u.Host, "err", err, "in", d.Round(time.Millisecond))
+		r.sleep(d)
+	}
+
+	if e.rules != nil && e.rules.crawlDelay > 0 {
+		r.pacer.slowDown(strings.ToLower(u.Host), e.rules.crawlDelay)
+	}
+
+	return e.rules
+}
+
+// getRobots fetches and parses robots.txt from the root of scheme://host. A
+// missing one allows everything; it fails if the server couldn't be reached,
+// had an error or asked to be given time.
+func (r *run) getRobots(scheme string, host string) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(r.ctx, "GET", scheme+"://"+host+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return parseRobots(io.LimitReader(resp.Body, 1<<20), r.robotsAgent), nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &statusError{resp.StatusCode, resp.Status}
+	default:
+		return nil, nil
+	}
+}
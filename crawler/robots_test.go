@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRobotsToken(t *testing.T) {
+	for _, c := range []struct{ ua, want string }{
+		{"", "mrdriller"},
+		{"MyBot/2.0 (+https://example.org/bot)", "mybot"},
+		{"archive_crawler", "archive_crawler"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "googlebot"},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36", "mozilla"},
+		{"  /1.0", "mrdriller"},
+	} {
+		if got := robotsToken(c.ua); got != c.want {
+			t.Errorf("robotsToken(%q) = %q, want %q", c.ua, got, c.want)
+		}
+	}
+}
+
+func TestRobotsUserAgent(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":       `<a href="/a.html">a</a> <a href="/b.html">b</a> <a href="/c.html">c</a>`,
+		"/a.html": "a",
+		"/b.html": "b",
+		"/c.html": "c",
+		"/robots.txt": `User-agent: mrdriller
+Disallow: /a.html
+
+User-agent: mybot
+Disallow: /b.html
+
+User-agent: *
+Disallow: /c.html
+`,
+	})
+
+	for _, c := range []struct {
+		name      string
+		userAgent string
+		header    string
+		skipped   string
+	}{
+		{"default", "", "", "/a.html"},
+		{"user-agent", "MyBot/1.0", "", "/b.html"},
+		{"header", "", "User-Agent: MyBot/1.0", "/b.html"},
+		{"unnamed", "OtherBot/1.0", "", "/c.html"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			o := testOptions(t, s.URL+"/")
+			o.UserAgent = c.userAgent
+
+			if c.header != "" {
+				o.Headers = []string{c.header}
+			}
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, p := range []string{"/a.html", "/b.html", "/c.html"} {
+				_, err := os.Stat(mirrored(t, o, s.URL+p))
+				if got, want := err == nil, p != c.skipped; got != want {
+					t.Errorf("%s saved %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRobotsUnavailable(t *testing.T) {
+	var mu sync.Mutex
+	robots := 0
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			mu.Lock()
+			robots++
+			n := robots
+			mu.Unlock()
+
+			// struggling at first
+			if n == 1 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private.html\n")
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a.html">a</a> <a href="/private.html">p</a>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/"))
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != 2 {
+		t.Errorf("fetched %d, want the start page and a.html once robots.txt came", res.Fetched)
+	}
+
+	if _, err := os.Stat(mirrored(t, o, s.URL+"/private.html")); err == nil {
+		t.Error("private.html saved, want it disallowed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if robots != 2 {
+		t.Errorf("robots.txt requested %d times, want it tried again once", robots)
+	}
+}
@@ -0,0 +1,990 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// run is a crawl in progress: the settings Run worked out from the Options,
+// the files it writes to and the state of the crawl itself.
+//
+// The workers only read the settings, which never change once the crawl is
+// under way, but for robots and pacer, which lock themselves, and
+// navigations. The rest is only touched from the crawl loop, but for queue,
+// current and inflight, which are also read from other goroutines, for the
+// metrics and ExportFrontier, under queueMu.
+type run struct {
+	o   Options
+	ctx context.Context
+
+	log      *slog.Logger
+	out      io.Writer
+	progress *progressBars
+	client   *http.Client
+
+	// transport is what client's transport is built on, without the
+	// headers and credentials meant for the crawled sites, for requests
+	// made elsewhere, such as to the bucket of Output
+	transport http.RoundTripper
+
+	// redirects counts every redirect followed by client during the
+	// crawl, by any of the workers
+	redirects atomic.Int64
+
+	// statusActions maps HTTP status codes to what fetch should do when it
+	// gets one instead of a 200, as configured with OnStatus:
+	//
+	//   - "skip" quietly drops the URL without reporting an error
+	//   - "retry" fails it to be tried again like a server error, see
+	//     retryLimit
+	//   - "record" saves the response body as if it were a 200
+	//
+	// Anything unmapped fails the download as usual.
+	statusActions map[int]string
+
+	// challengeMarkers, when set, makes fetch check the start of every
+	// response against these before saving it, failing with ErrChallenge
+	// on a match
+	challengeMarkers []*regexp.Regexp
+
+	// limiter throttles every download together for LimitRate, nil when
+	// there's no limit
+	limiter *rateLimiter
+
+	// decide is Options.Decide with HeaderFilter in front of it, if either
+	// is set, called when Options.Decide says; fetch returns ErrDeclined
+	// for the downloads it vetoes.
+	decide func(url string, header http.Header) bool
+
+	// maxFileSize and minFileSize, when non-zero, decline downloads larger
+	// or smaller than that many bytes, judged by Content-Length where
+	// there is one and otherwise by what arrives
+	maxFileSize, minFileSize int64
+
+	checksumFiles checksumFiles
+
+	includeRE []*regexp.Regexp
+	excludeRE []*regexp.Regexp
+	refreshRE []*regexp.Regexp
+	seedRE    []*regexp.Regexp
+
+	// strip are the query parameters taken off every URL, in lower case
+	strip []string
+
+	types      typeDirs
+	sched      schedule
+	pacer      hostPacer
+	quotaBytes int64
+	spent      *ledger
+
+	// start is the first start URL, as startURL once stripped, whose host
+	// the crawl is about
+	start    *url.URL
+	startURL string
+	host     string
+
+	// startHosts are the hosts of all the start URLs, crawled alike, with
+	// a shared queue
+	startHosts map[string]bool
+
+	// site is the domain whose subdomains IncludeSubdomains crawls: from
+	// www.example.org, those of example.org
+	site []string
+
+	// dir is the mirror directory
+	dir string
+
+	// metadata records the title and description of every page crawled
+	// for PageMetadata
+	metadata *json.Encoder
+
+	redirectMap *json.Encoder
+	index       *crawlIndex
+	manifest    *crawlManifest
+	archive     *outputArchive
+	warc        *warcWriter
+	events      *eventStream
+	jr          *journal
+	metrics     *crawlMetrics
+
+	// store is where downloads are moved once complete, if not left in the
+	// mirror directory, shown as storeName
+	store     Storage
+	storeName string
+
+	// closers close what was opened for the crawl once it's over, last
+	// first
+	closers []func()
+
+	// the queue and the URL being worked on make up the frontier, which
+	// ExportFrontier may write out from another goroutine
+	queueMu sync.Mutex
+	queue   []item
+	current *item
+
+	// inflight are the URLs handed to workers, by the path they're
+	// downloaded to
+	inflight map[string]item
+
+	jobs chan *job
+	done chan *job
+
+	seen map[string]struct{}
+
+	// navigated records URLs that were only crawled through without being
+	// saved, so they can be revisited if later found within reach of a seed
+	navigated map[string]struct{}
+
+	// downloads counts successfully fetched URLs, for MaxRedirectRatio
+	downloads      int
+	redirectWarned bool
+
+	// simhashes of kept pages, scanned linearly so only suitable for
+	// crawls of modest size
+	pages      []fingerprint
+	nearDups   []string
+	challenges []string
+
+	// perHost accumulates download statistics for HostStats
+	perHost hostTable
+
+	// traps collects URLs skipped as likely crawler traps, for reporting
+	traps []string
+
+	// queryVariants counts the query strings crawled for each path
+	queryVariants map[string]uint
+
+	// templates counts the URLs crawled for each urlTemplate
+	templates map[string]uint
+
+	// checksums collects the SHA-256 of every file in the mirror for
+	// ChecksumManifest, nil for files that were already up to date
+	checksums map[string][]byte
+
+	// urlPaths maps every URL saved, or found up to date, to where it is
+	urlPaths map[string]string
+
+	// fontRefs lists the fonts each downloaded stylesheet declares, so
+	// they can be pointed at their local copies once fetched
+	fontRefs map[string][]fontRef
+
+	// convertPages are the pages and stylesheets downloaded, by path, for
+	// ConvertLinks, with what the crawl resolved the links in them to
+	convertPages map[string]*convertPage
+
+	// collapsed are the pages left out for their canonical URL
+	collapsed map[string]bool
+
+	// robots caches the robots.txt rules of every origin crawled, for
+	// the workers to share under robotsMu
+	robotsMu sync.Mutex
+	robots   map[string]*robotsEntry
+
+	// robotsAgent is the product token of the User-Agent sent, which
+	// robots.txt groups are matched against
+	robotsAgent string
+
+	// archives are written by host with ArchivePerHost
+	archives *hostArchives
+
+	// pages only crawled through are downloaded to navPath with a number
+	// on the end, one each, as workers may be passing through several
+	navPath     string
+	navigations atomic.Int64
+
+	// summary totals up the crawl for the log, SummaryFile and NotifyURL
+	summary *crawlSummary
+	started time.Time
+
+	// with PlanFirst the crawl runs twice, first only to HEAD everything
+	// in scope and report what would be downloaded
+	planning bool
+	plan     crawlPlan
+
+	// aborted is why Strict ended the crawl, once it has
+	aborted  string
+	timedOut bool
+
+	// received is how many bytes this crawl has downloaded, for Quota
+	received int64
+
+	// fetches counts the downloads started, for MaxFiles
+	fetches uint
+}
+
+// newRun works out the settings of a crawl from opts, failing if they're
+// invalid, ready to open its files.
+func newRun(ctx context.Context, opts Options) (*run, error) {
+	r := &run{o: opts, ctx: ctx, statusActions: map[int]string{}}
+	r.checksumFiles.sums = map[string]map[string][]byte{}
+
+	o := &r.o
+
+	r.log = o.Logger
+	if r.log == nil {
+		r.log = slog.New(newPlainHandler(os.Stderr, slog.LevelInfo))
+	}
+
+	r.out = o.Out
+	if r.out == nil {
+		r.out = os.Stdout
+	}
+
+	if len(o.URLs) == 0 {
+		return nil, errors.New("no URL to start from")
+	}
+
+	if len(o.Include) == 0 {
+		o.Include = []string{".*"}
+	}
+
+	for _, p := range []struct {
+		patterns []string
+		re       *[]*regexp.Regexp
+	}{{o.Include, &r.includeRE}, {o.Exclude, &r.excludeRE}, {o.Refresh, &r.refreshRE}, {o.Seed, &r.seedRE}} {
+		for _, s := range p.patterns {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile regexp `%s`: %v", s, err)
+			}
+
+			*p.re = append(*p.re, re)
+		}
+	}
+
+	markers := o.ChallengeMarkers
+
+	if o.DetectChallenges {
+		if len(markers) == 0 {
+			markers = defaultChallengeMarkers
+		}
+
+		r.challengeMarkers = []*regexp.Regexp{}
+	}
+
+	for _, s := range markers {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile regexp `%s`: %v", s, err)
+		}
+
+		r.challengeMarkers = append(r.challengeMarkers, re)
+	}
+
+	if o.PageRequisites {
+		o.PageRequisitesSpanHosts = true
+	}
+
+	// a spider is a plan listing what it found instead of totalling it
+	if o.Spider {
+		o.PlanOnly = true
+	}
+
+	if o.SpanHosts != (len(o.Domains) > 0) {
+		return nil, errors.New("SpanHosts and Domains must be given together")
+	}
+
+	if o.OutputArchive != "" && (o.ArchivePerHost != "" || o.VerifyComplete || o.ConvertLinks) {
+		return nil, errors.New("OutputArchive can't be combined with ArchivePerHost, VerifyComplete or ConvertLinks")
+	}
+
+	if (o.Output != "" || o.Storage != nil) && (o.OutputArchive != "" || o.BaseArchive != "" || o.ArchivePerHost != "" || o.VerifyComplete || o.ConvertLinks || o.WebFonts) {
+		return nil, errors.New("Output can't be combined with OutputArchive, BaseArchive, ArchivePerHost, VerifyComplete, ConvertLinks or WebFonts")
+	}
+
+	if o.NoCookies && (o.LoadCookies != "" || o.SaveCookies != "") {
+		return nil, errors.New("NoCookies can't be combined with LoadCookies or SaveCookies")
+	}
+
+	r.client = &http.Client{CheckRedirect: r.countRedirect, Timeout: o.RequestTimeout}
+
+	// cookies are kept for the length of the crawl even without a file
+	if !o.NoCookies {
+		jar := &cookieJar{}
+
+		if o.LoadCookies != "" {
+			if err := jar.load(o.LoadCookies); err != nil {
+				return nil, fmt.Errorf("could not load cookies: %v", err)
+			}
+		}
+
+		r.client.Jar = jar
+	}
+
+	if o.TypeDir != "" {
+		var err error
+
+		r.types, err = parseTypeDirs(o.TypeDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TypeDir: %v", err)
+		}
+	}
+
+	if o.Schedule != "" {
+		var err error
+
+		r.sched, err = parseSchedule(o.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Schedule: %v", err)
+		}
+	}
+
+	r.pacer = hostPacer{wait: o.Wait, random: o.RandomWait}
+
+	// the User-Agent may come with the other headers
+	userAgent := o.UserAgent
+	for _, h := range o.Headers {
+		if name, value, ok := strings.Cut(h, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "User-Agent") && userAgent == "" {
+			userAgent = strings.TrimSpace(value)
+		}
+	}
+
+	r.robotsAgent = robotsToken(userAgent)
+
+	for _, s := range []struct {
+		name  string
+		value string
+		size  *int64
+	}{{"MaxFilesize", o.MaxFilesize, &r.maxFileSize}, {"MinFilesize", o.MinFilesize, &r.minFileSize}} {
+		if s.value == "" {
+			continue
+		}
+
+		size, err := parseSize(s.value)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid %s `%s`, expected a number of bytes like 10M", s.name, s.value)
+		}
+
+		*s.size = size
+	}
+
+	if o.LimitRate != "" {
+		rate, err := parseSize(o.LimitRate)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid LimitRate `%s`, expected a number of bytes per second like 500k", o.LimitRate)
+		}
+
+		r.limiter = newRateLimiter(rate)
+	}
+
+	for _, m := range o.OnStatus {
+		code, action, ok := strings.Cut(m, "=")
+		status, err := strconv.Atoi(code)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid OnStatus mapping `%s`, expected status=action", m)
+		}
+
+		switch action {
+		case "skip", "retry", "record":
+			r.statusActions[status] = action
+		default:
+			return nil, fmt.Errorf("invalid OnStatus action `%s`, expected skip, retry or record", action)
+		}
+	}
+
+	r.decide = o.Decide
+
+	if o.HeaderFilter != "" {
+		skip, err := parseHeaderFilter(o.HeaderFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HeaderFilter `%s`: %v", o.HeaderFilter, err)
+		}
+
+		prev := r.decide
+		r.decide = func(url string, header http.Header) bool {
+			if skip.eval(header) {
+				return false
+			}
+
+			return prev == nil || prev(url, header)
+		}
+	}
+
+	switch o.CrossScheme {
+	case "follow", "upgrade", "skip":
+	default:
+		return nil, fmt.Errorf("invalid CrossScheme `%s`, expected follow, upgrade or skip", o.CrossScheme)
+	}
+
+	switch o.Canonical {
+	case "keep", "collapse":
+	default:
+		return nil, fmt.Errorf("invalid Canonical `%s`, expected keep or collapse", o.Canonical)
+	}
+
+	if o.Quota != "" {
+		var err error
+
+		r.quotaBytes, err = parseSize(o.Quota)
+		if err != nil || r.quotaBytes <= 0 {
+			return nil, fmt.Errorf("invalid Quota `%s`, expected a number of bytes like 5G", o.Quota)
+		}
+	}
+
+	if o.Budget != "" || o.BudgetFile != "" {
+		if o.Budget == "" || o.BudgetFile == "" {
+			return nil, errors.New("Budget and BudgetFile must be given together")
+		}
+
+		b, err := parseBudget(o.Budget)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Budget: %v", err)
+		}
+
+		r.spent, err = loadLedger(o.BudgetFile, b)
+		if err != nil {
+			return nil, fmt.Errorf("could not read budget file: %v", err)
+		}
+
+		if r.spent.exhausted(now()) {
+			return nil, fmt.Errorf("the budget of %s is already used up", o.Budget)
+		}
+	}
+
+	if o.JPEGQuality < 1 || o.JPEGQuality > 100 {
+		return nil, fmt.Errorf("invalid JPEGQuality %d, expected 1 to 100", o.JPEGQuality)
+	}
+
+	if o.Verify != "" && o.Verify != "sha256" && o.Verify != "md5" {
+		return nil, fmt.Errorf("invalid Verify `%s`, expected sha256 or md5", o.Verify)
+	}
+
+	if o.VerifySums != "" && o.Verify == "" {
+		return nil, errors.New("VerifySums needs Verify")
+	}
+
+	if o.Workers < 1 {
+		return nil, fmt.Errorf("invalid Workers %d, expected at least 1", o.Workers)
+	}
+
+	if o.ContinueCrawl != "" && o.StateFile != "" {
+		return nil, errors.New("ContinueCrawl can't be combined with StateFile")
+	}
+
+	u, err := url.Parse(o.URLs[0])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL %s: %v", o.URLs[0], err)
+	}
+
+	if !strings.HasPrefix(u.Scheme, "http") {
+		return nil, errors.New("URL must be http or https")
+	}
+
+	r.strip = append([]string(nil), o.StripParams...)
+	if !o.KeepTrackingParams {
+		r.strip = append(r.strip, trackingParams...)
+	}
+
+	for i := range r.strip {
+		r.strip[i] = strings.ToLower(r.strip[i])
+	}
+
+	r.startURL = o.URLs[0]
+	if query := u.RawQuery; query != "" {
+		if stripParams(u, r.strip); u.RawQuery != query {
+			r.startURL = u.String()
+		}
+	}
+
+	r.start = u
+	r.host = strings.ToLower(u.Host)
+	r.startHosts = map[string]bool{r.host: true}
+	r.site = []string{strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")}
+
+	if err = r.setTransport(); err != nil {
+		return nil, err
+	}
+
+	r.dir, err = filepath.Abs(o.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the mirror directory: %w", err)
+	}
+
+	r.log.Debug("Settings", "depth", o.Depth, "includes", o.Include, "excludes", o.Exclude, "refresh", o.Refresh, "seeds", o.Seed)
+
+	return r, nil
+}
+
+// setTransport sets up the client's transport for the proxy, TLS, timeouts,
+// HTTP/3, headers and credentials the options ask for.
+func (r *run) setTransport() error {
+	o := &r.o
+
+	var transport http.RoundTripper = http.DefaultTransport
+
+	var proxyURL *url.URL
+
+	if o.Proxy != "" {
+		var err error
+
+		proxyURL, err = url.Parse(o.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("invalid Proxy `%s`, expected scheme://host:port", o.Proxy)
+		}
+
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("invalid Proxy `%s`, expected an http, https or socks5 proxy", o.Proxy)
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(o.Insecure, o.CACert, o.Cert, o.Key, o.PinSHA256)
+	if err != nil {
+		return fmt.Errorf("invalid TLS settings: %v", err)
+	}
+
+	if o.ConnectTimeout > 0 || o.ReadTimeout > 0 || proxyURL != nil || tlsConfig != nil {
+		t := newTransport(o.ConnectTimeout, o.ReadTimeout, proxyURL)
+		t.TLSClientConfig = tlsConfig
+
+		transport = t
+		r.client.Transport = transport
+	}
+
+	// the bucket of Output goes through the same proxy and trusts the
+	// same CA, but the pins and client certificate are the crawled site's,
+	// and an upload can leave the connection with nothing to read for
+	// longer than ReadTimeout
+	r.transport = transport
+	if transport != http.DefaultTransport {
+		t := newTransport(o.ConnectTimeout, 0, proxyURL)
+		t.TLSClientConfig, _ = newTLSConfig(o.Insecure, o.CACert, "", "", nil)
+
+		r.transport = t
+	}
+
+	if o.HTTP3 {
+		if proxyURL != nil {
+			return errors.New("HTTP3 can't be combined with Proxy")
+		}
+
+		h3 := newHTTP3Transport(transport, tlsConfig, o.ConnectTimeout, o.ReadTimeout, r.log)
+		r.closers = append(r.closers, h3.close)
+
+		transport = h3
+		r.client.Transport = transport
+	}
+
+	transport = &decodeTransport{transport}
+	r.client.Transport = transport
+
+	if o.UserAgent != "" || len(o.Headers) > 0 {
+		header := http.Header{}
+
+		for _, h := range o.Headers {
+			name, value, ok := strings.Cut(h, ":")
+			if !ok || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("invalid Headers `%s`, expected Name: value", h)
+			}
+
+			header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+
+		if o.UserAgent != "" {
+			header.Set("User-Agent", o.UserAgent)
+		}
+
+		transport = &headerTransport{transport, header}
+		r.client.Transport = transport
+	}
+
+	if o.Bearer != "" || o.AuthHeaderFile != "" {
+		if o.AuthCommand != "" {
+			return errors.New("AuthCommand can't be combined with Bearer or AuthHeaderFile")
+		}
+
+		header := http.Header{}
+
+		if o.AuthHeaderFile != "" {
+			if header, err = readHeaderFile(o.AuthHeaderFile); err != nil {
+				return fmt.Errorf("could not read AuthHeaderFile: %v", err)
+			}
+		}
+
+		if o.Bearer != "" {
+			header.Set("Authorization", "Bearer "+o.Bearer)
+		}
+
+		r.client.Transport = &hostHeaderTransport{transport, r.start.Scheme, r.start.Host, header}
+	}
+
+	if o.AuthCommand != "" {
+		r.client.Transport = &tokenTransport{
+			base:    transport,
+			command: o.AuthCommand,
+			scheme:  r.start.Scheme,
+			host:    r.start.Host,
+		}
+	}
+
+	return nil
+}
+
+// open opens the files the crawl writes to and fills the queue, from the
+// start URLs, the frontier or state left by an earlier crawl, and sitemaps.
+// What it opened is closed by close, even when it fails halfway.
+func (r *run) open() error {
+	o := &r.o
+
+	// bars are only for someone watching
+	if o.Progress && isTerminal(os.Stderr) {
+		r.progress = newProgressBars(os.Stderr)
+		r.closers = append(r.closers, r.progress.close)
+
+		// so lines logged as text scroll by above them
+		if h, ok := r.log.Handler().(*plainHandler); ok && h.w == io.Writer(os.Stderr) {
+			r.log = slog.New(h.to(r.progress))
+		}
+	}
+
+	var err error
+
+	if o.PageMetadata != "" {
+		f, err := os.Create(o.PageMetadata)
+		if err != nil {
+			return fmt.Errorf("could not create page metadata file: %w", err)
+		}
+
+		r.closers = append(r.closers, func() { f.Close() })
+
+		r.metadata = json.NewEncoder(f)
+	}
+
+	if o.Index != "" {
+		r.index, err = createIndex(o.Index)
+		if err != nil {
+			return fmt.Errorf("could not create index file: %w", err)
+		}
+
+		r.closers = append(r.closers, func() {
+			if err := r.index.close(); err != nil {
+				r.log.Warn("could not write index file", "err", err)
+			}
+		})
+	}
+
+	if o.Manifest != "" {
+		r.manifest, err = createManifest(o.Manifest)
+		if err != nil {
+			return fmt.Errorf("could not create manifest file: %w", err)
+		}
+
+		r.closers = append(r.closers, func() {
+			if err := r.manifest.close(); err != nil {
+				r.log.Warn("could not write manifest file", "err", err)
+			}
+		})
+	}
+
+	if o.ArchivePerHost != "" {
+		if r.archives, err = newHostArchives(o.ArchivePerHost); err != nil {
+			return err
+		}
+	}
+
+	if o.OutputArchive != "" {
+		r.archive, err = createOutputArchive(o.OutputArchive)
+		if err != nil {
+			return fmt.Errorf("could not create output archive: %w", err)
+		}
+
+		r.closers = append(r.closers, func() {
+			if err := r.archive.close(); err != nil {
+				r.log.Warn("could not write output archive", "err", err)
+			}
+		})
+	}
+
+	r.store, r.storeName = o.Storage, o.Output
+
+	if r.store == nil && o.Output != "" {
+		r.store, err = openStorage(o.Output, r.transport)
+		if err != nil {
+			return fmt.Errorf("invalid Output `%s`: %v", o.Output, err)
+		}
+	}
+
+	if r.storeName == "" {
+		r.storeName = "storage"
+	}
+
+	if o.WARCFile != "" {
+		r.warc, err = createWARC(o.WARCFile)
+		if err != nil {
+			return fmt.Errorf("could not create WARC file: %w", err)
+		}
+
+		r.closers = append(r.closers, func() {
+			if err := r.warc.close(); err != nil {
+				r.log.Warn("could not write WARC file", "err", err)
+			}
+		})
+	}
+
+	if o.RedirectMap != "" {
+		f, err := os.Create(o.RedirectMap)
+		if err != nil {
+			return fmt.Errorf("could not create redirect map file: %w", err)
+		}
+
+		r.closers = append(r.closers, func() { f.Close() })
+
+		r.redirectMap = json.NewEncoder(f)
+	}
+
+	if o.EventSocket != "" {
+		r.events, err = openEventStream(o.EventSocket, r.log)
+		if err != nil {
+			return fmt.Errorf("could not open event socket: %w", err)
+		}
+
+		r.closers = append(r.closers, r.events.close)
+	}
+
+	nav, err := os.MkdirTemp("", "mrdriller-")
+	if err != nil {
+		return fmt.Errorf("could not create a directory for pages crawled through: %w", err)
+	}
+
+	r.closers = append(r.closers, func() { os.RemoveAll(nav) })
+	r.navPath = filepath.Join(nav, "navigation")
+
+	if err = r.fillQueue(); err != nil {
+		return err
+	}
+
+	r.inflight = map[string]item{}
+
+	if o.MetricsAddr != "" {
+		r.metrics = newCrawlMetrics(func() int {
+			r.queueMu.Lock()
+			defer r.queueMu.Unlock()
+
+			return len(r.queue)
+		}, func() int {
+			r.queueMu.Lock()
+			defer r.queueMu.Unlock()
+
+			return len(r.inflight)
+		})
+
+		ln, err := net.Listen("tcp", o.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("could not serve metrics: %w", err)
+		}
+
+		r.closers = append(r.closers, func() { ln.Close() })
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", r.metrics)
+
+		go http.Serve(ln, mux)
+	}
+
+	return nil
+}
+
+// fillQueue queues the start URLs, or the frontier or state of an earlier
+// crawl, and what the sitemaps list.
+func (r *run) fillQueue() error {
+	o := &r.o
+
+	r.queue = []item{{r.startURL, 0, -1, ""}}
+	r.seen = map[string]struct{}{}
+
+	// start URLs after the first are crawled like those listed
+	for _, s := range o.URLs[1:] {
+		su, err := url.Parse(s)
+		if err != nil || su.Scheme != "http" && su.Scheme != "https" || su.Host == "" {
+			return fmt.Errorf("invalid start URL %s, expected an http or https URL", s)
+		}
+
+		stripParams(su, r.strip)
+		r.queue = append(r.queue, item{su.String(), 0, -1, ""})
+		r.startHosts[strings.ToLower(su.Host)] = true
+	}
+
+	if o.FrontierIn != "" {
+		entries, err := readFrontier(o.FrontierIn)
+		if err != nil {
+			return fmt.Errorf("could not import frontier: %w", err)
+		}
+
+		r.queue = r.queue[:0]
+		for _, e := range entries {
+			r.queue = append(r.queue, item{e.URL, e.Depth, e.Hops, e.Parent})
+		}
+
+		r.log.Info("Imported queued URLs", "count", len(r.queue), "file", o.FrontierIn)
+	}
+
+	var state *crawlState
+	var err error
+
+	resumeFrom := o.StateFile
+
+	if o.StateFile != "" {
+		state, err = loadState(o.StateFile)
+		if err != nil {
+			return fmt.Errorf("could not read state file: %w", err)
+		}
+	}
+
+	if o.ContinueCrawl != "" {
+		r.jr, state, err = openJournal(o.ContinueCrawl, r.log)
+		if err != nil {
+			return fmt.Errorf("could not open crawl journal: %w", err)
+		}
+
+		r.closers = append(r.closers, func() {
+			if err := r.jr.close(); err != nil {
+				r.log.Warn("could not write crawl journal", "err", err)
+			}
+		})
+
+		resumeFrom = o.ContinueCrawl
+	}
+
+	if state != nil {
+		r.queue = r.queue[:0]
+		for _, e := range state.Frontier {
+			r.queue = append(r.queue, item{e.URL, e.Depth, e.Hops, e.Parent})
+		}
+
+		for _, s := range state.Seen {
+			r.seen[s] = struct{}{}
+		}
+
+		r.log.Info("Resuming", "file", resumeFrom, "queued", len(r.queue), "seen", len(r.seen))
+	}
+
+	if (o.Sitemap || o.UseSitemapHints) && state == nil {
+		var sitemaps []string
+
+		if o.Sitemap {
+			sitemaps = append(sitemaps, r.start.Scheme+"://"+r.start.Host+"/sitemap.xml")
+		}
+
+		if o.UseSitemapHints {
+			hints, err := r.robotsSitemapHints(r.start.Scheme, r.start.Host)
+			if err != nil {
+				r.log.Warn("could not read robots.txt for sitemap hints", "err", err)
+			}
+
+			sitemaps = append(sitemaps, hints...)
+		}
+
+		queued := map[string]bool{r.startURL: true}
+
+		for _, p := range r.fetchSitemaps(sitemaps) {
+			// sitemaps may only list URLs of their own site
+			pu, err := url.Parse(p)
+			if err != nil || strings.ToLower(pu.Host) != r.host {
+				continue
+			}
+
+			stripParams(pu, r.strip)
+			if p = pu.String(); queued[p] {
+				continue
+			}
+
+			queued[p] = true
+			r.queue = append(r.queue, item{p, 1, -1, ""})
+		}
+
+		r.log.Info("Queued URLs from sitemaps", "count", len(queued)-1, "sitemaps", len(sitemaps))
+	}
+
+	if state == nil {
+		for _, i := range r.queue {
+			r.jr.queued(frontierEntry{i.url, i.depth, i.parent, i.hops})
+		}
+	}
+
+	return nil
+}
+
+// close closes what open opened, last first.
+func (r *run) close() {
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		r.closers[i]()
+	}
+}
+
+// crawlHost reports whether links to h are followed, which those to the
+// start URLs' hosts always are.
+func (r *run) crawlHost(h string) bool {
+	h = strings.ToLower(h)
+	return r.startHosts[h] || r.o.SpanHosts && inDomain(h, r.o.Domains) || r.o.IncludeSubdomains && inDomain(h, r.site)
+}
+
+// withinSeed reports whether a URL hops links away from a page matching
+// Seed is near enough to keep.
+func (r *run) withinSeed(hops int) bool {
+	return len(r.seedRE) == 0 || (hops >= 0 && hops <= int(r.o.SeedHops))
+}
+
+// exportFrontier writes the URLs queued and being downloaded to
+// FrontierOut.
+func (r *run) exportFrontier() error {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	var entries []frontierEntry
+
+	if r.current != nil {
+		entries = append(entries, frontierEntry{r.current.url, r.current.depth, r.current.parent, r.current.hops})
+	}
+
+	for _, i := range r.inflight {
+		entries = append(entries, frontierEntry{i.url, i.depth, i.parent, i.hops})
+	}
+
+	for _, i := range r.queue {
+		entries = append(entries, frontierEntry{i.url, i.depth, i.parent, i.hops})
+	}
+
+	return writeFrontier(r.o.FrontierOut, entries)
+}
+
+// notifyAborted lets NotifyURL know why the crawl ended early.
+func (r *run) notifyAborted(reason string) {
+	if r.o.NotifyURL != "" {
+		r.summary.finish(time.Since(r.started))
+
+		if err := notify(r.o.NotifyURL, r.startURL, r.summary, true, reason); err != nil {
+			r.log.Warn("could not notify webhook", "err", err)
+		}
+	}
+}
+
+// sleep waits for d, or until the crawl is cancelled.
+func (r *run) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-r.ctx.Done():
+	}
+}
@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// now is the clock the schedule is consulted against.
+var now = time.Now
+
+// scheduleRule applies delay to requests made between start (inclusive) and
+// end (exclusive), both counted in minutes since local midnight. A rule
+// whose end comes before its start wraps around midnight, and one whose
+// start and end are the same covers the whole day.
+type scheduleRule struct {
+	start int
+	end   int
+	delay time.Duration
+}
+
+// schedule is a list of rules, the first one matching the time of day wins.
+type schedule []scheduleRule
+
+// parseSchedule parses a -schedule value: comma separated HH:MM-HH:MM=delay
+// rules, e.g. "09:00-17:00=5s,17:00-09:00=0s".
+func parseSchedule(s string) (schedule, error) {
+	var sched schedule
+
+	for _, r := range strings.Split(s, ",") {
+		span, d, ok := strings.Cut(strings.TrimSpace(r), "=")
+		if !ok {
+			return nil, fmt.Errorf("rule `%s` is not of the form HH:MM-HH:MM=delay", r)
+		}
+
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("rule `%s` is not of the form HH:MM-HH:MM=delay", r)
+		}
+
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+
+		delay, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("bad delay in rule `%s`: %w", r, err)
+		}
+
+		sched = append(sched, scheduleRule{start, end, delay})
+	}
+
+	return sched, nil
+}
+
+// parseClock turns "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time of day `%s`, expected HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// delay returns how long to wait before a request made at t.
+func (s schedule) delay(t time.Time) time.Duration {
+	m := t.Hour()*60 + t.Minute()
+
+	for _, r := range s {
+		switch {
+		case r.start == r.end:
+			return r.delay
+		case r.start < r.end && m >= r.start && m < r.end:
+			return r.delay
+		case r.start > r.end && (m >= r.start || m < r.end):
+			return r.delay
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleDelay(t *testing.T) {
+	sched, err := parseSchedule("09:00-17:00=5s, 22:00-06:00=0s, 06:00-06:00=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		clock string
+		want  time.Duration
+	}{
+		{"09:00", 5 * time.Second},
+		{"16:59", 5 * time.Second},
+		{"17:00", time.Second},
+		{"21:59", time.Second},
+		{"22:00", 0},
+		{"00:30", 0},
+		{"05:59", 0},
+		{"06:00", time.Second},
+		{"08:59", time.Second},
+	} {
+		at, _ := time.Parse("15:04", c.clock)
+
+		if got := sched.delay(at); got != c.want {
+			t.Errorf("delay at %s is %v, want %v", c.clock, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"09:00-17:00", "9-17=1s", "09:00-25:00=1s", "09:00-17:00=soon"} {
+		if _, err := parseSchedule(bad); err == nil {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+}
+
+func TestScheduleClock(t *testing.T) {
+	const peak = 200 * time.Millisecond
+
+	var mu sync.Mutex
+	var hits []time.Time
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, time.Now())
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/1.html">1</a> <a href="/2.html">2</a> <a href="/3.html">3</a>`))
+		}
+	}))
+	defer s.Close()
+
+	defer func(n func() time.Time) { now = n }(now)
+
+	for _, c := range []struct {
+		clock  string
+		spaced bool
+	}{
+		{"12:00", true},
+		{"03:00", false},
+	} {
+		t.Run(c.clock, func(t *testing.T) {
+			at, _ := time.Parse("15:04", c.clock)
+			now = func() time.Time { return time.Date(2024, 1, 2, at.Hour(), at.Minute(), 0, 0, time.Local) }
+
+			mu.Lock()
+			hits = nil
+			mu.Unlock()
+
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.Schedule = "09:00-17:00=" + peak.String() + ",17:00-09:00=0s"
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(hits) != 4 {
+				t.Fatalf("made %d requests, want 4", len(hits))
+			}
+
+			for k := 1; k < len(hits); k++ {
+				gap := hits[k].Sub(hits[k-1])
+
+				if c.spaced && gap < peak-20*time.Millisecond {
+					t.Errorf("requests %v apart at %s, want the peak delay of %v", gap, c.clock, peak)
+				}
+
+				if !c.spaced && gap >= peak {
+					t.Errorf("requests %v apart at %s, want no delay off-peak", gap, c.clock)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is how many consecutive words make up each feature hashed into
+// a page's simhash; single words make unrelated pages look too similar.
+const shingleSize = 3
+
+// simhash returns a 64-bit fingerprint of text where similar texts get
+// fingerprints that differ in few bits. Text is lowercased and split on
+// anything that isn't a letter or digit so markup whitespace doesn't matter.
+func simhash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if len(words) < shingleSize {
+		words = append(words, make([]string, shingleSize-len(words))...)
+	}
+
+	var weights [64]int
+
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+
+		for b := range weights {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+
+	for b, w := range weights {
+		if w > 0 {
+			fingerprint |= 1 << b
+		}
+	}
+
+	return fingerprint
+}
+
+// hammingDistance is the number of bits that differ between two simhashes.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// fingerprint is the simhash of a page that was kept.
+type fingerprint struct {
+	url  string
+	hash uint64
+}
+
+// nearDuplicate returns the URL of the first page in pages whose simhash is
+// within threshold bits of hash, or "" if there isn't one.
+func nearDuplicate(pages []fingerprint, hash uint64, threshold int) string {
+	for _, p := range pages {
+		if hammingDistance(p.hash, hash) <= threshold {
+			return p.url
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// article is a page of boilerplate-heavy text with a timestamp in it.
+func article(topic string, stamp string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<html><body><h1>All about %s</h1><p>Last updated %s</p>", topic, stamp)
+
+	for i := range 20 {
+		fmt.Fprintf(&b, "<p>Paragraph %d of what there is to say about %s, and why %s matters so much to everyone.</p>", i, topic, topic)
+	}
+
+	b.WriteString(`<a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a></body></html>`)
+
+	return b.String()
+}
+
+func TestSimhash(t *testing.T) {
+	a := simhash(article("gardening", "2024-01-02 03:04:05"))
+
+	for _, c := range []struct {
+		name string
+		text string
+		near bool
+	}{
+		{"timestamp", article("gardening", "2025-06-07 08:09:10"), true},
+		{"markup", strings.ReplaceAll(article("gardening", "2024-01-02 03:04:05"), "<p>", "<p>\n  "), true},
+		{"different", article("astronomy", "2024-01-02 03:04:05"), false},
+		{"unrelated", "<p>Nothing in common here at all.</p>", false},
+	} {
+		if d := hammingDistance(a, simhash(c.text)); (d <= 3) != c.near {
+			t.Errorf("%s: %d bits apart, want near %v", c.name, d, c.near)
+		}
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a>`,
+		"/a": article("gardening", "2024-01-02 03:04:05"),
+		"/b": article("gardening", "2025-06-07 08:09:10"),
+		"/c": article("astronomy", "2024-01-02 03:04:05"),
+	})
+
+	for _, skip := range []bool{false, true} {
+		t.Run(fmt.Sprintf("skip=%v", skip), func(t *testing.T) {
+			var log bytes.Buffer
+
+			o := testOptions(t, s.URL+"/")
+			o.NoRobots = true
+			o.NearDupThreshold = 3
+			o.SkipNearDups = skip
+			o.Logger = slog.New(slog.NewTextHandler(&log, nil))
+
+			res, err := New(o).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := fmt.Sprintf("%s/b (near duplicate of %s/a)", s.URL, s.URL)
+			if !strings.Contains(log.String(), want) {
+				t.Errorf("%q not reported in:\n%s", want, log.String())
+			}
+
+			if n := strings.Count(log.String(), "near duplicate of"); n != 1 {
+				t.Errorf("%d near duplicates reported, want only /b", n)
+			}
+
+			// only reported unless asked to skip them
+			_, err = os.Stat(mirrored(t, o, s.URL+"/b"))
+			if kept := err == nil; kept == skip {
+				t.Errorf("/b kept %v, want %v", kept, !skip)
+			}
+
+			if skip && res.Skipped["near duplicate"] != 1 {
+				t.Errorf("skipped %v, want /b as a near duplicate", res.Skipped)
+			}
+
+			for _, p := range []string{"/a", "/c"} {
+				if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+					t.Errorf("%s not kept: %v", p, err)
+				}
+			}
+		})
+	}
+}
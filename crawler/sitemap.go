@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxSitemaps bounds how many sitemaps are fetched by following sitemap
+// indexes, which can point at each other.
+const maxSitemaps = 100
+
+// robotsSitemaps returns the URLs of the Sitemap: lines in a robots.txt.
+// These apply to the whole file regardless of the user-agent groups.
+func robotsSitemaps(r io.Reader) []string {
+	var sitemaps []string
+
+	s := bufio.NewScanner(r)
+
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+
+		if ok && strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			if value = strings.TrimSpace(value); value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	return sitemaps
+}
+
+// sitemap is either a <urlset> of pages or a <sitemapindex> of further
+// sitemaps, both of which list their URLs in <loc> elements.
+type sitemap struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// parseSitemap reads a sitemap, gunzipping it first if it's compressed.
+func parseSitemap(r io.Reader) (*sitemap, error) {
+	br := bufio.NewReader(r)
+
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		defer zr.Close()
+
+		r = zr
+	} else {
+		r = br
+	}
+
+	var sm sitemap
+
+	if err := xml.NewDecoder(r).Decode(&sm); err != nil {
+		return nil, err
+	}
+
+	for i := range sm.URLs {
+		sm.URLs[i] = strings.TrimSpace(sm.URLs[i])
+	}
+
+	for i := range sm.Sitemaps {
+		sm.Sitemaps[i] = strings.TrimSpace(sm.Sitemaps[i])
+	}
+
+	return &sm, nil
+}
+
+// fetchSitemaps downloads the given sitemaps, following sitemap indexes,
+// and returns the page URLs they list in order, without duplicates.
+// Sitemaps that can't be fetched or parsed are warned about and skipped.
+func (r *run) fetchSitemaps(urls []string) []string {
+	var pages []string
+	seen := map[string]bool{}
+	fetched := map[string]bool{}
+
+	for len(urls) > 0 && len(fetched) < maxSitemaps {
+		u := urls[0]
+		urls = urls[1:]
+
+		if fetched[u] {
+			continue
+		}
+
+		fetched[u] = true
+
+		sm, err := r.getSitemap(u)
+		if err != nil {
+			r.log.Warn("could not read sitemap", "url", u, "err", err)
+			continue
+		}
+
+		urls = append(urls, sm.Sitemaps...)
+
+		for _, p := range sm.URLs {
+			if p != "" && !seen[p] {
+				seen[p] = true
+				pages = append(pages, p)
+			}
+		}
+	}
+
+	return pages
+}
+
+func (r *run) getSitemap(u string) (*sitemap, error) {
+	resp, err := r.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %s", resp.Status)
+	}
+
+	return parseSitemap(resp.Body)
+}
+
+// robotsSitemapHints fetches robots.txt from the root of the site at
+// scheme://host and returns the sitemaps it declares.
+func (r *run) robotsSitemapHints(scheme string, host string) ([]string, error) {
+	resp, err := r.client.Get(scheme + "://" + host + "/robots.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	return robotsSitemaps(io.LimitReader(resp.Body, 1<<20)), nil
+}
@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRobotsSitemaps(t *testing.T) {
+	robots := `# sitemaps aren't part of any group
+Sitemap: https://example.org/sitemap-pages.xml
+User-agent: *
+Disallow: /private/
+sitemap:https://example.org/sitemap-news.xml.gz # the news
+SITEMAP :   https://cdn.example.org/sitemap-index.xml
+Sitemap:
+# Sitemap: https://example.org/commented-out.xml
+`
+
+	want := []string{
+		"https://example.org/sitemap-pages.xml",
+		"https://example.org/sitemap-news.xml.gz",
+		"https://cdn.example.org/sitemap-index.xml",
+	}
+
+	if got := robotsSitemaps(strings.NewReader(robots)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// urlset is a sitemap listing urls.
+func urlset(urls ...string) string {
+	var b strings.Builder
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+
+	for _, u := range urls {
+		fmt.Fprintf(&b, "<url><loc>\n  %s\n</loc></url>", u)
+	}
+
+	b.WriteString("</urlset>")
+
+	return b.String()
+}
+
+func TestSitemapHints(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow:\n\nSitemap: %[1]s/pages.xml\nSitemap: %[1]s/news.xml.gz\nSitemap: %[1]s/index.xml\nSitemap: %[1]s/pages.xml\n", s.URL)
+		case "/pages.xml":
+			fmt.Fprint(w, urlset(s.URL+"/", s.URL+"/a.html", s.URL+"/b.html"))
+		case "/news.xml.gz":
+			var b bytes.Buffer
+			zw := gzip.NewWriter(&b)
+			fmt.Fprint(zw, urlset(s.URL+"/b.html", s.URL+"/news.html", "https://elsewhere.example/c.html"))
+			zw.Close()
+			w.Write(b.Bytes())
+		case "/index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%[1]s/more.xml</loc></sitemap><sitemap><loc>%[1]s/pages.xml</loc></sitemap></sitemapindex>`, s.URL)
+		case "/more.xml":
+			fmt.Fprint(w, urlset(s.URL+"/more.html"))
+		case "/", "/a.html", "/b.html", "/news.html", "/more.html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "nothing linked")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+	o.UseSitemapHints = true
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// every sitemap and page once, however often they're listed
+	for _, p := range []string{"/pages.xml", "/news.xml.gz", "/index.xml", "/more.xml", "/", "/a.html", "/b.html", "/news.html", "/more.html"} {
+		if requests[p] != 1 {
+			t.Errorf("%s requested %d times, want once", p, requests[p])
+		}
+	}
+
+	if res.Fetched != 5 {
+		t.Errorf("fetched %d, want the 5 pages of the site", res.Fetched)
+	}
+}
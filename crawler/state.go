@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// crawlState is what a -time-box crawl checkpoints to its -state-file so the
+// next run can carry on where it stopped.
+type crawlState struct {
+	Frontier []frontierEntry `json:"frontier"`
+	Seen     []string        `json:"seen"`
+}
+
+// loadState reads a checkpoint, returning nil if there isn't one.
+func loadState(file string) (*crawlState, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var s crawlState
+
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// saveState writes a checkpoint, replacing any previous one whole.
+func saveState(file string, s *crawlState) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+
+	if err = os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
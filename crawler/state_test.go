@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chainSite serves pages /0.html to /n-1.html, each linking to the next and
+// taking delay to send, counting the GETs of every page in hits.
+func chainSite(t *testing.T, n int, delay time.Duration, hits map[string]int, mu *sync.Mutex) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var i int
+		if _, err := fmt.Sscanf(r.URL.Path, "/%d.html", &i); err != nil || i >= n {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.Method == "GET" {
+			mu.Lock()
+			hits[r.URL.Path]++
+			mu.Unlock()
+
+			// the headers go first, the body only after the delay
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		fmt.Fprintf(w, `<a href="/%d.html">next</a>`, i+1)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestTimeBoxResume(t *testing.T) {
+	const pages = 6
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	s := chainSite(t, pages, 20*time.Millisecond, hits, &mu)
+
+	o := testOptions(t, s.URL+"/0.html")
+	o.TimeBox = 30 * time.Millisecond
+	o.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched == 0 || res.Fetched == pages || res.Queued != 1 {
+		t.Fatalf("fetched %d with %d queued, want the time box to end the crawl partway", res.Fetched, res.Queued)
+	}
+
+	if _, err := os.Stat(o.StateFile); err != nil {
+		t.Fatalf("no state saved: %v", err)
+	}
+
+	// every run carries on where the last one left off
+	runs := 1
+	for ; runs < 2*pages; runs++ {
+		if res, err = New(o).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Queued == 0 {
+			break
+		}
+	}
+
+	if res.Queued != 0 {
+		t.Fatalf("still %d queued after %d runs", res.Queued, runs)
+	}
+
+	if _, err := os.Stat(o.StateFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state file left once the crawl finished: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := 0; i < pages; i++ {
+		p := fmt.Sprintf("/%d.html", i)
+
+		if _, err := os.Stat(mirrored(t, o, s.URL+p)); err != nil {
+			t.Error(err)
+		}
+
+		if hits[p] != 1 {
+			t.Errorf("%s downloaded %d times, want once", p, hits[p])
+		}
+	}
+}
+
+func TestInterruptResume(t *testing.T) {
+	const pages = 4
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	s := chainSite(t, pages, 50*time.Millisecond, hits, &mu)
+
+	o := testOptions(t, s.URL+"/0.html")
+	o.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	// interrupted while the second page is downloading
+	ctx, cancel := context.WithCancelCause(context.Background())
+	interrupted := errors.New("interrupted")
+
+	o.Decide = func(url string, header http.Header) bool {
+		if url == s.URL+"/1.html" {
+			cancel(interrupted)
+		}
+
+		return true
+	}
+
+	res, err := New(o).Run(ctx)
+	if !errors.Is(err, interrupted) {
+		t.Fatalf("got %v, want the cause of the interruption", err)
+	}
+
+	// the download cut short is queued again, not left half done
+	if res.Fetched != 1 || res.Queued != 1 {
+		t.Errorf("fetched %d with %d queued, want 1 and 1", res.Fetched, res.Queued)
+	}
+
+	state, err := loadState(o.StateFile)
+	if err != nil || state == nil {
+		t.Fatalf("no state saved: %v", err)
+	}
+
+	if len(state.Frontier) != 1 || state.Frontier[0].URL != s.URL+"/1.html" {
+		t.Errorf("saved frontier %+v, want the page being downloaded", state.Frontier)
+	}
+
+	o.Decide = nil
+
+	if res, err = New(o).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Fetched != pages-1 || res.Queued != 0 {
+		t.Errorf("resumed crawl fetched %d with %d queued, want the other %d", res.Fetched, res.Queued, pages-1)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if hits["/0.html"] != 1 || hits["/1.html"] != 2 {
+		t.Errorf("downloads %v, want the start page once and the one cut short twice", hits)
+	}
+}
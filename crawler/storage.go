@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage is where the files of a mirror are kept, by their slash separated
+// path in it, e.g. "https:example.org/index.html". Downloads are still made
+// into the mirror directory, as resuming and parsing them needs them on
+// disk, and put into the storage once complete.
+type Storage interface {
+	// Put stores the size bytes read from r as name, last modified at
+	// modTime, replacing any file already stored as name.
+	Put(name string, r io.Reader, size int64, modTime time.Time) error
+
+	// Stat returns the size and modification time of name, or an error
+	// wrapping fs.ErrNotExist if there's no such file.
+	Stat(name string) (fs.FileInfo, error)
+
+	// Open opens name for reading.
+	Open(name string) (io.ReadCloser, error)
+}
+
+// OpenStorage returns the storage -output names: an S3 bucket as
+// s3://bucket/prefix, a GCS bucket as gs://bucket/prefix, or otherwise a
+// directory.
+func OpenStorage(output string) (Storage, error) {
+	return openStorage(output, http.DefaultTransport)
+}
+
+// openStorage is OpenStorage with buckets reached through transport, like
+// the crawl's with its proxy, TLS settings and timeouts.
+func openStorage(output string, transport http.RoundTripper) (Storage, error) {
+	switch {
+	case strings.HasPrefix(output, "s3://"):
+		return newS3Storage(strings.TrimPrefix(output, "s3://"), transport)
+	case strings.HasPrefix(output, "gs://"):
+		return newGCSStorage(strings.TrimPrefix(output, "gs://"), transport)
+	case strings.Contains(output, "://"):
+		return nil, fmt.Errorf("expected s3://bucket/prefix, gs://bucket/prefix or a directory")
+	}
+
+	return dirStorage(output), nil
+}
+
+// dirStorage keeps files in a directory, like the mirror directory itself.
+type dirStorage string
+
+func (d dirStorage) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// Put writes a temporary file that is renamed into place once complete.
+func (d dirStorage) Put(name string, r io.Reader, size int64, modTime time.Time) error {
+	path := d.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".mrdriller-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chtimes(f.Name(), modTime, modTime); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (d dirStorage) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.path(name))
+}
+
+func (d dirStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(d.path(name))
+}
+
+// moveToStorage moves the file at path into s as name, removing the
+// directories it leaves empty up to root, and returns its SHA-256.
+func moveToStorage(s Storage, path, name, root string) ([]byte, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+
+	if err = s.Put(filepath.ToSlash(name), io.TeeReader(in, h), info.Size(), info.ModTime()); err != nil {
+		return nil, err
+	}
+
+	in.Close()
+
+	if err = removeMoved(path, root); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// removeMoved removes the file at path once it has been moved elsewhere, and
+// the directories that leaves empty up to root.
+func removeMoved(path, root string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	// fails, as it should, at the first directory that isn't empty
+	for d := filepath.Dir(path); d != root && os.Remove(d) == nil; d = filepath.Dir(d) {
+	}
+
+	return nil
+}
+
+// hashStored returns the SHA-256 of the file stored as name in s.
+func hashStored(s Storage, name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
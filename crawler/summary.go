@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// crawlSummary totals up a crawl, for the summary logged when it ends, the
+// Result of Run, -summary-file and -notify-url. It's locked, as -notify-url may need it
+// when the crawl is interrupted halfway through a download.
+type crawlSummary struct {
+	mu     sync.Mutex
+	failed []string
+
+	Fetched        int            `json:"fetched"`
+	Bytes          int64          `json:"bytes"`
+	Failures       map[string]int `json:"failures,omitempty"`
+	Skipped        map[string]int `json:"skipped,omitempty"`
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	BytesPerSecond int64          `json:"bytes_per_second"`
+}
+
+// fetched counts a download of size bytes.
+func (s *crawlSummary) fetched(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Fetched++
+	s.Bytes += size
+}
+
+// fail counts a download of url that failed, by its status code if it got
+// one.
+func (s *crawlSummary) fail(url string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = append(s.failed, url)
+
+	if s.Failures == nil {
+		s.Failures = map[string]int{}
+	}
+
+	key := "error"
+	if se := (*statusError)(nil); errors.As(err, &se) {
+		key = strconv.Itoa(se.code)
+	}
+
+	s.Failures[key]++
+}
+
+// skip counts a URL not downloaded for reason, e.g. "robots.txt".
+func (s *crawlSummary) skip(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Skipped == nil {
+		s.Skipped = map[string]int{}
+	}
+
+	s.Skipped[reason]++
+}
+
+// skipReason is the reason a download returning err counts as skipped for.
+func skipReason(err error) string {
+	switch {
+	case errors.Is(err, ErrChallenge):
+		return "challenge"
+	case errors.Is(err, ErrSkippedStatus):
+		return "on-status"
+	case errors.Is(err, ErrNotFollowed):
+		return "redirect"
+	}
+
+	return "declined"
+}
+
+// finish records how long the crawl took and so how fast it downloaded.
+func (s *crawlSummary) finish(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ElapsedSeconds = elapsed.Seconds()
+
+	if elapsed > 0 {
+		s.BytesPerSecond = int64(float64(s.Bytes) / elapsed.Seconds())
+	}
+}
+
+// reset starts the summary over, as -plan-first does once planned.
+func (s *crawlSummary) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed, s.Fetched, s.Bytes, s.Failures, s.Skipped = nil, 0, 0, nil, nil
+}
+
+// failedURLs are the URLs whose downloads failed, in the order they did.
+func (s *crawlSummary) failedURLs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.failed...)
+}
+
+// log logs the summary to logger as one line, with the failures and skipped
+// URLs as groups by status code and reason.
+func (s *crawlSummary) log(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := []any{
+		"fetched", s.Fetched,
+		"bytes", s.Bytes,
+		"elapsed", time.Duration(s.ElapsedSeconds * float64(time.Second)).Round(time.Millisecond),
+		"throughput", formatSize(s.BytesPerSecond) + "/s",
+	}
+
+	for _, g := range []struct {
+		name   string
+		counts map[string]int
+	}{{"failed", s.Failures}, {"skipped", s.Skipped}} {
+		if len(g.counts) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(g.counts))
+		for k := range g.counts {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		var group []any
+		for _, k := range keys {
+			group = append(group, slog.Int(k, g.counts[k]))
+		}
+
+		attrs = append(attrs, slog.Group(g.name, group...))
+	}
+
+	logger.Info("Summary", attrs...)
+}
+
+// result is the summary as what Run returns, with queued URLs left over.
+func (s *crawlSummary) result(queued int) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &Result{
+		Fetched:    s.Fetched,
+		Bytes:      s.Bytes,
+		Failures:   s.Failures,
+		Skipped:    s.Skipped,
+		FailedURLs: append([]string(nil), s.failed...),
+		Queued:     queued,
+		Elapsed:    time.Duration(s.ElapsedSeconds * float64(time.Second)),
+	}
+}
+
+// marshal is the summary as JSON.
+func (s *crawlSummary) marshal() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// write writes the summary to file as JSON.
+func (s *crawlSummary) write(file string) error {
+	b, err := s.marshal()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, append(b, '\n'), 0644)
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// newTLSConfig builds the TLS settings for -insecure, -cacert, -cert with
+// -key and -pin-sha256, or returns nil when none are given so Go's defaults
+// apply.
+func newTLSConfig(insecure bool, caFile string, certFile string, keyFile string, pins []string) (*tls.Config, error) {
+	if !insecure && caFile == "" && certFile == "" && keyFile == "" && len(pins) == 0 {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: insecure}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// trusted on top of the system's CAs, so public sites linked
+		// from an internal one still verify
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", caFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("-cert and -key must be given together")
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(pins) > 0 {
+		pinned := map[string]bool{}
+
+		for _, p := range pins {
+			// as curl writes them, sha256//<base64>
+			p = strings.TrimPrefix(p, "sha256//")
+
+			if sum, err := base64.StdEncoding.DecodeString(p); err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("pin `%s` is not a base64 SHA-256 hash", p)
+			}
+
+			pinned[p] = true
+		}
+
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPin(cs, pinned)
+		}
+	}
+
+	return config, nil
+}
+
+// checkPin fails a connection whose leaf certificate's public key isn't one
+// of the pinned ones, which is what an intercepting proxy's would look like
+// even if its CA is trusted.
+func checkPin(cs tls.ConnectionState, pinned map[string]bool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no certificate to check against -pin-sha256")
+	}
+
+	sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	if !pinned[pin] {
+		return fmt.Errorf("certificate of %s has public key sha256//%s, which isn't pinned", cs.ServerName, pin)
+	}
+
+	return nil
+}
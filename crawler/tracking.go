@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that only identify where a visitor
+// came from, never what page they get. A trailing * matches any suffix.
+var trackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"twclid",
+	"ttclid",
+	"igshid",
+	"li_fat_id",
+	"mc_cid",
+	"mc_eid",
+	"mkt_tok",
+	"_hsenc",
+	"_hsmi",
+	"_ga",
+	"_gl",
+}
+
+// isTrackingParam reports whether the query parameter key matches one of
+// params.
+func isTrackingParam(params []string, key string) bool {
+	key = strings.ToLower(key)
+
+	for _, p := range params {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripParams removes the query parameters matching params from u, leaving
+// the others as they were written and in the same order.
+func stripParams(u *url.URL, params []string) {
+	if u.RawQuery == "" || len(params) == 0 {
+		return
+	}
+
+	var kept []string
+
+	for _, kv := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(kv, "=")
+
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+
+		if !isTrackingParam(params, key) {
+			kept = append(kept, kv)
+		}
+	}
+
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+}
@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStripParams(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+		params   []string
+	}{
+		{"/a?utm_source=x&utm_medium=y", "/a", trackingParams},
+		{"/a?id=1&fbclid=abc&page=2", "/a?id=1&page=2", trackingParams},
+		{"/a?UTM_Campaign=x&id=1", "/a?id=1", trackingParams},
+		{"/a?utm%5Fsource=x&id=1", "/a?id=1", trackingParams},
+		{"/a?gclid=1&gclid=2", "/a", trackingParams},
+
+		// the rest is left as written, in the same order
+		{"/a?b=2&a=1&b=3&utm_id=4", "/a?b=2&a=1&b=3", trackingParams},
+		{"/a?q=a%20b&_ga=1", "/a?q=a%20b", trackingParams},
+
+		// not quite a tracking parameter
+		{"/a?utm=1&xfbclid=2", "/a?utm=1&xfbclid=2", trackingParams},
+
+		// added to with StripParams
+		{"/a?sessionid=1&ref_x=2&id=3", "/a?id=3", []string{"sessionid", "ref_*"}},
+		{"/a?utm_source=x", "/a?utm_source=x", nil},
+	} {
+		u, _ := url.Parse(c.in)
+		stripParams(u, c.params)
+
+		if got := u.String(); got != c.want {
+			t.Errorf("stripParams(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestTrackingVariantsCrawledOnce(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			mu.Lock()
+			got = append(got, r.URL.RequestURI())
+			mu.Unlock()
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.URL.Path == "/" {
+			w.Write([]byte(`
+<a href="/page?utm_source=newsletter&utm_medium=email">1</a>
+<a href="/page?fbclid=IwAR0abc">2</a>
+<a href="/page?gclid=xyz&utm_campaign=spring">3</a>
+<a href="/page">4</a>
+<a href="/item?id=7&utm_source=feed">5</a>
+<a href="/item?id=7&mc_eid=1">6</a>
+<a href="/item?id=8">7</a>
+<a href="/other?ref=home">8</a>
+<a href="/other?ref=nav">9</a>`))
+		}
+	}))
+	defer s.Close()
+
+	for _, c := range []struct {
+		name        string
+		keep        bool
+		stripParams []string
+		want        []string
+	}{
+		{"default", false, nil, []string{"/", "/item?id=7", "/item?id=8", "/other?ref=home", "/other?ref=nav", "/page"}},
+		{"strip-params", false, []string{"ref"}, []string{"/", "/item?id=7", "/item?id=8", "/other", "/page"}},
+		{"keep-tracking-params", true, nil, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got = nil
+
+			// the start URL is stripped too
+			o := testOptions(t, s.URL+"/?utm_source=bookmark")
+			o.NoRobots = true
+			o.KeepTrackingParams = c.keep
+			o.StripParams = c.stripParams
+
+			if _, err := New(o).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(got)
+
+			if c.keep {
+				// every variant is a page of its own
+				if len(got) != 10 {
+					t.Errorf("crawled %v, want every variant", got)
+				}
+
+				return
+			}
+
+			if strings.Join(got, " ") != strings.Join(c.want, " ") {
+				t.Errorf("crawled %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// newTransport is net/http's default transport with the -connect-timeout and
+// -read-timeout applied to its connections, going through proxy unless it's
+// nil, in which case HTTP_PROXY and friends are still honoured.
+func newTransport(connectTimeout, readTimeout time.Duration, proxy *url.URL) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != nil {
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || readTimeout <= 0 {
+			return conn, err
+		}
+
+		return &deadlineConn{conn, readTimeout}, nil
+	}
+
+	if connectTimeout > 0 {
+		t.TLSHandshakeTimeout = connectTimeout
+	}
+
+	return t
+}
+
+// deadlineConn fails a read once the server has sent nothing for timeout,
+// whether it's slow to answer or goes quiet halfway through a body.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(p)
+}
+
+// headerTransport adds the -user-agent and -header headers to every request
+// made through it, except for those the request already sets itself, like
+// Range when resuming.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	for k, v := range t.header {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = v
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxSegmentRepeats is how many times in a row a run of path segments may
+// appear before the URL is considered a trap, e.g. /a/b/a/b/a/b/.
+const maxSegmentRepeats = 3
+
+func pathSegments(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+// trapReason says why a URL path looks like part of an infinite URL space,
+// or returns "" if it doesn't. Paths deeper than maxDepth segments are traps
+// unless maxDepth is 0.
+func trapReason(p string, maxDepth uint) string {
+	segments := pathSegments(p)
+
+	if maxDepth > 0 && uint(len(segments)) > maxDepth {
+		return fmt.Sprintf("path is %d segments deep", len(segments))
+	}
+
+	for n := 1; n*maxSegmentRepeats <= len(segments); n++ {
+		for start := 0; start+n*maxSegmentRepeats <= len(segments); start++ {
+			run := segments[start : start+n]
+			repeats := 1
+
+			for next := start + n; next+n <= len(segments) && equalSegments(run, segments[next:next+n]); next += n {
+				repeats++
+			}
+
+			if repeats >= maxSegmentRepeats {
+				return fmt.Sprintf("%q repeats %d times", strings.Join(run, "/"), repeats)
+			}
+		}
+	}
+
+	return ""
+}
+
+// growsByRepeating reports whether child is parent with some of parent's own
+// trailing segments appended again, the telltale of a relative link that
+// resolves one level deeper on every page, e.g. /a/b/ linking to b/.
+func growsByRepeating(parent string, child string) bool {
+	ps := pathSegments(parent)
+	cs := pathSegments(child)
+
+	if len(cs) <= len(ps) || !equalSegments(ps, cs[:len(ps)]) {
+		return false
+	}
+
+	added := cs[len(ps):]
+
+	return len(added) <= len(ps) && equalSegments(added, ps[len(ps)-len(added):])
+}
+
+func equalSegments(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// idSegment matches path segments and query values that look like
+// identifiers: numbers, UUIDs and hex strings such as hashes.
+var idSegment = regexp.MustCompile(`(?i)^(?:\d+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|[0-9a-f]+)$`)
+
+// isID reports whether s looks like an identifier. Hex strings need at
+// least 8 characters including a digit, so words like "cafe" or "b2b"
+// aren't taken for identifiers.
+func isID(s string) bool {
+	if !idSegment.MatchString(s) {
+		return false
+	}
+
+	return strings.Trim(s, "0123456789") == "" || strings.Contains(s, "-") || (len(s) >= 8 && strings.ContainsAny(s, "0123456789"))
+}
+
+// urlTemplate returns u with everything that looks like an identifier
+// replaced by a placeholder, so /product/1 and /product/2?page=3 become
+// /product/{id} and /product/{id}?page={id}.
+func urlTemplate(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, s := range segments {
+		if s != "" && isID(s) {
+			segments[i] = "{id}"
+		}
+	}
+
+	t := u.Scheme + "://" + strings.ToLower(u.Host) + strings.Join(segments, "/")
+
+	if u.RawQuery == "" {
+		return t
+	}
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+
+	for k := range query {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		v := query.Get(k)
+		if isID(v) {
+			v = "{id}"
+		}
+
+		keys[i] = k + "=" + v
+	}
+
+	return t + "?" + strings.Join(keys, "&")
+}
@@ -0,0 +1,179 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrapReason(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		maxDepth uint
+		trap     bool
+	}{
+		{"/a/b/a/b/a/b", 0, true},
+		{"/a/b/a/b/a/b/", 0, true},
+		{"/x/a/a/a/y", 0, true},
+		{"/cal/2024/01/01/01/01", 0, true},
+		{"/a/b/c/d/e/f/g/h", 5, true},
+		{"/a/b/c/d/e", 5, false},
+
+		{"/", 0, false},
+		{"/a/b/a/b", 0, false},
+		{"/a/a/b/a", 0, false},
+		{"/cal/2024/01/02", 0, false},
+		{"/a/b/c/d/e/f/g/h", 0, false},
+		{"/docs/docs/guide/docs", 0, false},
+	} {
+		if got := trapReason(c.path, c.maxDepth) != ""; got != c.trap {
+			t.Errorf("trapReason(%s, %d) says trap %v, want %v", c.path, c.maxDepth, got, c.trap)
+		}
+	}
+}
+
+func TestGrowsByRepeating(t *testing.T) {
+	for _, c := range []struct {
+		parent, child string
+		want          bool
+	}{
+		// /a/b/ linking to b/
+		{"/a/b/", "/a/b/b/", true},
+		{"/a/b/", "/a/b/a/b/", true},
+		{"/docs/api/", "/docs/api/api/", true},
+
+		{"/a/b/", "/a/b/c/", false},
+		{"/a/b/", "/a/c/", false},
+		{"/a/b/", "/a/", false},
+		{"/a/b/", "/a/b/", false},
+		{"/a/", "/a/a/a/", false},
+		{"/", "/a/", false},
+	} {
+		if got := growsByRepeating(c.parent, c.child); got != c.want {
+			t.Errorf("growsByRepeating(%s, %s) = %v, want %v", c.parent, c.child, got, c.want)
+		}
+	}
+}
+
+func TestTrapsSkipped(t *testing.T) {
+	// every page links one level deeper, like a calendar's next month
+	// does forever, and into a loop of segments
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<a href="b/">deeper</a> <a href="/x/y/x/y/x/y/">loop</a> <a href="/c/d/e/f/">deep</a> <a href="/ok/">ok</a>`)
+	}))
+	defer s.Close()
+
+	var log bytes.Buffer
+
+	o := testOptions(t, s.URL+"/a/b/")
+	o.NoRobots = true
+	o.MaxPathDepth = 3
+	o.Logger = slog.New(slog.NewTextHandler(&log, nil))
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the start page, /ok/ and /ok/b/, whose b/ is where it stops
+	if res.Fetched != 3 {
+		t.Errorf("fetched %d, want 3", res.Fetched)
+	}
+
+	for _, trap := range []string{"/a/b/b/", "/ok/b/b/", "/x/y/x/y/x/y/", "/c/d/e/f/"} {
+		if !strings.Contains(log.String(), s.URL+trap) {
+			t.Errorf("%s not reported as a trap in\n%s", trap, log.String())
+		}
+	}
+}
+
+func TestIsID(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want bool
+	}{
+		{"1", true},
+		{"20240102", true},
+		{"123e4567-e89b-12d3-a456-426614174000", true},
+		{"123E4567-E89B-12D3-A456-426614174000", true},
+		{"d41d8cd98f00b204e9800998ecf8427e", true},
+		{"ab12cdef", true},
+		{"a1b2c3d4", true},
+
+		{"cafe", false},
+		{"b2b", false},
+		{"deadbeef", false},
+		{"facade", false},
+		{"1a2b", false},
+		{"product", false},
+		{"v2", false},
+		{"page-2", false},
+		{"", false},
+	} {
+		if got := isID(c.s); got != c.want {
+			t.Errorf("isID(%q) = %v, want %v", c.s, got, c.want)
+		}
+	}
+}
+
+func TestURLTemplate(t *testing.T) {
+	for _, c := range []struct {
+		url, want string
+	}{
+		{"https://example.org/product/1", "https://example.org/product/{id}"},
+		{"https://Example.org/product/2?page=3", "https://example.org/product/{id}?page={id}"},
+		{"https://example.org/product/2?sort=price&page=3", "https://example.org/product/{id}?page={id}&sort=price"},
+		{"https://example.org/u/123e4567-e89b-12d3-a456-426614174000/", "https://example.org/u/{id}/"},
+		{"https://example.org/blob/d41d8cd98f00b204e9800998ecf8427e", "https://example.org/blob/{id}"},
+		{"https://example.org/menu/cafe/2", "https://example.org/menu/cafe/{id}"},
+		{"https://example.org/about", "https://example.org/about"},
+	} {
+		if got := urlTemplate(mustParse(t, c.url)); got != c.want {
+			t.Errorf("urlTemplate(%s) = %s, want %s", c.url, got, c.want)
+		}
+	}
+
+	// the two differ in what's not an identifier
+	if urlTemplate(mustParse(t, "https://example.org/product/1")) == urlTemplate(mustParse(t, "https://example.org/product/2?page=3")) {
+		t.Error("/product/1 and /product/2?page=3 have the same template")
+	}
+}
+
+func TestTemplateSample(t *testing.T) {
+	var links strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&links, `<a href="/product/%d">p</a> `, i)
+	}
+
+	links.WriteString(`<a href="/about">about</a>`)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		if r.URL.Path == "/" {
+			io.WriteString(w, links.String())
+		}
+	}))
+	defer s.Close()
+
+	o := testOptions(t, s.URL+"/")
+	o.NoRobots = true
+	o.TemplateSample = 3
+
+	res, err := New(o).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the start page, three products and /about
+	if res.Fetched != 5 {
+		t.Errorf("fetched %d, want 5", res.Fetched)
+	}
+}
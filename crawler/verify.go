@@ -0,0 +1,148 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// headerDigest returns the digest of the body for alg given by the
+// Content-Digest, Repr-Digest or Digest headers, or Content-MD5 for md5.
+func headerDigest(header http.Header, alg string) []byte {
+	name := map[string]string{"sha256": "sha-256", "md5": "md5"}[alg]
+
+	for _, h := range []string{"Content-Digest", "Repr-Digest", "Digest"} {
+		for _, v := range header.Values(h) {
+			for _, item := range strings.Split(v, ",") {
+				key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+				if !ok || !strings.EqualFold(key, name) {
+					continue
+				}
+
+				// RFC 9530 wraps the base64 in colons, RFC 3230 doesn't
+				if sum, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":")); err == nil {
+					return sum
+				}
+			}
+		}
+	}
+
+	if alg == "md5" {
+		if sum, err := base64.StdEncoding.DecodeString(header.Get("Content-MD5")); err == nil && len(sum) > 0 {
+			return sum
+		}
+	}
+
+	return nil
+}
+
+// checksumFiles caches the checksum files fetched for VerifySums by URL,
+// each as a map of file names to digests. Files that couldn't be fetched
+// are cached as nil so they're only tried once.
+type checksumFiles struct {
+	sync.Mutex
+	sums map[string]map[string][]byte
+}
+
+// sumsDigest looks up the digest of the file at u in the checksum file the
+// VerifySums pattern points at, where {} stands for the file's name, e.g.
+// "{}.sha256" or "SHA256SUMS", returning the checksum file's URL too.
+func (r *run) sumsDigest(u *url.URL) ([]byte, string) {
+	name := path.Base(u.Path)
+
+	ref, err := url.Parse(strings.ReplaceAll(r.o.VerifySums, "{}", url.PathEscape(name)))
+	if err != nil {
+		return nil, ""
+	}
+
+	sumsURL := u.ResolveReference(ref).String()
+
+	r.checksumFiles.Lock()
+	defer r.checksumFiles.Unlock()
+
+	sums, ok := r.checksumFiles.sums[sumsURL]
+	if !ok {
+		sums = r.getChecksumFile(sumsURL)
+		r.checksumFiles.sums[sumsURL] = sums
+	}
+
+	if sum, ok := sums[name]; ok {
+		return sum, sumsURL
+	}
+
+	// a file of just a hash is about the one file it's named after
+	return sums[""], sumsURL
+}
+
+// getChecksumFile fetches and parses a file in sha256sum/md5sum format, or
+// one holding a single hash.
+func (r *run) getChecksumFile(u string) map[string][]byte {
+	resp, err := r.client.Get(u)
+	if err != nil {
+		return nil
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	sums := map[string][]byte{}
+
+	s := bufio.NewScanner(resp.Body)
+
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil {
+			continue
+		}
+
+		name := ""
+		if len(fields) > 1 {
+			// a * marks files hashed in binary mode
+			name = path.Base(strings.TrimPrefix(fields[1], "*"))
+		}
+
+		sums[name] = sum
+	}
+
+	return sums
+}
+
+// verifyDigest compares the digest of a download of u against the one its
+// headers give for the Verify digest, unless fromHeaders is false because
+// net/http decompressed the body they describe, and otherwise the one in
+// its VerifySums file. Downloads nothing says the digest of pass.
+func (r *run) verifyDigest(u string, header http.Header, fromHeaders bool, got []byte) error {
+	var want []byte
+	var source string
+
+	if fromHeaders {
+		want, source = headerDigest(header, r.o.Verify), "the response headers"
+	}
+
+	if want == nil && r.o.VerifySums != "" {
+		if pu, err := url.Parse(u); err == nil {
+			want, source = r.sumsDigest(pu)
+		}
+	}
+
+	if want == nil || bytes.Equal(want, got) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: got %x, %s says %x", ErrChecksum, got, source, want)
+}
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// hostPacer spaces out the requests to each host by -wait, varied between
+// half and one and a half times that with -random-wait so the requests
+// don't come at a telltale fixed interval. It's safe for the workers to
+// share.
+type hostPacer struct {
+	wait   time.Duration
+	random bool
+
+	mu sync.Mutex
+
+	// next is when each host may be sent another request
+	next map[string]time.Time
+
+	// atLeast is a longer wait some hosts ask for, e.g. by a Crawl-delay
+	atLeast map[string]time.Duration
+}
+
+// slowDown makes the wait for host at least d.
+func (p *hostPacer) slowDown(host string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.atLeast == nil {
+		p.atLeast = map[string]time.Duration{}
+	}
+
+	p.atLeast[host] = d
+}
+
+// delay returns how long to hold off a request to host about to be made at
+// t, and books the host's following request a wait after it.
+func (p *hostPacer) delay(host string, t time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wait := max(p.wait, p.atLeast[host])
+	if wait <= 0 {
+		return 0
+	}
+
+	if p.next == nil {
+		p.next = map[string]time.Time{}
+	}
+
+	at := p.next[host]
+	if at.Before(t) {
+		at = t
+	}
+
+	gap := wait
+	if p.random {
+		gap = time.Duration((0.5 + rand.Float64()) * float64(wait))
+	}
+
+	p.next[host] = at.Add(gap)
+
+	return at.Sub(t)
+}
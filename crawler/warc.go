@@ -0,0 +1,238 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// warcWriter writes every download to a WARC 1.1 file for -warc-file, as a
+// request and a response record each compressed as a gzip member of its
+// own, so any record can be read by seeking to it. Alongside it goes a CDX
+// index of where the responses are, which is what tools like pywb replay
+// from, written sorted when the crawl is over.
+type warcWriter struct {
+	f      *os.File
+	offset int64
+	cdx    []string
+	cdxF   *os.File
+	name   string
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// createWARC creates prefix.warc.gz and prefix.cdx and starts the WARC
+// with a warcinfo record.
+func createWARC(prefix string) (*warcWriter, error) {
+	f, err := os.Create(prefix + ".warc.gz")
+	if err != nil {
+		return nil, err
+	}
+
+	cdxF, err := os.Create(prefix + ".cdx")
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w := &warcWriter{f: f, cdxF: cdxF, name: filepath.Base(f.Name())}
+
+	info := "software: mrdriller\r\nformat: WARC File Format 1.1\r\n"
+
+	err = w.record(http.Header{
+		"WARC-Type":     {"warcinfo"},
+		"WARC-Filename": {w.name},
+		"Content-Type":  {"application/warc-fields"},
+	}, strings.NewReader(info), int64(len(info)))
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// record writes one record of the given headers, to which the date, length
+// and an ID if there isn't one are added, and block. The headers are set
+// directly, as Set would change "WARC-Date" into "Warc-Date".
+func (w *warcWriter) record(header http.Header, block io.Reader, length int64) error {
+	if header["WARC-Record-ID"] == nil {
+		header["WARC-Record-ID"] = []string{newRecordID()}
+	}
+
+	header["WARC-Date"] = []string{time.Now().UTC().Format(time.RFC3339)}
+	header["Content-Length"] = []string{fmt.Sprint(length)}
+
+	zw := gzip.NewWriter(countingWriter{w.f, &w.offset})
+
+	fmt.Fprint(zw, "WARC/1.1\r\n")
+	header.Write(zw)
+	fmt.Fprint(zw, "\r\n")
+
+	if _, err := io.Copy(zw, block); err != nil {
+		return err
+	}
+
+	fmt.Fprint(zw, "\r\n\r\n")
+
+	return zw.Close()
+}
+
+// exchange writes the request that fetched res and its response, with the
+// body saved at path as the payload. Redirects on the way aren't recorded.
+// Unless -raw was used, the body is the one net/http decompressed, which
+// its headers describe as it took Content-Encoding out.
+func (w *warcWriter) exchange(res *result, path string) error {
+	req := res.request
+
+	var reqBlock bytes.Buffer
+
+	fmt.Fprintf(&reqBlock, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.URL.Host)
+	req.Header.Write(&reqBlock)
+	reqBlock.WriteString("\r\n")
+
+	var respHead bytes.Buffer
+
+	fmt.Fprintf(&respHead, "%s %d %s\r\n", res.proto, res.status, http.StatusText(res.status))
+	res.header.Write(&respHead)
+	respHead.WriteString("\r\n")
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	// the digests go before the block, so the payload is read twice
+	payloadSum, blockSum := sha1.New(), sha1.New()
+	blockSum.Write(respHead.Bytes())
+
+	size, err := io.Copy(io.MultiWriter(payloadSum, blockSum), f)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	target := req.URL.String()
+	responseID := newRecordID()
+	payloadDigest := "sha1:" + base32.StdEncoding.EncodeToString(payloadSum.Sum(nil))
+	start := w.offset
+
+	err = w.record(http.Header{
+		"WARC-Type":           {"response"},
+		"WARC-Target-URI":     {target},
+		"WARC-Payload-Digest": {payloadDigest},
+		"WARC-Block-Digest":   {"sha1:" + base32.StdEncoding.EncodeToString(blockSum.Sum(nil))},
+		"Content-Type":        {"application/http;msgtype=response"},
+		"WARC-Record-ID":      {responseID},
+	}, io.MultiReader(bytes.NewReader(respHead.Bytes()), f), int64(respHead.Len())+size)
+	if err != nil {
+		return err
+	}
+
+	length := w.offset - start
+
+	err = w.record(http.Header{
+		"WARC-Type":          {"request"},
+		"WARC-Target-URI":    {target},
+		"Content-Type":       {"application/http;msgtype=request"},
+		"WARC-Concurrent-To": {responseID},
+	}, &reqBlock, int64(reqBlock.Len()))
+	if err != nil {
+		return err
+	}
+
+	mime := mediaType(res.header.Get("Content-Type"))
+	if mime == "" {
+		mime = "-"
+	}
+
+	w.cdx = append(w.cdx, fmt.Sprintf("%s %s %s %s %d %s - - %d %d %s",
+		surt(req.URL), time.Now().UTC().Format("20060102150405"), target, mime, res.status,
+		strings.TrimPrefix(payloadDigest, "sha1:"), length, start, w.name))
+
+	return nil
+}
+
+func (w *warcWriter) close() error {
+	slices.Sort(w.cdx)
+
+	b := bufio.NewWriter(w.cdxF)
+	fmt.Fprintln(b, " CDX N b a m s k r M S V g")
+
+	for _, line := range w.cdx {
+		fmt.Fprintln(b, line)
+	}
+
+	err := b.Flush()
+
+	if cerr := w.cdxF.Close(); err == nil {
+		err = cerr
+	}
+
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// surt is the sort-friendly form of u CDX files are keyed on, e.g.
+// "org,example)/path?q" for https://www.example.org/path?q. IP addresses
+// are kept as they are.
+func surt(u *url.URL) string {
+	key := strings.ToLower(u.Hostname())
+
+	if net.ParseIP(key) == nil {
+		labels := strings.Split(strings.TrimPrefix(key, "www."), ".")
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+
+		key = strings.Join(labels, ",")
+	}
+
+	if port := u.Port(); port != "" {
+		key += ":" + port
+	}
+
+	return key + ")" + strings.ToLower(u.RequestURI())
+}
+
+// newRecordID makes a random (version 4) UUID URN.
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
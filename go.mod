@@ -5,7 +5,22 @@ go 1.23
 toolchain go1.23.2
 
 require (
-	github.com/PuerkitoBio/goquery v1.10.0 // indirect
+	github.com/PuerkitoBio/goquery v1.10.0
+	github.com/andybalholm/brotli v1.2.0
+	github.com/klauspost/compress v1.18.2
+	github.com/quic-go/quic-go v0.54.1
+	golang.org/x/net v0.29.0
+	golang.org/x/term v0.24.0
+	golang.org/x/text v0.18.0
+)
+
+require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
-	golang.org/x/net v0.29.0 // indirect
+	github.com/quic-go/qpack v0.5.1 // indirect
+	go.uber.org/mock v0.5.0 // indirect
+	golang.org/x/crypto v0.27.0 // indirect
+	golang.org/x/mod v0.18.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/tools v0.22.0 // indirect
 )